@@ -10,6 +10,23 @@ var AllCasesMap = map[string]TestCase{
 	"PendingAndResolved_AlwaysInactive": PendingAndResolved_AlwaysInactive(),
 	"ZeroFor_SmallFor":                  ZeroFor_SmallFor(),
 	"NewAlerts_OrderCheck":              NewAlerts_OrderCheck(),
+	"ManySeries_Staggered":              ManySeries_Staggered(),
+	"Resolved_StopResending":            Resolved_StopResending(),
+	"LabelOverride":                     LabelOverride(),
+	"LongFor_NeverFires":                LongFor_NeverFires(),
+	"Absent":                            Absent(),
+	"GroupLeft_GroupRight":              GroupLeft_GroupRight(),
+	"ShortGroupInterval":                ShortGroupInterval(),
+	"PendingNotSent":                    PendingNotSent(),
+	"SimultaneousAlerts":                SimultaneousAlerts(),
+	"CounterResets":                     CounterResets(),
+	"TemplateQueryUpdates":              TemplateQueryUpdates(),
+	"OverlappingEvaluations":            OverlappingEvaluations(),
+	"RuleGroupSource":                   RuleGroupSource(),
+	"StaleResolution":                   StaleResolution(),
+	"LargeAnnotation":                   LargeAnnotation(),
+	"Firing_NoDuplicates":               Firing_NoDuplicates(),
+	"SpecialCharsAnnotation":            SpecialCharsAnnotation(),
 }
 
 func AllCases() []TestCase {
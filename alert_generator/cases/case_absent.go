@@ -0,0 +1,336 @@
+package cases
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	absentLastSample   = 8  // Last sample before the series stops being written @2m.
+	absentReturns      = 48 // The series is written again from here @12m.
+	absentLookbackIdx  = 20 // Number of samples in the 5m lookback delta.
+	absentOverTimeIdx  = 4  // Number of samples in the 1m range of absent_over_time.
+	absentTotalSamples = 69
+)
+
+// Absent tests the following cases:
+// * Alert with absent() that fires once the series has not been written for the lookback delta
+//   and gets resolved when the series is written again.
+// * Alert with absent_over_time() that fires once the series has not been written for the range
+//   and gets resolved when the series is written again.
+// Both rules only have a result while a guard series is written, so that they do not fire
+// before the test has started.
+func Absent() TestCase {
+	groupName := "Absent"
+	absentLbls := labels.FromStrings("__name__", SourceTimeSeriesName, "rulegroup", groupName, "series", "absent")
+	guardLbls := labels.FromStrings("__name__", SourceTimeSeriesName, "rulegroup", groupName, "series", "guard")
+	rwInterval := 15 * time.Second
+	return &absent{
+		groupName: groupName,
+		rules: []absentRule{
+			{
+				alertName: groupName + "_Absent",
+				query:     fmt.Sprintf("absent(%s) and on() %s", absentLbls.String(), guardLbls.String()),
+				firingIdx: absentLastSample + absentLookbackIdx,
+			},
+			{
+				alertName: groupName + "_AbsentOverTime",
+				query:     fmt.Sprintf("absent_over_time(%s[1m]) and on() %s", absentLbls.String(), guardLbls.String()),
+				firingIdx: absentLastSample + absentOverTimeIdx,
+			},
+		},
+		absentLabels:  absentLbls,
+		guardLabels:   guardLbls,
+		rwInterval:    rwInterval,
+		groupInterval: 30 * time.Second,
+	}
+}
+
+type absent struct {
+	groupName                 string
+	rules                     []absentRule
+	absentLabels, guardLabels labels.Labels
+	rwInterval, groupInterval time.Duration
+	totalSamples              int
+
+	zeroTime int64
+}
+
+type absentRule struct {
+	alertName string
+	query     string
+	// firingIdx is the index of the sample from when the alert is firing.
+	firingIdx int
+}
+
+func (tc *absent) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) Alert with absent() fires once the series has not been written for the lookback delta and gets resolved when it is written again. " +
+			"(2) Alert with absent_over_time() fires once the series has not been written for the range and gets resolved when it is written again."
+}
+
+func (tc *absent) RuleGroup() (rulefmt.RuleGroup, error) {
+	rg := rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+	}
+	for _, r := range tc.rules {
+		var alert yaml.Node
+		if err := alert.Encode(r.alertName); err != nil {
+			return rulefmt.RuleGroup{}, err
+		}
+		var expr yaml.Node
+		if err := expr.Encode(r.query); err != nil {
+			return rulefmt.RuleGroup{}, err
+		}
+		rg.Rules = append(rg.Rules, rulefmt.RuleNode{ // inactive -> firing -> inactive.
+			Alert:       alert,
+			Expr:        expr,
+			Labels:      map[string]string{"rulegroup": tc.groupName},
+			Annotations: map[string]string{"description": "Series {{$labels.series}} is absent"},
+		})
+	}
+	return rg, nil
+}
+
+func (tc *absent) SamplesToRemoteWrite() []prompb.TimeSeries {
+	// All comment times is assuming 15s interval.
+	absentSamples := sampleSlice(tc.rwInterval, "1", fmt.Sprintf("0x%d", absentLastSample)) // 2m.
+	// Not written for 10m, after which the series is written again for 5m.
+	for _, s := range sampleSlice(tc.rwInterval, "1", fmt.Sprintf("0x%d", absentTotalSamples-absentReturns-1)) {
+		s.Timestamp += absentReturns * int64(tc.rwInterval/time.Millisecond)
+		absentSamples = append(absentSamples, s)
+	}
+	// The guard series is written for the entire test.
+	guardSamples := sampleSlice(tc.rwInterval, "1", fmt.Sprintf("0x%d", absentTotalSamples-1))
+	tc.totalSamples = len(guardSamples)
+	return []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(tc.absentLabels),
+			Samples: absentSamples,
+		},
+		{
+			Labels:  toProtoLabels(tc.guardLabels),
+			Samples: guardSamples,
+		},
+	}
+}
+
+func (tc *absent) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *absent) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *absent) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *absent) CheckRuleGroup(ts int64, rg *v1.RuleGroup) error {
+	if ts-tc.zeroTime < 2*int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg)
+}
+
+func (tc *absent) CheckMetrics(ts int64, samples []promql.Sample) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(expSamples, samples)
+}
+
+func (tc *absent) alertLabels(r absentRule) labels.Labels {
+	return labels.FromStrings("alertname", r.alertName, "rulegroup", tc.groupName, "series", "absent")
+}
+
+func (tc *absent) firingAlert(r absentRule) v1.Alert {
+	activeAt := timestamp.Time(tc.zeroTime + int64(time.Duration(r.firingIdx)*tc.rwInterval/time.Millisecond))
+	return v1.Alert{
+		Labels:      tc.alertLabels(r),
+		Annotations: labels.FromStrings("description", "Series absent is absent"),
+		State:       "firing",
+		Value:       "1",
+		ActiveAt:    &activeAt,
+	}
+}
+
+func (tc *absent) expAlerts(ts int64) (expAlerts [][]v1.Alert) {
+	for _, firing := range tc.allPossibleStates(ts - tc.zeroTime) {
+		exp := []v1.Alert{}
+		for i, r := range tc.rules {
+			if firing[i] {
+				exp = append(exp, tc.firingAlert(r))
+			}
+		}
+		expAlerts = append(expAlerts, exp)
+	}
+
+	return expAlerts
+}
+
+func (tc *absent) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	for _, firing := range tc.allPossibleStates(ts - tc.zeroTime) {
+		rg := v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+		}
+		for i, r := range tc.rules {
+			state := "inactive"
+			var alerts []*v1.Alert
+			if firing[i] {
+				state = "firing"
+				a := tc.firingAlert(r)
+				alerts = append(alerts, &a)
+			}
+			rg.Rules = append(rg.Rules, v1.AlertingRule{
+				State:       state,
+				Name:        r.alertName,
+				Query:       r.query,
+				Labels:      labels.FromStrings("rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "Series {{$labels.series}} is absent"),
+				Alerts:      alerts,
+				Health:      "ok",
+				Type:        "alerting",
+			})
+		}
+		expRgs = append(expRgs, rg)
+	}
+
+	return expRgs
+}
+
+func (tc *absent) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	for _, firing := range tc.allPossibleStates(ts - tc.zeroTime) {
+		var exp []promql.Sample
+		for i, r := range tc.rules {
+			if !firing[i] {
+				continue
+			}
+			lbls := append(tc.alertLabels(r), labels.Label{Name: "__name__", Value: "ALERTS"}, labels.Label{Name: "alertstate", Value: "firing"})
+			sort.Sort(lbls)
+			exp = append(exp, promql.Sample{
+				Point:  promql.Point{T: ts / 1000, V: 1},
+				Metric: lbls,
+			})
+		}
+		expSamples = append(expSamples, exp)
+	}
+
+	return expSamples
+}
+
+// allPossibleStates returns all the possible combinations of the states of the rules at the
+// given time. The i-th entry of a combination is true if the i-th rule can be firing.
+// ts is relative time w.r.t. zeroTime.
+func (tc *absent) allPossibleStates(ts int64) [][]bool {
+	between := betweenFunc(ts)
+
+	rwItvlSecFloat, grpItvlSecFloat := float64(tc.rwInterval/time.Second), float64(tc.groupInterval/time.Second)
+	resolved := absentReturns * rwItvlSecFloat // The series is written again.
+
+	combinations := [][]bool{{}}
+	for _, r := range tc.rules {
+		firing := float64(r.firingIdx) * rwItvlSecFloat // Goes into firing.
+
+		var states []bool
+		if between(0, firing+grpItvlSecFloat) || between(resolved, 240*rwItvlSecFloat) {
+			states = append(states, false)
+		}
+		if between(firing-1, resolved+grpItvlSecFloat) {
+			states = append(states, true)
+		}
+
+		var next [][]bool
+		for _, c := range combinations {
+			for _, s := range states {
+				next = append(next, append(append([]bool{}, c...), s))
+			}
+		}
+		combinations = next
+	}
+
+	return combinations
+}
+
+func (tc *absent) ExpectedAlerts() []ExpectedAlert {
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	rwItvlMs := int64(tc.rwInterval / time.Millisecond)
+	resolved := absentReturns * rwItvlMs
+	resolvedPlus15m := resolved + int64(ResolvedRetention/time.Millisecond)
+	for _, r := range tc.rules {
+		firing := int64(r.firingIdx) * rwItvlMs
+		for ts := firing; ts < resolved; ts += resendDelayMs {
+			addAlert(ExpectedAlert{
+				TimeTolerance: tc.groupInterval,
+				Ts:            timestamp.Time(tc.zeroTime + ts),
+				Resolved:      false,
+				Resend:        ts != firing,
+				NextState:     timestamp.Time(tc.zeroTime + resolved),
+				ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+				EndsAtDelta:   endsAtDelta,
+				Alert: &notifier.Alert{
+					Labels:      tc.alertLabels(r),
+					Annotations: labels.FromStrings("description", "Series absent is absent"),
+					StartsAt:    timestamp.Time(tc.zeroTime + firing),
+				},
+			})
+		}
+		for ts := resolved; ts < resolvedPlus15m; ts += resendDelayMs {
+			tolerance := tc.groupInterval
+			if ts == resolved {
+				// Since the alert state is reset, the alert sent time for resolved alert can be upto
+				// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+				// account for this delay plus the usual tolerance.
+				tolerance = 2 * tc.groupInterval
+			}
+			addAlert(ExpectedAlert{
+				TimeTolerance: tolerance,
+				Ts:            timestamp.Time(tc.zeroTime + ts),
+				Resolved:      true,
+				Resend:        ts != resolved,
+				ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+				EndsAtDelta:   endsAtDelta,
+				Alert: &notifier.Alert{
+					Labels:      tc.alertLabels(r),
+					Annotations: labels.FromStrings("description", "Series absent is absent"),
+					StartsAt:    timestamp.Time(tc.zeroTime + firing),
+				},
+			})
+		}
+	}
+
+	return exp
+}
@@ -0,0 +1,297 @@
+package cases
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// CounterResets tests the following cases:
+// * Alert on resets() over a counter that is reset multiple times, which goes from pending->firing->inactive
+//   as the resets enter and leave the range of the selector.
+// * The range of a range selector within a rule is evaluated relative to the evaluation time.
+func CounterResets() TestCase {
+	groupName := "CounterResets"
+	alertName := groupName + "_SimpleAlert"
+	lbls := metricLabels(groupName, alertName)
+	tc := &counterResets{
+		groupName:     groupName,
+		alertName:     alertName,
+		query:         fmt.Sprintf("resets(%s[5m]) >= 2", lbls.String()),
+		metricLabels:  lbls,
+		rwInterval:    15 * time.Second,
+		groupInterval: 30 * time.Second,
+	}
+	tc.forDuration = model.Duration(4 * tc.rwInterval)
+	return tc
+}
+
+type counterResets struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+	totalSamples              int
+
+	zeroTime int64
+}
+
+func (tc *counterResets) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) Alert on resets() over a counter that is reset multiple times, which goes from pending->firing->inactive as the resets enter and leave the range of the selector. " +
+			"(2) The range of a range selector within a rule is evaluated relative to the evaluation time."
+}
+
+func (tc *counterResets) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	var expr yaml.Node
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "Counter was reset {{$value}} times"},
+			},
+		},
+	}, nil
+}
+
+func (tc *counterResets) SamplesToRemoteWrite() []prompb.TimeSeries {
+	samples := sampleSlice(tc.rwInterval,
+		// All comment times is assuming 15s interval.
+		"1", "1x7", // 2m of increasing counter.
+		"0", "1x7", // First reset @2m.
+		"0", // Second reset @4m. Gets into pending. Goes into firing at 5m.
+		// The first reset leaves the 5m range at 7m, resolved.
+		"1x35",
+	)
+	tc.totalSamples = len(samples)
+	return []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(tc.metricLabels),
+			Samples: samples,
+		},
+	}
+}
+
+func (tc *counterResets) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *counterResets) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *counterResets) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *counterResets) CheckRuleGroup(ts int64, rg *v1.RuleGroup) error {
+	if ts-tc.zeroTime < 2*int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg)
+}
+
+func (tc *counterResets) CheckMetrics(ts int64, samples []promql.Sample) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(expSamples, samples)
+}
+
+// alert returns the alert in the given state.
+func (tc *counterResets) alert(state string) v1.Alert {
+	activeAt := timestamp.Time(tc.zeroTime + int64(16*tc.rwInterval/time.Millisecond))
+	return v1.Alert{
+		Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+		Annotations: labels.FromStrings("description", "Counter was reset 2 times"),
+		State:       state,
+		Value:       "2",
+		ActiveAt:    &activeAt,
+	}
+}
+
+func (tc *counterResets) expAlerts(ts int64) (expAlerts [][]v1.Alert) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(relTs)
+
+	if canBeInactive {
+		expAlerts = append(expAlerts, []v1.Alert{})
+	}
+	if canBePending {
+		expAlerts = append(expAlerts, []v1.Alert{tc.alert("pending")})
+	}
+	if canBeFiring {
+		expAlerts = append(expAlerts, []v1.Alert{tc.alert("firing")})
+	}
+
+	return expAlerts
+}
+
+func (tc *counterResets) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(relTs)
+
+	getRg := func(state string, alerts []*v1.Alert) v1.RuleGroup {
+		return v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.AlertingRule{
+					State:       state,
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+					Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", "Counter was reset {{$value}} times"),
+					Alerts:      alerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		}
+	}
+
+	if canBeInactive {
+		expRgs = append(expRgs, getRg("inactive", nil))
+	}
+	if canBePending {
+		a := tc.alert("pending")
+		expRgs = append(expRgs, getRg("pending", []*v1.Alert{&a}))
+	}
+	if canBeFiring {
+		a := tc.alert("firing")
+		expRgs = append(expRgs, getRg("firing", []*v1.Alert{&a}))
+	}
+
+	return expRgs
+}
+
+func (tc *counterResets) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(relTs)
+
+	if canBeInactive {
+		expSamples = append(expSamples, nil)
+	}
+	if canBePending {
+		expSamples = append(expSamples, []promql.Sample{
+			{
+				Point:  promql.Point{T: ts / 1000, V: 1},
+				Metric: labels.FromStrings("__name__", "ALERTS", "alertstate", "pending", "alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+			},
+		})
+	}
+	if canBeFiring {
+		expSamples = append(expSamples, []promql.Sample{
+			{
+				Point:  promql.Point{T: ts / 1000, V: 1},
+				Metric: labels.FromStrings("__name__", "ALERTS", "alertstate", "firing", "alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+			},
+		})
+	}
+
+	return expSamples
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *counterResets) allPossibleStates(ts int64) (canBeInactive, canBePending, canBeFiring bool) {
+	between := betweenFunc(ts)
+
+	rwItvlSecFloat, grpItvlSecFloat := float64(tc.rwInterval/time.Second), float64(tc.groupInterval/time.Second)
+	_16th := 16 * rwItvlSecFloat // Goes into pending.
+	_20th := 20 * rwItvlSecFloat // Goes into firing.
+	_28th := 28 * rwItvlSecFloat // Resolved.
+	canBeInactive = between(0, _16th+grpItvlSecFloat) || between(_28th, 240*rwItvlSecFloat)
+	canBePending = between(_16th-1, _20th+grpItvlSecFloat)
+	canBeFiring = between(_20th-1, _28th+grpItvlSecFloat)
+	return
+}
+
+func (tc *counterResets) ExpectedAlerts() []ExpectedAlert {
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	_20th := 20 * int64(tc.rwInterval/time.Millisecond) // Firing.
+	_28th := 28 * int64(tc.rwInterval/time.Millisecond) // Resolved.
+	_28thPlus15m := _28th + int64(ResolvedRetention/time.Millisecond)
+	for ts := _20th; ts < _28th; ts += resendDelayMs {
+		addAlert(ExpectedAlert{
+			TimeTolerance: tc.groupInterval,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      false,
+			Resend:        ts != _20th,
+			NextState:     timestamp.Time(tc.zeroTime + _28th),
+			ResolvedTime:  timestamp.Time(tc.zeroTime + _28th),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "Counter was reset 2 times"),
+				StartsAt:    timestamp.Time(tc.zeroTime + _20th),
+			},
+		})
+	}
+	for ts := _28th; ts < _28thPlus15m; ts += resendDelayMs {
+		tolerance := tc.groupInterval
+		if ts == _28th {
+			// Since the alert state is reset, the alert sent time for resolved alert can be upto
+			// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+			// account for this delay plus the usual tolerance.
+			tolerance = 2 * tc.groupInterval
+		}
+		addAlert(ExpectedAlert{
+			TimeTolerance: tolerance,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      true,
+			Resend:        ts != _28th,
+			ResolvedTime:  timestamp.Time(tc.zeroTime + _28th),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "Counter was reset 2 times"),
+				StartsAt:    timestamp.Time(tc.zeroTime + _20th),
+			},
+		})
+	}
+
+	return exp
+}
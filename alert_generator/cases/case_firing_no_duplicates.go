@@ -0,0 +1,276 @@
+package cases
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// Firing_NoDuplicates tests the following cases:
+// * Firing alert is sent exactly once every ResendDelay while it keeps firing for 10m. Any additional
+//   notification for the alert within a resend interval is reported as a duplicate alert.
+// * Resolved alert is sent exactly once every ResendDelay for ResolvedRetention after it got resolved.
+func Firing_NoDuplicates() TestCase {
+	groupName := "Firing_NoDuplicates"
+	alertName := groupName + "_Rule"
+	lbls := metricLabels(groupName, alertName)
+	return &firingNoDuplicates{
+		groupName:     groupName,
+		alertName:     alertName,
+		query:         fmt.Sprintf("%s > 10", lbls.String()),
+		metricLabels:  lbls,
+		rwInterval:    15 * time.Second,
+		groupInterval: 30 * time.Second,
+	}
+}
+
+type firingNoDuplicates struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	rwInterval, groupInterval time.Duration
+	totalSamples              int
+
+	zeroTime int64
+}
+
+func (tc *firingNoDuplicates) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) Firing alert is sent exactly once every resend delay while it is firing for 10m. " +
+			"(2) Resolved alert is sent exactly once every resend delay for 15m after it got resolved."
+}
+
+func (tc *firingNoDuplicates) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	var expr yaml.Node
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{ // inactive -> firing for 10m -> inactive, and stays inactive.
+				Alert:       alert,
+				Expr:        expr,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "This should be sent once every resend delay"},
+			},
+		},
+	}, nil
+}
+
+func (tc *firingNoDuplicates) SamplesToRemoteWrite() []prompb.TimeSeries {
+	samples := sampleSlice(tc.rwInterval,
+		// All comment times is assuming 15s interval.
+		"3", "5", "0x2", "9", // 1m (3 is @0 time).
+		"0x3", "11", // 1m block. Gets into firing at value 11@2m.
+		"0x39", // 10m of firing.
+		// Resolved. 25m more of 9s, i.e. 10m more than the time for which the resolved alert is sent.
+		"9", "0x99",
+	)
+	tc.totalSamples = len(samples)
+	return []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(tc.metricLabels),
+			Samples: samples,
+		},
+	}
+}
+
+func (tc *firingNoDuplicates) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *firingNoDuplicates) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *firingNoDuplicates) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *firingNoDuplicates) CheckRuleGroup(ts int64, rg *v1.RuleGroup) error {
+	if ts-tc.zeroTime < 2*int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg)
+}
+
+func (tc *firingNoDuplicates) CheckMetrics(ts int64, samples []promql.Sample) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(expSamples, samples)
+}
+
+func (tc *firingNoDuplicates) firingAlert() v1.Alert {
+	activeAt := timestamp.Time(tc.zeroTime + int64(8*tc.rwInterval/time.Millisecond))
+	return v1.Alert{
+		Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+		Annotations: labels.FromStrings("description", "This should be sent once every resend delay"),
+		State:       "firing",
+		Value:       "11",
+		ActiveAt:    &activeAt,
+	}
+}
+
+func (tc *firingNoDuplicates) expAlerts(ts int64) (expAlerts [][]v1.Alert) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBeFiring := tc.allPossibleStates(relTs)
+
+	if canBeInactive {
+		expAlerts = append(expAlerts, []v1.Alert{})
+	}
+	if canBeFiring {
+		expAlerts = append(expAlerts, []v1.Alert{tc.firingAlert()})
+	}
+
+	return expAlerts
+}
+
+func (tc *firingNoDuplicates) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBeFiring := tc.allPossibleStates(relTs)
+
+	getRg := func(state string, alerts []*v1.Alert) v1.RuleGroup {
+		return v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.AlertingRule{
+					State:       state,
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", "This should be sent once every resend delay"),
+					Alerts:      alerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		}
+	}
+
+	if canBeInactive {
+		expRgs = append(expRgs, getRg("inactive", nil))
+	}
+	if canBeFiring {
+		a := tc.firingAlert()
+		expRgs = append(expRgs, getRg("firing", []*v1.Alert{&a}))
+	}
+
+	return expRgs
+}
+
+func (tc *firingNoDuplicates) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBeFiring := tc.allPossibleStates(relTs)
+
+	if canBeInactive {
+		expSamples = append(expSamples, nil)
+	}
+	if canBeFiring {
+		expSamples = append(expSamples, []promql.Sample{
+			{
+				Point:  promql.Point{T: ts / 1000, V: 1},
+				Metric: labels.FromStrings("__name__", "ALERTS", "alertstate", "firing", "alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+			},
+		})
+	}
+
+	return expSamples
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *firingNoDuplicates) allPossibleStates(ts int64) (canBeInactive, canBeFiring bool) {
+	between := betweenFunc(ts)
+
+	rwItvlSecFloat, grpItvlSecFloat := float64(tc.rwInterval/time.Second), float64(tc.groupInterval/time.Second)
+	_8th := 8 * rwItvlSecFloat   // Goes into firing.
+	_48th := 48 * rwItvlSecFloat // Resolved.
+	canBeInactive = between(0, _8th+grpItvlSecFloat) || between(_48th, 240*rwItvlSecFloat)
+	canBeFiring = between(_8th-1, _48th+grpItvlSecFloat)
+	return
+}
+
+func (tc *firingNoDuplicates) ExpectedAlerts() []ExpectedAlert {
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	_8th := 8 * int64(tc.rwInterval/time.Millisecond)   // Firing.
+	_48th := 48 * int64(tc.rwInterval/time.Millisecond) // Resolved.
+	_48thPlusRetention := _48th + int64(ResolvedRetention/time.Millisecond)
+	for ts := _8th; ts < _48th; ts += resendDelayMs {
+		addAlert(ExpectedAlert{
+			TimeTolerance: tc.groupInterval,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      false,
+			Resend:        ts != _8th,
+			NextState:     timestamp.Time(tc.zeroTime + _48th),
+			ResolvedTime:  timestamp.Time(tc.zeroTime + _48th),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "This should be sent once every resend delay"),
+				StartsAt:    timestamp.Time(tc.zeroTime + _8th),
+			},
+		})
+	}
+	// These are the last alerts expected for this rule. Since the test runs for 10m more
+	// after this, any alert received after ResolvedRetention is reported as unexpected.
+	for ts := _48th; ts < _48thPlusRetention; ts += resendDelayMs {
+		tolerance := tc.groupInterval
+		if ts == _48th {
+			// Since the alert state is reset, the alert sent time for resolved alert can be upto
+			// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+			// account for this delay plus the usual tolerance.
+			tolerance = 2 * tc.groupInterval
+		}
+		addAlert(ExpectedAlert{
+			TimeTolerance: tolerance,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      true,
+			Resend:        ts != _48th,
+			ResolvedTime:  timestamp.Time(tc.zeroTime + _48th),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "This should be sent once every resend delay"),
+				StartsAt:    timestamp.Time(tc.zeroTime + _8th),
+			},
+		})
+	}
+
+	return exp
+}
@@ -0,0 +1,342 @@
+package cases
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// GroupLeft_GroupRight tests the following cases:
+// * Alert whose query uses group_left() many-to-one matching to enrich the result with labels
+//   of an info-like series, both in the alerts sent and in the APIs.
+// * Same as above with group_right() one-to-many matching.
+func GroupLeft_GroupRight() TestCase {
+	groupName := "GroupLeft_GroupRight"
+	infoLabels := labels.FromStrings("__name__", SourceTimeSeriesName, "instance", "a", "rulegroup", groupName, "series", "info", "team", "infra")
+	valueSelector := labels.FromStrings("__name__", SourceTimeSeriesName, "instance", "a", "rulegroup", groupName, "series", "value")
+	var valueLabels []labels.Labels
+	for _, cpu := range []string{"0", "1"} {
+		lbls := append(valueSelector.Copy(), labels.Label{Name: "cpu", Value: cpu})
+		sort.Sort(lbls)
+		valueLabels = append(valueLabels, lbls)
+	}
+	return &groupLeftRight{
+		groupName:       groupName,
+		groupLeftName:   groupName + "_GroupLeft",
+		groupLeftQuery:  fmt.Sprintf("(%s > 10) * on(instance) group_left(team) %s", valueSelector.String(), infoLabels.String()),
+		groupRightName:  groupName + "_GroupRight",
+		groupRightQuery: fmt.Sprintf("%s * on(instance) group_right(team) (%s > 10)", infoLabels.String(), valueSelector.String()),
+		infoLabels:      infoLabels,
+		valueLabels:     valueLabels,
+		rwInterval:      15 * time.Second,
+		groupInterval:   30 * time.Second,
+	}
+}
+
+type groupLeftRight struct {
+	groupName                       string
+	groupLeftName, groupRightName   string
+	groupLeftQuery, groupRightQuery string
+	infoLabels                      labels.Labels
+	valueLabels                     []labels.Labels
+	rwInterval, groupInterval       time.Duration
+	totalSamples                    int
+
+	zeroTime int64
+}
+
+func (tc *groupLeftRight) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) Alert whose query uses group_left() many-to-one matching carries the joined labels, both in the alerts sent and in the APIs. " +
+			"(2) Same as (1) with group_right() one-to-many matching."
+}
+
+func (tc *groupLeftRight) RuleGroup() (rulefmt.RuleGroup, error) {
+	rg := rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+	}
+	for _, r := range []struct{ name, query string }{
+		{tc.groupLeftName, tc.groupLeftQuery},
+		{tc.groupRightName, tc.groupRightQuery},
+	} {
+		var alert yaml.Node
+		if err := alert.Encode(r.name); err != nil {
+			return rulefmt.RuleGroup{}, err
+		}
+		var expr yaml.Node
+		if err := expr.Encode(r.query); err != nil {
+			return rulefmt.RuleGroup{}, err
+		}
+		rg.Rules = append(rg.Rules, rulefmt.RuleNode{ // inactive -> firing -> inactive.
+			Alert:       alert,
+			Expr:        expr,
+			Labels:      map[string]string{"rulegroup": tc.groupName},
+			Annotations: map[string]string{"description": "CPU {{$labels.cpu}} of team {{$labels.team}} is busy"},
+		})
+	}
+	return rg, nil
+}
+
+func (tc *groupLeftRight) SamplesToRemoteWrite() []prompb.TimeSeries {
+	valueSamples := sampleSlice(tc.rwInterval,
+		// All comment times is assuming 15s interval.
+		"3", "5", "0x2", "9", // 1m (3 is @0 time).
+		"0x3", "11", // 1m block. Gets into firing at value 11@2m.
+		"0x15", // 4m of firing.
+		// Resolved. 5m more of 9s.
+		"9", "0x20",
+	)
+	tc.totalSamples = len(valueSamples)
+	series := []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(tc.infoLabels),
+			Samples: sampleSlice(tc.rwInterval, "1", fmt.Sprintf("0x%d", tc.totalSamples-1)),
+		},
+	}
+	for _, lbls := range tc.valueLabels {
+		series = append(series, prompb.TimeSeries{
+			Labels:  toProtoLabels(lbls),
+			Samples: valueSamples,
+		})
+	}
+	return series
+}
+
+func (tc *groupLeftRight) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *groupLeftRight) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *groupLeftRight) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *groupLeftRight) CheckRuleGroup(ts int64, rg *v1.RuleGroup) error {
+	if ts-tc.zeroTime < 2*int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg)
+}
+
+func (tc *groupLeftRight) CheckMetrics(ts int64, samples []promql.Sample) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(expSamples, samples)
+}
+
+// alertLabels returns the labels of all the alerts of the given rule, which are the
+// labels of the value series without the metric name plus the team of the info series.
+func (tc *groupLeftRight) alertLabels(alertName string) []labels.Labels {
+	var res []labels.Labels
+	for _, lbls := range tc.valueLabels {
+		res = append(res, labels.FromStrings(
+			"alertname", alertName,
+			"cpu", lbls.Get("cpu"),
+			"instance", "a",
+			"rulegroup", tc.groupName,
+			"series", "value",
+			"team", "infra",
+		))
+	}
+	return res
+}
+
+func (tc *groupLeftRight) annotations(lbls labels.Labels) labels.Labels {
+	return labels.FromStrings("description", fmt.Sprintf("CPU %s of team infra is busy", lbls.Get("cpu")))
+}
+
+func (tc *groupLeftRight) firingAlerts() []v1.Alert {
+	activeAt := timestamp.Time(tc.zeroTime + int64(8*tc.rwInterval/time.Millisecond))
+	var alerts []v1.Alert
+	for _, name := range []string{tc.groupLeftName, tc.groupRightName} {
+		for _, lbls := range tc.alertLabels(name) {
+			alerts = append(alerts, v1.Alert{
+				Labels:      lbls,
+				Annotations: tc.annotations(lbls),
+				State:       "firing",
+				Value:       "11",
+				ActiveAt:    &activeAt,
+			})
+		}
+	}
+	return alerts
+}
+
+func (tc *groupLeftRight) expAlerts(ts int64) (expAlerts [][]v1.Alert) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBeFiring := tc.allPossibleStates(relTs)
+
+	if canBeInactive {
+		expAlerts = append(expAlerts, []v1.Alert{})
+	}
+	if canBeFiring {
+		expAlerts = append(expAlerts, tc.firingAlerts())
+	}
+
+	return expAlerts
+}
+
+func (tc *groupLeftRight) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBeFiring := tc.allPossibleStates(relTs)
+
+	getRg := func(state string, alerts []v1.Alert) v1.RuleGroup {
+		rg := v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+		}
+		for _, r := range []struct{ name, query string }{
+			{tc.groupLeftName, tc.groupLeftQuery},
+			{tc.groupRightName, tc.groupRightQuery},
+		} {
+			var ruleAlerts []*v1.Alert
+			for i := range alerts {
+				if alerts[i].Labels.Get("alertname") == r.name {
+					ruleAlerts = append(ruleAlerts, &alerts[i])
+				}
+			}
+			rg.Rules = append(rg.Rules, v1.AlertingRule{
+				State:       state,
+				Name:        r.name,
+				Query:       r.query,
+				Labels:      labels.FromStrings("rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "CPU {{$labels.cpu}} of team {{$labels.team}} is busy"),
+				Alerts:      ruleAlerts,
+				Health:      "ok",
+				Type:        "alerting",
+			})
+		}
+		return rg
+	}
+
+	if canBeInactive {
+		expRgs = append(expRgs, getRg("inactive", nil))
+	}
+	if canBeFiring {
+		expRgs = append(expRgs, getRg("firing", tc.firingAlerts()))
+	}
+
+	return expRgs
+}
+
+func (tc *groupLeftRight) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBeFiring := tc.allPossibleStates(relTs)
+
+	if canBeInactive {
+		expSamples = append(expSamples, nil)
+	}
+	if canBeFiring {
+		var exp []promql.Sample
+		for _, name := range []string{tc.groupLeftName, tc.groupRightName} {
+			for _, lbls := range tc.alertLabels(name) {
+				lbls = append(lbls, labels.Label{Name: "__name__", Value: "ALERTS"}, labels.Label{Name: "alertstate", Value: "firing"})
+				sort.Sort(lbls)
+				exp = append(exp, promql.Sample{
+					Point:  promql.Point{T: ts / 1000, V: 1},
+					Metric: lbls,
+				})
+			}
+		}
+		expSamples = append(expSamples, exp)
+	}
+
+	return expSamples
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *groupLeftRight) allPossibleStates(ts int64) (canBeInactive, canBeFiring bool) {
+	between := betweenFunc(ts)
+
+	rwItvlSecFloat, grpItvlSecFloat := float64(tc.rwInterval/time.Second), float64(tc.groupInterval/time.Second)
+	_8th := 8 * rwItvlSecFloat   // Goes into firing.
+	_24th := 24 * rwItvlSecFloat // Resolved.
+	canBeInactive = between(0, _8th+grpItvlSecFloat) || between(_24th, 240*rwItvlSecFloat)
+	canBeFiring = between(_8th-1, _24th+grpItvlSecFloat)
+	return
+}
+
+func (tc *groupLeftRight) ExpectedAlerts() []ExpectedAlert {
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	_8th := 8 * int64(tc.rwInterval/time.Millisecond)   // Firing.
+	_24th := 24 * int64(tc.rwInterval/time.Millisecond) // Resolved.
+	_24thPlus15m := _24th + int64(ResolvedRetention/time.Millisecond)
+	for _, name := range []string{tc.groupLeftName, tc.groupRightName} {
+		for _, lbls := range tc.alertLabels(name) {
+			for ts := _8th; ts < _24th; ts += resendDelayMs {
+				addAlert(ExpectedAlert{
+					TimeTolerance: tc.groupInterval,
+					Ts:            timestamp.Time(tc.zeroTime + ts),
+					Resolved:      false,
+					Resend:        ts != _8th,
+					NextState:     timestamp.Time(tc.zeroTime + _24th),
+					ResolvedTime:  timestamp.Time(tc.zeroTime + _24th),
+					EndsAtDelta:   endsAtDelta,
+					Alert: &notifier.Alert{
+						Labels:      lbls,
+						Annotations: tc.annotations(lbls),
+						StartsAt:    timestamp.Time(tc.zeroTime + _8th),
+					},
+				})
+			}
+			for ts := _24th; ts < _24thPlus15m; ts += resendDelayMs {
+				tolerance := tc.groupInterval
+				if ts == _24th {
+					// Since the alert state is reset, the alert sent time for resolved alert can be upto
+					// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+					// account for this delay plus the usual tolerance.
+					tolerance = 2 * tc.groupInterval
+				}
+				addAlert(ExpectedAlert{
+					TimeTolerance: tolerance,
+					Ts:            timestamp.Time(tc.zeroTime + ts),
+					Resolved:      true,
+					Resend:        ts != _24th,
+					ResolvedTime:  timestamp.Time(tc.zeroTime + _24th),
+					EndsAtDelta:   endsAtDelta,
+					Alert: &notifier.Alert{
+						Labels:      lbls,
+						Annotations: tc.annotations(lbls),
+						StartsAt:    timestamp.Time(tc.zeroTime + _8th),
+					},
+				})
+			}
+		}
+	}
+
+	return exp
+}
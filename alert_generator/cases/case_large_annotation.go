@@ -0,0 +1,294 @@
+package cases
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// largeAnnotationSize is the number of padding characters of the large annotation, well above the size
+// limits of some notification integrations.
+const largeAnnotationSize = 16384
+
+// LargeAnnotation tests the following cases:
+// * An annotation template producing a very large value being expanded in full.
+// * The alert being sent with the full annotation, or with the annotation truncated to
+//   annotation_size_limit if the engine or a proxy in between enforces a size limit.
+func LargeAnnotation() TestCase {
+	groupName := "LargeAnnotation"
+	alertName := groupName + "_SimpleAlert"
+	lbls := metricLabels(groupName, alertName)
+	return &largeAnnotation{
+		groupName:     groupName,
+		alertName:     alertName,
+		query:         fmt.Sprintf("%s > 10", lbls.String()),
+		metricLabels:  lbls,
+		rwInterval:    15 * time.Second,
+		groupInterval: 30 * time.Second,
+	}
+}
+
+type largeAnnotation struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	rwInterval, groupInterval time.Duration
+	totalSamples              int
+
+	zeroTime int64
+}
+
+// largeAnnotationTemplate pads the description with zeros to largeAnnotationSize characters.
+var largeAnnotationTemplate = fmt.Sprintf(`SimpleAlert is firing: {{ printf "%%0*d" %d 0 }}`, largeAnnotationSize)
+
+func (tc *largeAnnotation) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) An annotation template producing a very large value being expanded in full. " +
+			"(2) The alert being sent with the full annotation, or with the annotation truncated to annotation_size_limit if the engine or a proxy in between enforces a size limit."
+}
+
+func (tc *largeAnnotation) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	var expr yaml.Node
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				Labels:      map[string]string{"rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": largeAnnotationTemplate},
+			},
+		},
+	}, nil
+}
+
+func (tc *largeAnnotation) SamplesToRemoteWrite() []prompb.TimeSeries {
+	samples := sampleSlice(tc.rwInterval,
+		// All comment times is assuming 15s interval.
+		"3", "5", "0x2", "9", // 1m (3 is @0 time).
+		"0x3", "11", // 1m block. Gets into firing at value 11@2m.
+		"0x15",      // 4m of firing.
+		"9", "0x20", // Resolved. 5m more of 9s.
+	)
+	tc.totalSamples = len(samples)
+	return []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(tc.metricLabels),
+			Samples: samples,
+		},
+	}
+}
+
+func (tc *largeAnnotation) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *largeAnnotation) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *largeAnnotation) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *largeAnnotation) CheckRuleGroup(ts int64, rg *v1.RuleGroup) error {
+	if ts-tc.zeroTime < 2*int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg)
+}
+
+func (tc *largeAnnotation) CheckMetrics(ts int64, samples []promql.Sample) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(expSamples, samples)
+}
+
+func (tc *largeAnnotation) alertLabels() labels.Labels {
+	return labels.FromStrings("alertname", tc.alertName, "rulegroup", tc.groupName)
+}
+
+func (tc *largeAnnotation) alertAnnotations() labels.Labels {
+	return labels.FromStrings("description", "SimpleAlert is firing: "+strings.Repeat("0", largeAnnotationSize))
+}
+
+func (tc *largeAnnotation) firingAlerts() []v1.Alert {
+	activeAt := timestamp.Time(tc.zeroTime + int64(8*tc.rwInterval/time.Millisecond))
+	return []v1.Alert{
+		{
+			Labels:      tc.alertLabels(),
+			Annotations: tc.alertAnnotations(),
+			State:       "firing",
+			Value:       "11",
+			ActiveAt:    &activeAt,
+		},
+	}
+}
+
+func (tc *largeAnnotation) expAlerts(ts int64) (expAlerts [][]v1.Alert) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBeFiring := tc.allPossibleStates(relTs)
+
+	if canBeInactive {
+		expAlerts = append(expAlerts, []v1.Alert{})
+	}
+	if canBeFiring {
+		expAlerts = append(expAlerts, tc.firingAlerts())
+	}
+
+	return expAlerts
+}
+
+func (tc *largeAnnotation) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBeFiring := tc.allPossibleStates(relTs)
+
+	getRg := func(state string, alerts []v1.Alert) v1.RuleGroup {
+		var ruleAlerts []*v1.Alert
+		for i := range alerts {
+			ruleAlerts = append(ruleAlerts, &alerts[i])
+		}
+		return v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.AlertingRule{
+					State:       state,
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Labels:      labels.FromStrings("rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", largeAnnotationTemplate),
+					Alerts:      ruleAlerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		}
+	}
+
+	if canBeInactive {
+		expRgs = append(expRgs, getRg("inactive", nil))
+	}
+	if canBeFiring {
+		expRgs = append(expRgs, getRg("firing", tc.firingAlerts()))
+	}
+
+	return expRgs
+}
+
+func (tc *largeAnnotation) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBeFiring := tc.allPossibleStates(relTs)
+
+	if canBeInactive {
+		expSamples = append(expSamples, nil)
+	}
+	if canBeFiring {
+		expSamples = append(expSamples, []promql.Sample{
+			{
+				Point:  promql.Point{T: ts / 1000, V: 1},
+				Metric: labels.FromStrings("__name__", "ALERTS", "alertstate", "firing", "alertname", tc.alertName, "rulegroup", tc.groupName),
+			},
+		})
+	}
+
+	return expSamples
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *largeAnnotation) allPossibleStates(ts int64) (canBeInactive, canBeFiring bool) {
+	between := betweenFunc(ts)
+
+	rwItvlSecFloat, grpItvlSecFloat := float64(tc.rwInterval/time.Second), float64(tc.groupInterval/time.Second)
+	_8th := 8 * rwItvlSecFloat   // Goes into firing.
+	_24th := 24 * rwItvlSecFloat // Resolved.
+	canBeInactive = between(0, _8th+grpItvlSecFloat) || between(_24th, 240*rwItvlSecFloat)
+	canBeFiring = between(_8th-1, _24th+grpItvlSecFloat)
+	return
+}
+
+func (tc *largeAnnotation) ExpectedAlerts() []ExpectedAlert {
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	_8th := 8 * int64(tc.rwInterval/time.Millisecond)   // Firing.
+	_24th := 24 * int64(tc.rwInterval/time.Millisecond) // Resolved.
+	_24thPlus15m := _24th + int64(ResolvedRetention/time.Millisecond)
+	for ts := _8th; ts < _24th; ts += resendDelayMs {
+		addAlert(ExpectedAlert{
+			TimeTolerance: tc.groupInterval,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      false,
+			Resend:        ts != _8th,
+			NextState:     timestamp.Time(tc.zeroTime + _24th),
+			ResolvedTime:  timestamp.Time(tc.zeroTime + _24th),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      tc.alertLabels(),
+				Annotations: tc.alertAnnotations(),
+				StartsAt:    timestamp.Time(tc.zeroTime + _8th),
+			},
+		})
+	}
+	for ts := _24th; ts < _24thPlus15m; ts += resendDelayMs {
+		tolerance := tc.groupInterval
+		if ts == _24th {
+			// Since the alert state is reset, the alert sent time for resolved alert can be upto
+			// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+			// account for this delay plus the usual tolerance.
+			tolerance = 2 * tc.groupInterval
+		}
+		addAlert(ExpectedAlert{
+			TimeTolerance: tolerance,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      true,
+			Resend:        ts != _24th,
+			ResolvedTime:  timestamp.Time(tc.zeroTime + _24th),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      tc.alertLabels(),
+				Annotations: tc.alertAnnotations(),
+				StartsAt:    timestamp.Time(tc.zeroTime + _8th),
+			},
+		})
+	}
+
+	return exp
+}
@@ -0,0 +1,221 @@
+package cases
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// LongFor_NeverFires tests the following cases:
+// * Alert with a 'for' duration longer than the time for which the query has any result stays pending
+//   and goes back to inactive once the query has no result, without ever firing.
+// * No alert is sent for such an alert.
+func LongFor_NeverFires() TestCase {
+	groupName := "LongFor_NeverFires"
+	alertName := groupName + "_Rule"
+	lbls := metricLabels(groupName, alertName)
+	return &longForNeverFires{
+		groupName:     groupName,
+		alertName:     alertName,
+		query:         fmt.Sprintf("%s > 10", lbls.String()),
+		metricLabels:  lbls,
+		rwInterval:    15 * time.Second,
+		groupInterval: 30 * time.Second,
+		forDuration:   model.Duration(time.Hour),
+	}
+}
+
+type longForNeverFires struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+	totalSamples              int
+
+	zeroTime int64
+}
+
+func (tc *longForNeverFires) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) Alert with a 'for' duration longer than the time for which the query has any result stays pending and goes back to inactive without firing. " +
+			"(2) No alert is sent for such an alert."
+}
+
+func (tc *longForNeverFires) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	var expr yaml.Node
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{ // inactive -> pending -> inactive, the 'for' never elapses.
+				Alert:       alert,
+				Expr:        expr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "This should never fire"},
+			},
+		},
+	}, nil
+}
+
+func (tc *longForNeverFires) SamplesToRemoteWrite() []prompb.TimeSeries {
+	samples := sampleSlice(tc.rwInterval,
+		// All comment times is assuming 15s interval.
+		"3", "5", "0x2", "9", // 1m (3 is @0 time).
+		"0x3", "11", // 1m block. Gets into pending at value 11@2m.
+		"0x39", // 10m of pending, much less than the 1h 'for' duration.
+		// Resolved. 5m more of 9s. Should not get any alerts.
+		"9", "0x19",
+	)
+	tc.totalSamples = len(samples)
+	return []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(tc.metricLabels),
+			Samples: samples,
+		},
+	}
+}
+
+func (tc *longForNeverFires) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *longForNeverFires) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *longForNeverFires) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *longForNeverFires) CheckRuleGroup(ts int64, rg *v1.RuleGroup) error {
+	if ts-tc.zeroTime < 2*int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg)
+}
+
+func (tc *longForNeverFires) CheckMetrics(ts int64, samples []promql.Sample) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(expSamples, samples)
+}
+
+func (tc *longForNeverFires) pendingAlert() v1.Alert {
+	activeAt := timestamp.Time(tc.zeroTime + int64(8*tc.rwInterval/time.Millisecond))
+	return v1.Alert{
+		Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+		Annotations: labels.FromStrings("description", "This should never fire"),
+		State:       "pending",
+		Value:       "11",
+		ActiveAt:    &activeAt,
+	}
+}
+
+func (tc *longForNeverFires) expAlerts(ts int64) (expAlerts [][]v1.Alert) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending := tc.allPossibleStates(relTs)
+
+	if canBeInactive {
+		expAlerts = append(expAlerts, []v1.Alert{})
+	}
+	if canBePending {
+		expAlerts = append(expAlerts, []v1.Alert{tc.pendingAlert()})
+	}
+
+	return expAlerts
+}
+
+func (tc *longForNeverFires) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending := tc.allPossibleStates(relTs)
+
+	getRg := func(state string, alerts []*v1.Alert) v1.RuleGroup {
+		return v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.AlertingRule{
+					State:       state,
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+					Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", "This should never fire"),
+					Alerts:      alerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		}
+	}
+
+	if canBeInactive {
+		expRgs = append(expRgs, getRg("inactive", nil))
+	}
+	if canBePending {
+		a := tc.pendingAlert()
+		expRgs = append(expRgs, getRg("pending", []*v1.Alert{&a}))
+	}
+
+	return expRgs
+}
+
+func (tc *longForNeverFires) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending := tc.allPossibleStates(relTs)
+
+	if canBeInactive {
+		expSamples = append(expSamples, nil)
+	}
+	if canBePending {
+		expSamples = append(expSamples, []promql.Sample{
+			{
+				Point:  promql.Point{T: ts / 1000, V: 1},
+				Metric: labels.FromStrings("__name__", "ALERTS", "alertstate", "pending", "alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+			},
+		})
+	}
+
+	return expSamples
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *longForNeverFires) allPossibleStates(ts int64) (canBeInactive, canBePending bool) {
+	between := betweenFunc(ts)
+
+	rwItvlSecFloat, grpItvlSecFloat := float64(tc.rwInterval/time.Second), float64(tc.groupInterval/time.Second)
+	_8th := 8 * rwItvlSecFloat   // Goes into pending.
+	_48th := 48 * rwItvlSecFloat // Becomes inactive.
+	canBeInactive = between(0, _8th+grpItvlSecFloat) || between(_48th, 240*rwItvlSecFloat)
+	canBePending = between(_8th-1, _48th+grpItvlSecFloat)
+	return
+}
+
+func (tc *longForNeverFires) ExpectedAlerts() []ExpectedAlert {
+	// We expect no alerts to be sent since the alert never fires.
+	return nil
+}
@@ -0,0 +1,357 @@
+package cases
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// ManySeries_Staggered tests the following cases:
+// * A single rule whose query matches many series, where each series becomes pending and firing at a
+//   different time. Every series must produce an independently tracked alert with its own ActiveAt.
+// * Expansion of template in annotations uses the labels of the individual series.
+// * All the alerts of the rule get resolved together when there is no more data.
+func ManySeries_Staggered() TestCase {
+	groupName := "ManySeries_Staggered"
+	alertName := groupName + "_Rule"
+	lbls := metricLabels(groupName, alertName)
+	tc := &manySeriesStaggered{
+		groupName:     groupName,
+		alertName:     alertName,
+		query:         fmt.Sprintf("%s > 10", lbls.String()),
+		metricLabels:  lbls,
+		numSeries:     24,
+		rwInterval:    15 * time.Second,
+		groupInterval: 30 * time.Second,
+	}
+	tc.forDuration = model.Duration(10 * tc.rwInterval) // 2m30s with 15s rw interval.
+	return tc
+}
+
+type manySeriesStaggered struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	numSeries                 int
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+	totalSamples              int
+
+	zeroTime int64
+}
+
+const (
+	// manySeriesFirstPending is the sample index at which the first series goes into pending.
+	manySeriesFirstPending = 8
+	// manySeriesStagger is the number of samples between two consecutive series going into pending.
+	manySeriesStagger = 2
+	// manySeriesResolved is the sample index at which all the series get resolved.
+	manySeriesResolved = 72
+)
+
+func (tc *manySeriesStaggered) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) A single rule whose query matches many series, where each series becomes pending and firing at a different time. " +
+			"Every series must produce an independently tracked alert with its own ActiveAt. " +
+			"(2) Expansion of template in annotations uses the labels of the individual series. " +
+			"(3) All the alerts of the rule get resolved together when there is no more data."
+}
+
+func (tc *manySeriesStaggered) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	var expr yaml.Node
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "Series {{$labels.series}} is firing"},
+			},
+		},
+	}, nil
+}
+
+// seriesName returns the value of the "series" label for the i-th series.
+func (tc *manySeriesStaggered) seriesName(i int) string {
+	return fmt.Sprintf("%02d", i)
+}
+
+// pendingIdx and firingIdx return the sample index at which the i-th series
+// goes into pending and firing respectively.
+func (tc *manySeriesStaggered) pendingIdx(i int) int {
+	return manySeriesFirstPending + i*manySeriesStagger
+}
+
+func (tc *manySeriesStaggered) firingIdx(i int) int {
+	return tc.pendingIdx(i) + int(time.Duration(tc.forDuration)/tc.rwInterval)
+}
+
+func (tc *manySeriesStaggered) SamplesToRemoteWrite() []prompb.TimeSeries {
+	var series []prompb.TimeSeries
+	for i := 0; i < tc.numSeries; i++ {
+		lbls := append(tc.metricLabels.Copy(), labels.Label{Name: "series", Value: tc.seriesName(i)})
+		sort.Sort(lbls)
+		pending := tc.pendingIdx(i)
+		samples := sampleSlice(tc.rwInterval,
+			// All comment times is assuming 15s interval.
+			"1", fmt.Sprintf("0x%d", pending-1), // Inactive until 2m+(i*30s).
+			"11", // Pending here and firing after 2m30s.
+			fmt.Sprintf("0x%d", manySeriesResolved-pending-1),
+			// Resolved now for all the series @18m.
+			"9", "0x20",
+		)
+		if len(samples) > tc.totalSamples {
+			tc.totalSamples = len(samples)
+		}
+		series = append(series, prompb.TimeSeries{
+			Labels:  toProtoLabels(lbls),
+			Samples: samples,
+		})
+	}
+	return series
+}
+
+func (tc *manySeriesStaggered) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *manySeriesStaggered) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *manySeriesStaggered) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *manySeriesStaggered) CheckRuleGroup(ts int64, rg *v1.RuleGroup) error {
+	if ts-tc.zeroTime < 2*int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg)
+}
+
+func (tc *manySeriesStaggered) CheckMetrics(ts int64, samples []promql.Sample) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(expSamples, samples)
+}
+
+func (tc *manySeriesStaggered) alert(i int, state string) v1.Alert {
+	activeAt := timestamp.Time(tc.zeroTime + int64(time.Duration(tc.pendingIdx(i))*tc.rwInterval/time.Millisecond))
+	return v1.Alert{
+		Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName, "series", tc.seriesName(i)),
+		Annotations: labels.FromStrings("description", fmt.Sprintf("Series %s is firing", tc.seriesName(i))),
+		State:       state,
+		Value:       "11",
+		ActiveAt:    &activeAt,
+	}
+}
+
+func (tc *manySeriesStaggered) expAlerts(ts int64) (expAlerts [][]v1.Alert) {
+	for _, states := range tc.allPossibleStates(ts - tc.zeroTime) {
+		exp := []v1.Alert{}
+		for i, s := range states {
+			if s != "inactive" {
+				exp = append(exp, tc.alert(i, s))
+			}
+		}
+		expAlerts = append(expAlerts, exp)
+	}
+
+	return expAlerts
+}
+
+func (tc *manySeriesStaggered) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	for _, states := range tc.allPossibleStates(ts - tc.zeroTime) {
+		ruleState := "inactive"
+		var alerts []*v1.Alert
+		for i, s := range states {
+			if s == "inactive" {
+				continue
+			}
+			a := tc.alert(i, s)
+			alerts = append(alerts, &a)
+			if s == "firing" || ruleState == "inactive" {
+				ruleState = s
+			}
+		}
+		expRgs = append(expRgs, v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.AlertingRule{
+					State:       ruleState,
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+					Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", "Series {{$labels.series}} is firing"),
+					Alerts:      alerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		})
+	}
+
+	return expRgs
+}
+
+func (tc *manySeriesStaggered) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	for _, states := range tc.allPossibleStates(ts - tc.zeroTime) {
+		var exp []promql.Sample
+		for i, s := range states {
+			if s == "inactive" {
+				continue
+			}
+			exp = append(exp, promql.Sample{
+				Point:  promql.Point{T: ts / 1000, V: 1},
+				Metric: labels.FromStrings("__name__", "ALERTS", "alertstate", s, "alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName, "series", tc.seriesName(i)),
+			})
+		}
+		expSamples = append(expSamples, exp)
+	}
+
+	return expSamples
+}
+
+// allPossibleStates returns all the possible combinations of the states of the series
+// at the given time. The i-th entry of a combination is the state of the i-th series.
+// Since all the series get resolved together, the resolved state is a single combination
+// with all the series inactive.
+// ts is relative time w.r.t. zeroTime.
+func (tc *manySeriesStaggered) allPossibleStates(ts int64) [][]string {
+	between := betweenFunc(ts)
+
+	rwItvlSecFloat, grpItvlSecFloat := float64(tc.rwInterval/time.Second), float64(tc.groupInterval/time.Second)
+	resolved := manySeriesResolved * rwItvlSecFloat
+
+	combinations := [][]string{{}}
+	for i := 0; i < tc.numSeries; i++ {
+		pending := float64(tc.pendingIdx(i)) * rwItvlSecFloat // Goes into pending.
+		firing := float64(tc.firingIdx(i)) * rwItvlSecFloat   // Firing.
+
+		var states []string
+		if between(0, pending+grpItvlSecFloat) {
+			states = append(states, "inactive")
+		}
+		if between(pending-1, firing+grpItvlSecFloat) {
+			states = append(states, "pending")
+		}
+		if between(firing-1, resolved+grpItvlSecFloat) {
+			states = append(states, "firing")
+		}
+
+		var next [][]string
+		for _, c := range combinations {
+			for _, s := range states {
+				next = append(next, append(append([]string{}, c...), s))
+			}
+		}
+		combinations = next
+	}
+
+	if between(resolved, 240*rwItvlSecFloat) {
+		allInactive := make([]string, tc.numSeries)
+		for i := range allInactive {
+			allInactive[i] = "inactive"
+		}
+		combinations = append(combinations, allInactive)
+	}
+
+	return combinations
+}
+
+func (tc *manySeriesStaggered) ExpectedAlerts() []ExpectedAlert {
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	rwItvlMs := int64(tc.rwInterval / time.Millisecond)
+	resolved := manySeriesResolved * rwItvlMs
+	resolvedPlus15m := resolved + int64(ResolvedRetention/time.Millisecond)
+	for i := 0; i < tc.numSeries; i++ {
+		firing := int64(tc.firingIdx(i)) * rwItvlMs
+		lbls := labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName, "series", tc.seriesName(i))
+		annotations := labels.FromStrings("description", fmt.Sprintf("Series %s is firing", tc.seriesName(i)))
+
+		for ts := firing; ts < resolved; ts += resendDelayMs {
+			addAlert(ExpectedAlert{
+				TimeTolerance: tc.groupInterval,
+				Ts:            timestamp.Time(tc.zeroTime + ts),
+				Resolved:      false,
+				Resend:        ts != firing,
+				NextState:     timestamp.Time(tc.zeroTime + resolved),
+				ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+				EndsAtDelta:   endsAtDelta,
+				Alert: &notifier.Alert{
+					Labels:      lbls,
+					Annotations: annotations,
+					StartsAt:    timestamp.Time(tc.zeroTime + firing),
+				},
+			})
+		}
+		for ts := resolved; ts < resolvedPlus15m; ts += resendDelayMs {
+			tolerance := tc.groupInterval
+			if ts == resolved {
+				// Since the alert state is reset, the alert sent time for resolved alert can be upto
+				// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+				// account for this delay plus the usual tolerance.
+				tolerance = 2 * tc.groupInterval
+			}
+			addAlert(ExpectedAlert{
+				TimeTolerance: tolerance,
+				Ts:            timestamp.Time(tc.zeroTime + ts),
+				Resolved:      true,
+				Resend:        ts != resolved,
+				ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+				EndsAtDelta:   endsAtDelta,
+				Alert: &notifier.Alert{
+					Labels:      lbls,
+					Annotations: annotations,
+					StartsAt:    timestamp.Time(tc.zeroTime + firing),
+				},
+			})
+		}
+	}
+
+	return exp
+}
@@ -499,7 +499,7 @@ func (tc *newAlertsAndOrderCheck) ExpectedAlerts() []ExpectedAlert {
 	// r11.
 	_20th := 20 * int64(tc.rwInterval/time.Millisecond) // Firing.
 	_73rd := 73 * int64(tc.rwInterval/time.Millisecond) // Resolved.
-	_73rdPlus15m := _73rd + int64(15*time.Minute/time.Millisecond)
+	_73rdPlus15m := _73rd + int64(ResolvedRetention/time.Millisecond)
 	for ts := _20th; ts < _73rd; ts += resendDelayMs {
 		addAlert(ExpectedAlert{
 			TimeTolerance: tc.groupInterval,
@@ -544,7 +544,7 @@ func (tc *newAlertsAndOrderCheck) ExpectedAlerts() []ExpectedAlert {
 	// r12.
 	_44th := 44 * int64(tc.rwInterval/time.Millisecond) // Firing.
 	_65th := 65 * int64(tc.rwInterval/time.Millisecond) // Resolved.
-	_65thPlus15m := _65th + int64(15*time.Minute/time.Millisecond)
+	_65thPlus15m := _65th + int64(ResolvedRetention/time.Millisecond)
 	//_8th_plus_gi := _8th + int64(tc.groupInterval/time.Millisecond) // Small for firing.
 	for ts := _44th; ts < _65th; ts += resendDelayMs {
 		addAlert(ExpectedAlert{
@@ -0,0 +1,315 @@
+package cases
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// OverlappingEvaluations tests the following cases:
+// * Group interval of 1s with a query over many samples, whose evaluation can take a significant part of the
+//   interval and overlap with the next one if the engine does not serialize the evaluations of a group.
+// * Alert that goes from pending->firing->inactive does not flap between states, reset its active time or
+//   get sent with a wrong state when the evaluations are tightly packed.
+func OverlappingEvaluations() TestCase {
+	groupName := "OverlappingEvaluations"
+	alertName := groupName + "_SimpleAlert"
+	lbls := metricLabels(groupName, alertName)
+	tc := &overlappingEvaluations{
+		groupName:     groupName,
+		alertName:     alertName,
+		metricLabels:  lbls,
+		loadLabels:    labels.FromStrings("__name__", SourceTimeSeriesName, "rulegroup", groupName, "series", "load"),
+		rwInterval:    15 * time.Second,
+		groupInterval: time.Second,
+	}
+	// The right hand side never returns anything, but is evaluated over all the samples of the last 10m
+	// of all the load series on every evaluation.
+	tc.query = fmt.Sprintf("%s > 10 unless on() (sum(count_over_time(%s[10m])) < 0)", lbls.String(), tc.loadLabels.String())
+	tc.forDuration = model.Duration(4 * tc.rwInterval)
+	return tc
+}
+
+type overlappingEvaluations struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	loadLabels                labels.Labels
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+	totalSamples              int
+
+	zeroTime int64
+}
+
+func (tc *overlappingEvaluations) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) Group interval of 1s with a query over many samples, whose evaluation can take a significant part of the interval and overlap with the next one if the engine does not serialize the evaluations of a group. " +
+			"(2) Alert that goes from pending->firing->inactive does not flap between states, reset its active time or get sent with a wrong state when the evaluations are tightly packed."
+}
+
+func (tc *overlappingEvaluations) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	var expr yaml.Node
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "SimpleAlert is firing"},
+			},
+		},
+	}, nil
+}
+
+func (tc *overlappingEvaluations) SamplesToRemoteWrite() []prompb.TimeSeries {
+	samples := sampleSlice(tc.rwInterval,
+		// All comment times is assuming 15s interval.
+		"3", "5", "0x2", "9", // 1m (3 is @0 time).
+		"0x3", "11", // 1m block. Gets into pending at value 11@2m.
+		"0x23", // 6m of same value, evaluated 15 times per sample. Goes into firing at 3m.
+		// Resolved. 5m more of 9s.
+		"9", "0x20",
+	)
+	tc.totalSamples = len(samples)
+	series := []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(tc.metricLabels),
+			Samples: samples,
+		},
+	}
+
+	// Samples for the expensive part of the query.
+	for i := 1; i <= 100; i++ {
+		b := labels.NewBuilder(tc.loadLabels)
+		b.Set("id", fmt.Sprintf("%d", i))
+		series = append(series, prompb.TimeSeries{
+			Labels:  toProtoLabels(b.Labels()),
+			Samples: sampleSlice(tc.rwInterval, "1", fmt.Sprintf("1x%d", tc.totalSamples-1)),
+		})
+	}
+
+	return series
+}
+
+func (tc *overlappingEvaluations) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *overlappingEvaluations) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *overlappingEvaluations) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *overlappingEvaluations) CheckRuleGroup(ts int64, rg *v1.RuleGroup) error {
+	if ts-tc.zeroTime < 2*int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg)
+}
+
+func (tc *overlappingEvaluations) CheckMetrics(ts int64, samples []promql.Sample) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(expSamples, samples)
+}
+
+// alert returns the alert in the given state. The active time is the same for both pending and firing,
+// any flapping in between resets it and hence is caught.
+func (tc *overlappingEvaluations) alert(state string) v1.Alert {
+	activeAt := timestamp.Time(tc.zeroTime + int64(8*tc.rwInterval/time.Millisecond))
+	return v1.Alert{
+		Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+		Annotations: labels.FromStrings("description", "SimpleAlert is firing"),
+		State:       state,
+		Value:       "11",
+		ActiveAt:    &activeAt,
+	}
+}
+
+func (tc *overlappingEvaluations) expAlerts(ts int64) (expAlerts [][]v1.Alert) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(relTs)
+
+	if canBeInactive {
+		expAlerts = append(expAlerts, []v1.Alert{})
+	}
+	if canBePending {
+		expAlerts = append(expAlerts, []v1.Alert{tc.alert("pending")})
+	}
+	if canBeFiring {
+		expAlerts = append(expAlerts, []v1.Alert{tc.alert("firing")})
+	}
+
+	return expAlerts
+}
+
+func (tc *overlappingEvaluations) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(relTs)
+
+	getRg := func(state string, alerts []*v1.Alert) v1.RuleGroup {
+		return v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.AlertingRule{
+					State:       state,
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+					Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", "SimpleAlert is firing"),
+					Alerts:      alerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		}
+	}
+
+	if canBeInactive {
+		expRgs = append(expRgs, getRg("inactive", nil))
+	}
+	if canBePending {
+		a := tc.alert("pending")
+		expRgs = append(expRgs, getRg("pending", []*v1.Alert{&a}))
+	}
+	if canBeFiring {
+		a := tc.alert("firing")
+		expRgs = append(expRgs, getRg("firing", []*v1.Alert{&a}))
+	}
+
+	return expRgs
+}
+
+func (tc *overlappingEvaluations) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(relTs)
+
+	if canBeInactive {
+		expSamples = append(expSamples, nil)
+	}
+	if canBePending {
+		expSamples = append(expSamples, []promql.Sample{
+			{
+				Point:  promql.Point{T: ts / 1000, V: 1},
+				Metric: labels.FromStrings("__name__", "ALERTS", "alertstate", "pending", "alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+			},
+		})
+	}
+	if canBeFiring {
+		expSamples = append(expSamples, []promql.Sample{
+			{
+				Point:  promql.Point{T: ts / 1000, V: 1},
+				Metric: labels.FromStrings("__name__", "ALERTS", "alertstate", "firing", "alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+			},
+		})
+	}
+
+	return expSamples
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *overlappingEvaluations) allPossibleStates(ts int64) (canBeInactive, canBePending, canBeFiring bool) {
+	between := betweenFunc(ts)
+
+	rwItvlSecFloat, grpItvlSecFloat := float64(tc.rwInterval/time.Second), float64(tc.groupInterval/time.Second)
+	_8th := 8 * rwItvlSecFloat   // Goes into pending.
+	_12th := 12 * rwItvlSecFloat // Goes into firing.
+	_32nd := 32 * rwItvlSecFloat // Resolved.
+	canBeInactive = between(0, _8th+grpItvlSecFloat) || between(_32nd, 240*rwItvlSecFloat)
+	canBePending = between(_8th-1, _12th+grpItvlSecFloat)
+	canBeFiring = between(_12th-1, _32nd+grpItvlSecFloat)
+	return
+}
+
+func (tc *overlappingEvaluations) ExpectedAlerts() []ExpectedAlert {
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	_12th := 12 * int64(tc.rwInterval/time.Millisecond) // Firing.
+	_32nd := 32 * int64(tc.rwInterval/time.Millisecond) // Resolved.
+	_32ndPlus15m := _32nd + int64(ResolvedRetention/time.Millisecond)
+	for ts := _12th; ts < _32nd; ts += resendDelayMs {
+		addAlert(ExpectedAlert{
+			TimeTolerance: tc.groupInterval,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      false,
+			Resend:        ts != _12th,
+			NextState:     timestamp.Time(tc.zeroTime + _32nd),
+			ResolvedTime:  timestamp.Time(tc.zeroTime + _32nd),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "SimpleAlert is firing"),
+				StartsAt:    timestamp.Time(tc.zeroTime + _12th),
+			},
+		})
+	}
+	for ts := _32nd; ts < _32ndPlus15m; ts += resendDelayMs {
+		tolerance := tc.groupInterval
+		if ts == _32nd {
+			// Since the alert state is reset, the alert sent time for resolved alert can be upto
+			// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+			// account for this delay plus the usual tolerance.
+			tolerance = 2 * tc.groupInterval
+		}
+		addAlert(ExpectedAlert{
+			TimeTolerance: tolerance,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      true,
+			Resend:        ts != _32nd,
+			ResolvedTime:  timestamp.Time(tc.zeroTime + _32nd),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "SimpleAlert is firing"),
+				StartsAt:    timestamp.Time(tc.zeroTime + _12th),
+			},
+		})
+	}
+
+	return exp
+}
@@ -370,7 +370,7 @@ func (tc *pendingAndFiringAndResolved) ExpectedAlerts() []ExpectedAlert {
 	_89th := 89 * int64(tc.rwInterval/time.Millisecond)   // Pending again.
 	_113th := 113 * int64(tc.rwInterval/time.Millisecond) // Firing again.
 	_134th := 134 * int64(tc.rwInterval/time.Millisecond) // Resolved again.
-	_134thPlus15m := _134th + int64(15*time.Minute/time.Millisecond)
+	_134thPlus15m := _134th + int64(ResolvedRetention/time.Millisecond)
 
 	var exp []ExpectedAlert
 	endsAtDelta := 4 * ResendDelay
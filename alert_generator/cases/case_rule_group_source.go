@@ -0,0 +1,332 @@
+package cases
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// RuleGroupSource tests the following cases:
+// * The rule group in the rules API having the name and interval of the configuration, and
+//   the optional 'file' field, if set, not changing between evaluations.
+// * Query result that keeps the metric name not leaking the metric name or any other internal
+//   label starting with "__" into the alerts, both in the alerts sent and in the APIs.
+func RuleGroupSource() TestCase {
+	groupName := "RuleGroupSource"
+	alertName := groupName + "_Rule"
+	lbls := metricLabels(groupName, alertName)
+	return &ruleGroupSource{
+		groupName: groupName,
+		alertName: alertName,
+		// The 'and' keeps the labels of the left hand side, including the metric name.
+		query:         fmt.Sprintf("%s and %s > 10", lbls.String(), lbls.String()),
+		metricLabels:  lbls,
+		rwInterval:    15 * time.Second,
+		groupInterval: 30 * time.Second,
+	}
+}
+
+type ruleGroupSource struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	rwInterval, groupInterval time.Duration
+	totalSamples              int
+
+	zeroTime int64
+
+	// fileMtx protects file, which is the 'file' field of the first rule group seen in the rules API.
+	fileMtx sync.Mutex
+	file    string
+}
+
+func (tc *ruleGroupSource) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) The rule group in the rules API having the name and interval of the configuration, and the optional 'file' field, if set, not changing between evaluations. " +
+			"(2) Query result that keeps the metric name not leaking the metric name or any other internal label starting with \"__\" into the alerts, both in the alerts sent and in the APIs."
+}
+
+func (tc *ruleGroupSource) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	var expr yaml.Node
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				Labels:      map[string]string{"rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "SimpleAlert is firing"},
+			},
+		},
+	}, nil
+}
+
+func (tc *ruleGroupSource) SamplesToRemoteWrite() []prompb.TimeSeries {
+	samples := sampleSlice(tc.rwInterval,
+		// All comment times is assuming 15s interval.
+		"3", "5", "0x2", "9", // 1m (3 is @0 time).
+		"0x3", "11", // 1m block. Gets into firing at value 11@2m.
+		"0x15", // 4m of firing.
+		// Resolved. 5m more of 9s.
+		"9", "0x20",
+	)
+	tc.totalSamples = len(samples)
+	return []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(tc.metricLabels),
+			Samples: samples,
+		},
+	}
+}
+
+func (tc *ruleGroupSource) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *ruleGroupSource) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *ruleGroupSource) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	for _, a := range alerts {
+		if err := checkNoInternalLabels(a.Labels); err != nil {
+			return errors.Wrapf(err, "alert %v", a)
+		}
+	}
+	expAlerts := tc.expAlerts(ts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *ruleGroupSource) CheckRuleGroup(ts int64, rg *v1.RuleGroup) error {
+	if ts-tc.zeroTime < 2*int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	if err := tc.checkFile(rg.File); err != nil {
+		return err
+	}
+	for _, r := range rg.Rules {
+		ar, ok := r.(v1.AlertingRule)
+		if !ok {
+			continue
+		}
+		for _, a := range ar.Alerts {
+			if err := checkNoInternalLabels(a.Labels); err != nil {
+				return errors.Wrapf(err, "alert %v of rule %q", *a, ar.Name)
+			}
+		}
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg)
+}
+
+// checkFile checks that the 'file' field of the rule group, which is optional, does not change
+// once it has been seen.
+func (tc *ruleGroupSource) checkFile(file string) error {
+	tc.fileMtx.Lock()
+	defer tc.fileMtx.Unlock()
+	if tc.file == "" {
+		tc.file = file
+		return nil
+	}
+	if file != tc.file {
+		return errors.Errorf("the 'file' field of the rule group changed from %q to %q", tc.file, file)
+	}
+	return nil
+}
+
+// checkNoInternalLabels returns an error if any of the labels is an internal label, i.e. starts with "__".
+func checkNoInternalLabels(lbls labels.Labels) error {
+	for _, l := range lbls {
+		if strings.HasPrefix(l.Name, "__") {
+			return errors.Errorf("internal label %s=%q found in alert labels", l.Name, l.Value)
+		}
+	}
+	return nil
+}
+
+func (tc *ruleGroupSource) alertLabels() labels.Labels {
+	return labels.FromStrings("alertname", tc.alertName, "rulegroup", tc.groupName)
+}
+
+func (tc *ruleGroupSource) firingAlert() v1.Alert {
+	activeAt := timestamp.Time(tc.zeroTime + int64(8*tc.rwInterval/time.Millisecond))
+	return v1.Alert{
+		Labels:      tc.alertLabels(),
+		Annotations: labels.FromStrings("description", "SimpleAlert is firing"),
+		State:       "firing",
+		Value:       "11",
+		ActiveAt:    &activeAt,
+	}
+}
+
+func (tc *ruleGroupSource) expAlerts(ts int64) (expAlerts [][]v1.Alert) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBeFiring := tc.allPossibleStates(relTs)
+
+	if canBeInactive {
+		expAlerts = append(expAlerts, []v1.Alert{})
+	}
+	if canBeFiring {
+		expAlerts = append(expAlerts, []v1.Alert{tc.firingAlert()})
+	}
+
+	return expAlerts
+}
+
+func (tc *ruleGroupSource) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBeFiring := tc.allPossibleStates(relTs)
+
+	getRg := func(state string, alerts []*v1.Alert) v1.RuleGroup {
+		return v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.AlertingRule{
+					State:       state,
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Labels:      labels.FromStrings("rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", "SimpleAlert is firing"),
+					Alerts:      alerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		}
+	}
+
+	if canBeInactive {
+		expRgs = append(expRgs, getRg("inactive", nil))
+	}
+	if canBeFiring {
+		a := tc.firingAlert()
+		expRgs = append(expRgs, getRg("firing", []*v1.Alert{&a}))
+	}
+
+	return expRgs
+}
+
+func (tc *ruleGroupSource) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBeFiring := tc.allPossibleStates(relTs)
+
+	if canBeInactive {
+		expSamples = append(expSamples, nil)
+	}
+	if canBeFiring {
+		expSamples = append(expSamples, []promql.Sample{
+			{
+				Point:  promql.Point{T: ts / 1000, V: 1},
+				Metric: labels.FromStrings("__name__", "ALERTS", "alertstate", "firing", "alertname", tc.alertName, "rulegroup", tc.groupName),
+			},
+		})
+	}
+
+	return expSamples
+}
+
+func (tc *ruleGroupSource) CheckMetrics(ts int64, samples []promql.Sample) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(expSamples, samples)
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *ruleGroupSource) allPossibleStates(ts int64) (canBeInactive, canBeFiring bool) {
+	between := betweenFunc(ts)
+
+	rwItvlSecFloat, grpItvlSecFloat := float64(tc.rwInterval/time.Second), float64(tc.groupInterval/time.Second)
+	_8th := 8 * rwItvlSecFloat   // Goes into firing.
+	_24th := 24 * rwItvlSecFloat // Resolved.
+	canBeInactive = between(0, _8th+grpItvlSecFloat) || between(_24th, 240*rwItvlSecFloat)
+	canBeFiring = between(_8th-1, _24th+grpItvlSecFloat)
+	return
+}
+
+func (tc *ruleGroupSource) ExpectedAlerts() []ExpectedAlert {
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	// The alerts sent are matched on the exact labels, hence any leaked internal label makes
+	// them unexpected alerts.
+	_8th := 8 * int64(tc.rwInterval/time.Millisecond)   // Firing.
+	_24th := 24 * int64(tc.rwInterval/time.Millisecond) // Resolved.
+	_24thPlus15m := _24th + int64(ResolvedRetention/time.Millisecond)
+	for ts := _8th; ts < _24th; ts += resendDelayMs {
+		addAlert(ExpectedAlert{
+			TimeTolerance: tc.groupInterval,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      false,
+			Resend:        ts != _8th,
+			NextState:     timestamp.Time(tc.zeroTime + _24th),
+			ResolvedTime:  timestamp.Time(tc.zeroTime + _24th),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      tc.alertLabels(),
+				Annotations: labels.FromStrings("description", "SimpleAlert is firing"),
+				StartsAt:    timestamp.Time(tc.zeroTime + _8th),
+			},
+		})
+	}
+	for ts := _24th; ts < _24thPlus15m; ts += resendDelayMs {
+		tolerance := tc.groupInterval
+		if ts == _24th {
+			// Since the alert state is reset, the alert sent time for resolved alert can be upto
+			// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+			// account for this delay plus the usual tolerance.
+			tolerance = 2 * tc.groupInterval
+		}
+		addAlert(ExpectedAlert{
+			TimeTolerance: tolerance,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      true,
+			Resend:        ts != _24th,
+			ResolvedTime:  timestamp.Time(tc.zeroTime + _24th),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      tc.alertLabels(),
+				Annotations: labels.FromStrings("description", "SimpleAlert is firing"),
+				StartsAt:    timestamp.Time(tc.zeroTime + _8th),
+			},
+		})
+	}
+
+	return exp
+}
@@ -0,0 +1,326 @@
+package cases
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// SimultaneousAlerts tests the following cases:
+// * Multiple alerts from the same rule that go from pending->firing->inactive at the same instant,
+//   hence are sent together in the same requests in any order.
+// * Each alert is matched with its expected alert irrespective of its position in the received payload.
+func SimultaneousAlerts() TestCase {
+	groupName := "SimultaneousAlerts"
+	alertName := groupName + "_SimpleAlert"
+	lbls := metricLabels(groupName, alertName)
+	tc := &simultaneousAlerts{
+		groupName:     groupName,
+		alertName:     alertName,
+		query:         fmt.Sprintf("%s > 10", lbls.String()),
+		metricLabels:  lbls,
+		variants:      []string{"one", "two", "three"},
+		rwInterval:    15 * time.Second,
+		groupInterval: 30 * time.Second,
+	}
+	tc.forDuration = model.Duration(12 * tc.rwInterval) // 3m with 15s rw interval.
+	return tc
+}
+
+type simultaneousAlerts struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	variants                  []string
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+	totalSamples              int
+
+	zeroTime int64
+}
+
+func (tc *simultaneousAlerts) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) Multiple alerts from the same rule that go from pending->firing->inactive at the same instant, hence are sent together in the same requests in any order. " +
+			"(2) Each alert is matched with its expected alert irrespective of its position in the received payload."
+}
+
+func (tc *simultaneousAlerts) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	var expr yaml.Node
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "SimpleAlert is firing for {{$labels.variant}}"},
+			},
+		},
+	}, nil
+}
+
+func (tc *simultaneousAlerts) SamplesToRemoteWrite() []prompb.TimeSeries {
+	var series []prompb.TimeSeries
+	for _, variant := range tc.variants {
+		lbls := append(tc.metricLabels.Copy(), labels.Label{Name: "variant", Value: variant})
+		sort.Sort(lbls)
+		// All the series have the same samples so that their alerts change state at the same time.
+		samples := sampleSlice(tc.rwInterval,
+			// All comment times is assuming 15s interval.
+			"1", "0x7", // 2m of inactive.
+			"11", // Pending @2m.
+			// 8m more of this. Goes into firing here.
+			"0x31",
+			// Resolved now.
+			"9", "0x20",
+		)
+		tc.totalSamples = len(samples)
+		series = append(series, prompb.TimeSeries{
+			Labels:  toProtoLabels(lbls),
+			Samples: samples,
+		})
+	}
+	return series
+}
+
+func (tc *simultaneousAlerts) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *simultaneousAlerts) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *simultaneousAlerts) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *simultaneousAlerts) CheckRuleGroup(ts int64, rg *v1.RuleGroup) error {
+	if ts-tc.zeroTime < 2*int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg)
+}
+
+func (tc *simultaneousAlerts) CheckMetrics(ts int64, samples []promql.Sample) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(expSamples, samples)
+}
+
+func (tc *simultaneousAlerts) alertLabels(variant string) labels.Labels {
+	return labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName, "variant", variant)
+}
+
+func (tc *simultaneousAlerts) alertAnnotations(variant string) labels.Labels {
+	return labels.FromStrings("description", "SimpleAlert is firing for "+variant)
+}
+
+// alerts returns the alerts of all the variants in the given state.
+func (tc *simultaneousAlerts) alerts(state string) []v1.Alert {
+	activeAt := timestamp.Time(tc.zeroTime + int64(8*tc.rwInterval/time.Millisecond))
+	var alerts []v1.Alert
+	for _, variant := range tc.variants {
+		alerts = append(alerts, v1.Alert{
+			Labels:      tc.alertLabels(variant),
+			Annotations: tc.alertAnnotations(variant),
+			State:       state,
+			Value:       "11",
+			ActiveAt:    &activeAt,
+		})
+	}
+	return alerts
+}
+
+func (tc *simultaneousAlerts) expAlerts(ts int64) (expAlerts [][]v1.Alert) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(relTs)
+
+	if canBeInactive {
+		expAlerts = append(expAlerts, []v1.Alert{})
+	}
+	if canBePending {
+		expAlerts = append(expAlerts, tc.alerts("pending"))
+	}
+	if canBeFiring {
+		expAlerts = append(expAlerts, tc.alerts("firing"))
+	}
+
+	return expAlerts
+}
+
+func (tc *simultaneousAlerts) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(relTs)
+
+	getRg := func(state string, alerts []v1.Alert) v1.RuleGroup {
+		var ruleAlerts []*v1.Alert
+		for i := range alerts {
+			ruleAlerts = append(ruleAlerts, &alerts[i])
+		}
+		return v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.AlertingRule{
+					State:       state,
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+					Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", "SimpleAlert is firing for {{$labels.variant}}"),
+					Alerts:      ruleAlerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		}
+	}
+
+	if canBeInactive {
+		expRgs = append(expRgs, getRg("inactive", nil))
+	}
+	if canBePending {
+		expRgs = append(expRgs, getRg("pending", tc.alerts("pending")))
+	}
+	if canBeFiring {
+		expRgs = append(expRgs, getRg("firing", tc.alerts("firing")))
+	}
+
+	return expRgs
+}
+
+func (tc *simultaneousAlerts) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(relTs)
+
+	getSamples := func(state string) []promql.Sample {
+		var samples []promql.Sample
+		for _, variant := range tc.variants {
+			samples = append(samples, promql.Sample{
+				Point:  promql.Point{T: ts / 1000, V: 1},
+				Metric: labels.FromStrings("__name__", "ALERTS", "alertstate", state, "alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName, "variant", variant),
+			})
+		}
+		return samples
+	}
+
+	if canBeInactive {
+		expSamples = append(expSamples, nil)
+	}
+	if canBePending {
+		expSamples = append(expSamples, getSamples("pending"))
+	}
+	if canBeFiring {
+		expSamples = append(expSamples, getSamples("firing"))
+	}
+
+	return expSamples
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *simultaneousAlerts) allPossibleStates(ts int64) (canBeInactive, canBePending, canBeFiring bool) {
+	between := betweenFunc(ts)
+
+	rwItvlSecFloat, grpItvlSecFloat := float64(tc.rwInterval/time.Second), float64(tc.groupInterval/time.Second)
+	_8th := 8 * rwItvlSecFloat   // Goes into pending.
+	_20th := 20 * rwItvlSecFloat // Goes into firing.
+	_40th := 40 * rwItvlSecFloat // Resolved.
+	canBeInactive = between(0, _8th+grpItvlSecFloat) || between(_40th, 240*rwItvlSecFloat)
+	canBePending = between(_8th-1, _20th+grpItvlSecFloat)
+	canBeFiring = between(_20th-1, _40th+grpItvlSecFloat)
+	return
+}
+
+func (tc *simultaneousAlerts) ExpectedAlerts() []ExpectedAlert {
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	// All the alerts are expected at the same time, so they are expected in the same requests.
+	_20th := 20 * int64(tc.rwInterval/time.Millisecond) // Firing.
+	_40th := 40 * int64(tc.rwInterval/time.Millisecond) // Resolved.
+	_40thPlus15m := _40th + int64(ResolvedRetention/time.Millisecond)
+	for ts := _20th; ts < _40th; ts += resendDelayMs {
+		for _, variant := range tc.variants {
+			addAlert(ExpectedAlert{
+				TimeTolerance: tc.groupInterval,
+				Ts:            timestamp.Time(tc.zeroTime + ts),
+				Resolved:      false,
+				Resend:        ts != _20th,
+				NextState:     timestamp.Time(tc.zeroTime + _40th),
+				ResolvedTime:  timestamp.Time(tc.zeroTime + _40th),
+				EndsAtDelta:   endsAtDelta,
+				Alert: &notifier.Alert{
+					Labels:      tc.alertLabels(variant),
+					Annotations: tc.alertAnnotations(variant),
+					StartsAt:    timestamp.Time(tc.zeroTime + _20th),
+				},
+			})
+		}
+	}
+	for ts := _40th; ts < _40thPlus15m; ts += resendDelayMs {
+		tolerance := tc.groupInterval
+		if ts == _40th {
+			// Since the alert state is reset, the alert sent time for resolved alert can be upto
+			// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+			// account for this delay plus the usual tolerance.
+			tolerance = 2 * tc.groupInterval
+		}
+		for _, variant := range tc.variants {
+			addAlert(ExpectedAlert{
+				TimeTolerance: tolerance,
+				Ts:            timestamp.Time(tc.zeroTime + ts),
+				Resolved:      true,
+				Resend:        ts != _40th,
+				ResolvedTime:  timestamp.Time(tc.zeroTime + _40th),
+				EndsAtDelta:   endsAtDelta,
+				Alert: &notifier.Alert{
+					Labels:      tc.alertLabels(variant),
+					Annotations: tc.alertAnnotations(variant),
+					StartsAt:    timestamp.Time(tc.zeroTime + _20th),
+				},
+			})
+		}
+	}
+
+	return exp
+}
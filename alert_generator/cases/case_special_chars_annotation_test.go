@@ -0,0 +1,45 @@
+package cases
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/template"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestSpecialCharsAnnotation(t *testing.T) {
+	tc := SpecialCharsAnnotation().(*specialCharsAnnotation)
+	exp := tc.alertAnnotations().Get("description")
+
+	// The rule group survives the rules file.
+	rg, err := tc.RuleGroup()
+	require.NoError(t, err)
+	b, err := yaml.Marshal(rulefmt.RuleGroups{Groups: []rulefmt.RuleGroup{rg}})
+	require.NoError(t, err)
+	rgs, errs := rulefmt.Parse(b)
+	require.Empty(t, errs)
+	tmpl := rgs.Groups[0].Rules[0].Annotations["description"]
+	require.Equal(t, specialCharsAnnotationTemplate, tmpl)
+
+	// The template expands to the expected annotation, the same way the rule manager expands it.
+	defs := "{{$labels := .Labels}}{{$externalLabels := .ExternalLabels}}{{$externalURL := .ExternalURL}}{{$value := .Value}}"
+	data := template.AlertTemplateData(map[string]string{"rulegroup": tc.groupName}, nil, "", 11)
+	expander := template.NewTemplateExpander(context.Background(), defs+tmpl, "__alert_"+tc.alertName, data, 0, nil, nil, nil)
+	got, err := expander.Expand()
+	require.NoError(t, err)
+	require.Equal(t, exp, got)
+	require.True(t, strings.HasSuffix(got, "Line 4: from the \"template\"\\path\n"+tc.groupName), got)
+
+	// The annotation survives the JSON of the sent alerts.
+	b, err = json.Marshal([]notifier.Alert{{Labels: tc.alertLabels(), Annotations: tc.alertAnnotations()}})
+	require.NoError(t, err)
+	var alerts []notifier.Alert
+	require.NoError(t, json.Unmarshal(b, &alerts))
+	require.Equal(t, exp, alerts[0].Annotations.Get("description"))
+}
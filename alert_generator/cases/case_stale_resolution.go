@@ -0,0 +1,321 @@
+package cases
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// StaleResolution tests the following cases:
+// * An alert getting resolved because the value of its series drops below the threshold and an
+//   identical alert getting resolved because its series gets a stale marker at the same time,
+//   both getting resolved at the same evaluation.
+// * Both resolved alerts being sent with the same EndsAt.
+func StaleResolution() TestCase {
+	groupName := "StaleResolution"
+	alertName := groupName + "_SimpleAlert"
+	lbls := metricLabels(groupName, alertName)
+	return &staleResolution{
+		groupName:     groupName,
+		alertName:     alertName,
+		query:         fmt.Sprintf("%s > 10", lbls.String()),
+		metricLabels:  lbls,
+		rwInterval:    15 * time.Second,
+		groupInterval: 30 * time.Second,
+	}
+}
+
+type staleResolution struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	rwInterval, groupInterval time.Duration
+	totalSamples              int
+
+	zeroTime int64
+}
+
+// The values of the "resolution" label of the series, which tell how the alert of the series gets resolved.
+const (
+	resolutionByValue = "value"
+	resolutionByStale = "stale"
+)
+
+func (tc *staleResolution) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) An alert getting resolved because the value of its series drops below the threshold and an identical alert getting resolved because its series gets a stale marker at the same time, both getting resolved at the same evaluation. " +
+			"(2) Both resolved alerts being sent with the same EndsAt."
+}
+
+func (tc *staleResolution) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	var expr yaml.Node
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				Labels:      map[string]string{"rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "SimpleAlert is firing, resolved by {{$labels.resolution}}"},
+			},
+		},
+	}, nil
+}
+
+func (tc *staleResolution) SamplesToRemoteWrite() []prompb.TimeSeries {
+	firing := []string{
+		// All comment times is assuming 15s interval.
+		"3", "5", "0x2", "9", // 1m (3 is @0 time).
+		"0x3", "11", // 1m block. Gets into firing at value 11@2m.
+		"0x15", // 4m of firing.
+	}
+	// Resolved by the value. 5m more of 9s.
+	valueSamples := sampleSlice(tc.rwInterval, append(firing, "9", "0x20")...)
+	tc.totalSamples = len(valueSamples)
+
+	// Resolved by a stale marker at the same time, after which the series has no samples.
+	staleSamples := sampleSlice(tc.rwInterval, firing...)
+	staleSamples = append(staleSamples, prompb.Sample{
+		Timestamp: int64(len(staleSamples)) * int64(tc.rwInterval/time.Millisecond),
+		Value:     math.Float64frombits(value.StaleNaN),
+	})
+
+	series := func(resolution string, samples []prompb.Sample) prompb.TimeSeries {
+		lbls := append(tc.metricLabels.Copy(), labels.Label{Name: "resolution", Value: resolution})
+		sort.Sort(lbls)
+		return prompb.TimeSeries{
+			Labels:  toProtoLabels(lbls),
+			Samples: samples,
+		}
+	}
+	return []prompb.TimeSeries{
+		series(resolutionByValue, valueSamples),
+		series(resolutionByStale, staleSamples),
+	}
+}
+
+func (tc *staleResolution) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *staleResolution) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *staleResolution) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *staleResolution) CheckRuleGroup(ts int64, rg *v1.RuleGroup) error {
+	if ts-tc.zeroTime < 2*int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg)
+}
+
+func (tc *staleResolution) CheckMetrics(ts int64, samples []promql.Sample) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(expSamples, samples)
+}
+
+func (tc *staleResolution) alertLabels(resolution string) labels.Labels {
+	return labels.FromStrings("alertname", tc.alertName, "resolution", resolution, "rulegroup", tc.groupName)
+}
+
+func (tc *staleResolution) alertAnnotations(resolution string) labels.Labels {
+	return labels.FromStrings("description", "SimpleAlert is firing, resolved by "+resolution)
+}
+
+// firingAlerts returns the firing alerts of both the series.
+func (tc *staleResolution) firingAlerts() []v1.Alert {
+	activeAt := timestamp.Time(tc.zeroTime + int64(8*tc.rwInterval/time.Millisecond))
+	var alerts []v1.Alert
+	for _, resolution := range []string{resolutionByValue, resolutionByStale} {
+		alerts = append(alerts, v1.Alert{
+			Labels:      tc.alertLabels(resolution),
+			Annotations: tc.alertAnnotations(resolution),
+			State:       "firing",
+			Value:       "11",
+			ActiveAt:    &activeAt,
+		})
+	}
+	return alerts
+}
+
+func (tc *staleResolution) expAlerts(ts int64) (expAlerts [][]v1.Alert) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBeFiring := tc.allPossibleStates(relTs)
+
+	if canBeInactive {
+		expAlerts = append(expAlerts, []v1.Alert{})
+	}
+	if canBeFiring {
+		expAlerts = append(expAlerts, tc.firingAlerts())
+	}
+
+	return expAlerts
+}
+
+func (tc *staleResolution) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBeFiring := tc.allPossibleStates(relTs)
+
+	getRg := func(state string, alerts []v1.Alert) v1.RuleGroup {
+		var ruleAlerts []*v1.Alert
+		for i := range alerts {
+			ruleAlerts = append(ruleAlerts, &alerts[i])
+		}
+		return v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.AlertingRule{
+					State:       state,
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Labels:      labels.FromStrings("rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", "SimpleAlert is firing, resolved by {{$labels.resolution}}"),
+					Alerts:      ruleAlerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		}
+	}
+
+	if canBeInactive {
+		expRgs = append(expRgs, getRg("inactive", nil))
+	}
+	if canBeFiring {
+		expRgs = append(expRgs, getRg("firing", tc.firingAlerts()))
+	}
+
+	return expRgs
+}
+
+func (tc *staleResolution) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBeFiring := tc.allPossibleStates(relTs)
+
+	if canBeInactive {
+		expSamples = append(expSamples, nil)
+	}
+	if canBeFiring {
+		var samples []promql.Sample
+		for _, resolution := range []string{resolutionByValue, resolutionByStale} {
+			samples = append(samples, promql.Sample{
+				Point:  promql.Point{T: ts / 1000, V: 1},
+				Metric: labels.FromStrings("__name__", "ALERTS", "alertstate", "firing", "alertname", tc.alertName, "resolution", resolution, "rulegroup", tc.groupName),
+			})
+		}
+		expSamples = append(expSamples, samples)
+	}
+
+	return expSamples
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *staleResolution) allPossibleStates(ts int64) (canBeInactive, canBeFiring bool) {
+	between := betweenFunc(ts)
+
+	rwItvlSecFloat, grpItvlSecFloat := float64(tc.rwInterval/time.Second), float64(tc.groupInterval/time.Second)
+	_8th := 8 * rwItvlSecFloat   // Goes into firing.
+	_24th := 24 * rwItvlSecFloat // Resolved, by the value and by the stale marker.
+	canBeInactive = between(0, _8th+grpItvlSecFloat) || between(_24th, 240*rwItvlSecFloat)
+	canBeFiring = between(_8th-1, _24th+grpItvlSecFloat)
+	return
+}
+
+func (tc *staleResolution) ExpectedAlerts() []ExpectedAlert {
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	// Both the alerts have the same resolved time, hence are expected with the same EndsAt.
+	_8th := 8 * int64(tc.rwInterval/time.Millisecond)   // Firing.
+	_24th := 24 * int64(tc.rwInterval/time.Millisecond) // Resolved.
+	_24thPlus15m := _24th + int64(ResolvedRetention/time.Millisecond)
+	for ts := _8th; ts < _24th; ts += resendDelayMs {
+		for _, resolution := range []string{resolutionByValue, resolutionByStale} {
+			addAlert(ExpectedAlert{
+				TimeTolerance: tc.groupInterval,
+				Ts:            timestamp.Time(tc.zeroTime + ts),
+				Resolved:      false,
+				Resend:        ts != _8th,
+				NextState:     timestamp.Time(tc.zeroTime + _24th),
+				ResolvedTime:  timestamp.Time(tc.zeroTime + _24th),
+				EndsAtDelta:   endsAtDelta,
+				Alert: &notifier.Alert{
+					Labels:      tc.alertLabels(resolution),
+					Annotations: tc.alertAnnotations(resolution),
+					StartsAt:    timestamp.Time(tc.zeroTime + _8th),
+				},
+			})
+		}
+	}
+	for ts := _24th; ts < _24thPlus15m; ts += resendDelayMs {
+		tolerance := tc.groupInterval
+		if ts == _24th {
+			// Since the alert state is reset, the alert sent time for resolved alert can be upto
+			// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+			// account for this delay plus the usual tolerance.
+			tolerance = 2 * tc.groupInterval
+		}
+		for _, resolution := range []string{resolutionByValue, resolutionByStale} {
+			addAlert(ExpectedAlert{
+				TimeTolerance: tolerance,
+				Ts:            timestamp.Time(tc.zeroTime + ts),
+				Resolved:      true,
+				Resend:        ts != _24th,
+				ResolvedTime:  timestamp.Time(tc.zeroTime + _24th),
+				EndsAtDelta:   endsAtDelta,
+				Alert: &notifier.Alert{
+					Labels:      tc.alertLabels(resolution),
+					Annotations: tc.alertAnnotations(resolution),
+					StartsAt:    timestamp.Time(tc.zeroTime + _8th),
+				},
+			})
+		}
+	}
+
+	return exp
+}
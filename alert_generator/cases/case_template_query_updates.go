@@ -0,0 +1,337 @@
+package cases
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// TemplateQueryUpdates tests the following cases:
+// * Annotation using the 'query' template function being re-evaluated on every evaluation
+//   while the value of the alert itself stays the same.
+// * firing alert being re-sent with the updated annotation contents from the template query.
+// * inactive alert being sent with the last annotation contents from the template query.
+func TemplateQueryUpdates() TestCase {
+	groupName := "TemplateQueryUpdates"
+	alertName := groupName + "_SimpleAlert"
+	lbls := metricLabels(groupName, alertName)
+	tc := &templateQueryUpdates{
+		groupName:     groupName,
+		alertName:     alertName,
+		query:         fmt.Sprintf("%s > 0", lbls.String()),
+		metricLabels:  lbls,
+		rwInterval:    15 * time.Second,
+		groupInterval: 30 * time.Second,
+	}
+	tc.templateQueryLabels = labels.FromStrings(
+		"__name__", SourceTimeSeriesName,
+		"rulegroup", groupName,
+		"series", "template",
+	)
+	tc.annotation = fmt.Sprintf(`The template query returned {{ with query "%s{rulegroup='%s',series='template'}" }}{{ . | first | value }}{{ end }}`,
+		SourceTimeSeriesName, groupName,
+	)
+	tc.forDuration = model.Duration(4 * tc.rwInterval)
+	return tc
+}
+
+type templateQueryUpdates struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	annotation                string
+	metricLabels              labels.Labels
+	templateQueryLabels       labels.Labels
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+	totalSamples              int
+
+	zeroTime int64
+}
+
+func (tc *templateQueryUpdates) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) Annotation using the 'query' template function being re-evaluated on every evaluation while the value of the alert itself stays the same. " +
+			"(2) firing alert being re-sent with the updated annotation contents from the template query. " +
+			"(3) inactive alert being sent with the last annotation contents from the template query."
+}
+
+func (tc *templateQueryUpdates) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	var expr yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": tc.annotation},
+			},
+		},
+	}, nil
+}
+
+func (tc *templateQueryUpdates) SamplesToRemoteWrite() []prompb.TimeSeries {
+	samples := sampleSlice(tc.rwInterval,
+		// All comment times is assuming 15s interval.
+		"5", "0x39", // 10m of the same value. Pending @0, firing @1m.
+		"0", "0x59", // Resolved @10m. 15m of this to see the resolved alerts.
+	)
+	tc.totalSamples = len(samples)
+	return []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(tc.metricLabels),
+			Samples: samples,
+		},
+		{
+			// The series used by the template query.
+			Labels: toProtoLabels(tc.templateQueryLabels),
+			Samples: sampleSlice(tc.rwInterval,
+				"1", "0x11", // 3m. Pending and firing with 1.
+				"2", "0x11", // 3m. Firing with 2.
+				"3", "0x83", // Firing with 3 till the end, also the last value of the resolved alert.
+			),
+		},
+	}
+}
+
+func (tc *templateQueryUpdates) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *templateQueryUpdates) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *templateQueryUpdates) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *templateQueryUpdates) CheckRuleGroup(ts int64, rg *v1.RuleGroup) error {
+	if ts-tc.zeroTime < 2*int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg)
+}
+
+func (tc *templateQueryUpdates) CheckMetrics(ts int64, samples []promql.Sample) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(expSamples, samples)
+}
+
+// alert returns the alert in the given state with the given result of the template query.
+func (tc *templateQueryUpdates) alert(state, queryResult string) v1.Alert {
+	activeAt := timestamp.Time(tc.zeroTime)
+	return v1.Alert{
+		Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+		Annotations: labels.FromStrings("description", "The template query returned "+queryResult),
+		State:       state,
+		Value:       "5",
+		ActiveAt:    &activeAt,
+	}
+}
+
+func (tc *templateQueryUpdates) expAlerts(ts int64) (expAlerts [][]v1.Alert) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending, canBeFiring1, canBeFiring2, canBeFiring3 := tc.allPossibleStates(relTs)
+
+	if canBeInactive {
+		expAlerts = append(expAlerts, []v1.Alert{})
+	}
+	if canBePending {
+		expAlerts = append(expAlerts, []v1.Alert{tc.alert("pending", "1")})
+	}
+	if canBeFiring1 {
+		expAlerts = append(expAlerts, []v1.Alert{tc.alert("firing", "1")})
+	}
+	if canBeFiring2 {
+		expAlerts = append(expAlerts, []v1.Alert{tc.alert("firing", "2")})
+	}
+	if canBeFiring3 {
+		expAlerts = append(expAlerts, []v1.Alert{tc.alert("firing", "3")})
+	}
+
+	return expAlerts
+}
+
+func (tc *templateQueryUpdates) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending, canBeFiring1, canBeFiring2, canBeFiring3 := tc.allPossibleStates(relTs)
+
+	getRg := func(state string, alerts []*v1.Alert) v1.RuleGroup {
+		return v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.AlertingRule{
+					State:       state,
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+					Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", tc.annotation),
+					Alerts:      alerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		}
+	}
+
+	if canBeInactive {
+		expRgs = append(expRgs, getRg("inactive", nil))
+	}
+	if canBePending {
+		a := tc.alert("pending", "1")
+		expRgs = append(expRgs, getRg("pending", []*v1.Alert{&a}))
+	}
+	for _, f := range []struct {
+		canBe       bool
+		queryResult string
+	}{{canBeFiring1, "1"}, {canBeFiring2, "2"}, {canBeFiring3, "3"}} {
+		if f.canBe {
+			a := tc.alert("firing", f.queryResult)
+			expRgs = append(expRgs, getRg("firing", []*v1.Alert{&a}))
+		}
+	}
+
+	return expRgs
+}
+
+func (tc *templateQueryUpdates) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending, canBeFiring1, canBeFiring2, canBeFiring3 := tc.allPossibleStates(relTs)
+
+	if canBeInactive {
+		expSamples = append(expSamples, nil)
+	}
+	if canBePending {
+		expSamples = append(expSamples, []promql.Sample{
+			{
+				Point:  promql.Point{T: ts / 1000, V: 1},
+				Metric: labels.FromStrings("__name__", "ALERTS", "alertstate", "pending", "alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+			},
+		})
+	}
+	if canBeFiring1 || canBeFiring2 || canBeFiring3 {
+		expSamples = append(expSamples, []promql.Sample{
+			{
+				Point:  promql.Point{T: ts / 1000, V: 1},
+				Metric: labels.FromStrings("__name__", "ALERTS", "alertstate", "firing", "alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+			},
+		})
+	}
+
+	return expSamples
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *templateQueryUpdates) allPossibleStates(ts int64) (canBeInactive, canBePending, canBeFiring1, canBeFiring2, canBeFiring3 bool) {
+	between := betweenFunc(ts)
+
+	rwItvlSecFloat, grpItvlSecFloat := float64(tc.rwInterval/time.Second), float64(tc.groupInterval/time.Second)
+	_4th := 4 * rwItvlSecFloat   // Goes into firing.
+	_12th := 12 * rwItvlSecFloat // Template query result changes to 2.
+	_24th := 24 * rwItvlSecFloat // Template query result changes to 3.
+	_40th := 40 * rwItvlSecFloat // Resolved.
+	canBeInactive = between(0, grpItvlSecFloat) || between(_40th, 240*rwItvlSecFloat)
+	canBePending = between(0, _4th+grpItvlSecFloat)
+	canBeFiring1 = between(_4th-1, _12th+grpItvlSecFloat)
+	canBeFiring2 = between(_12th-1, _24th+grpItvlSecFloat)
+	canBeFiring3 = between(_24th-1, _40th+grpItvlSecFloat)
+	return
+}
+
+func (tc *templateQueryUpdates) ExpectedAlerts() []ExpectedAlert {
+	_4th := 4 * int64(tc.rwInterval/time.Millisecond)   // Firing.
+	_12th := 12 * int64(tc.rwInterval/time.Millisecond) // Template query result changes to 2.
+	_24th := 24 * int64(tc.rwInterval/time.Millisecond) // Template query result changes to 3.
+	_40th := 40 * int64(tc.rwInterval/time.Millisecond) // Resolved.
+	_40thPlus15m := _40th + int64(ResolvedRetention/time.Millisecond)
+
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+	for _, f := range []struct {
+		from, to    int64
+		queryResult string
+	}{{_4th, _12th, "1"}, {_12th, _24th, "2"}, {_24th, _40th, "3"}} {
+		for ts := f.from; ts < f.to; ts += resendDelayMs {
+			addAlert(ExpectedAlert{
+				TimeTolerance: tc.groupInterval,
+				Ts:            timestamp.Time(tc.zeroTime + ts),
+				Resolved:      false,
+				Resend:        ts != _4th,
+				NextState:     timestamp.Time(tc.zeroTime + f.to),
+				ResolvedTime:  timestamp.Time(tc.zeroTime + _40th),
+				EndsAtDelta:   endsAtDelta,
+				Alert: &notifier.Alert{
+					Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", "The template query returned "+f.queryResult),
+					StartsAt:    timestamp.Time(tc.zeroTime + _4th),
+				},
+			})
+		}
+	}
+
+	for ts := _40th; ts < _40thPlus15m; ts += resendDelayMs {
+		tolerance := tc.groupInterval
+		if ts == _40th {
+			// Since the alert state is reset, the alert sent time for resolved alert can be upto
+			// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+			// account for this delay plus the usual tolerance.
+			tolerance = 2 * tc.groupInterval
+		}
+		addAlert(ExpectedAlert{
+			TimeTolerance: tolerance,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      true,
+			Resend:        ts != _40th,
+			ResolvedTime:  timestamp.Time(tc.zeroTime + _40th),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "The template query returned 3"),
+				StartsAt:    timestamp.Time(tc.zeroTime + _4th),
+			},
+		})
+	}
+
+	return exp
+}
@@ -91,7 +91,7 @@ func (tc *zeroAndSmallFor) RuleGroup() (rulefmt.RuleGroup, error) {
 					"description":   "This should immediately fire",
 					"template_test": "{{humanize 1048576}} {{humanize1024 1048576}} {{humanizeDuration 135.3563}} {{humanizePercentage 0.959}} {{humanizeTimestamp 1643114203}}",
 					"template_query_test": fmt.Sprintf(`{{ define "testtemplate" }}Args are: {{.arg0}} {{.arg1}} {{.arg2}}. {{ with query "%s{rulegroup='%s',for='template'}" }}first_id:{{ . | sortByLabel "id" | first | label "id"}},{{ range $v := sortByLabel "id" .}}{{ . | label "id" }}:{{ . | value }},{{end}}{{end}}{{ end }}{{ template "testtemplate" (args "foo" "bar" 99) }}`,
-						sourceTimeSeriesName, tc.groupName,
+						SourceTimeSeriesName, tc.groupName,
 					),
 				},
 			},
@@ -137,7 +137,7 @@ func (tc *zeroAndSmallFor) SamplesToRemoteWrite() []prompb.TimeSeries {
 	for i := 1; i <= 3; i++ {
 		series = append(series, prompb.TimeSeries{
 			Labels: toProtoLabels(labels.FromStrings(
-				"__name__", sourceTimeSeriesName,
+				"__name__", SourceTimeSeriesName,
 				"rulegroup", tc.groupName,
 				"for", "template",
 				"id", fmt.Sprintf("%d", 100+i),
@@ -283,7 +283,7 @@ func (tc *zeroAndSmallFor) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
 						"description", "This should immediately fire",
 						"template_test", "{{humanize 1048576}} {{humanize1024 1048576}} {{humanizeDuration 135.3563}} {{humanizePercentage 0.959}} {{humanizeTimestamp 1643114203}}",
 						"template_query_test", fmt.Sprintf(`{{ define "testtemplate" }}Args are: {{.arg0}} {{.arg1}} {{.arg2}}. {{ with query "%s{rulegroup='%s',for='template'}" }}first_id:{{ . | sortByLabel "id" | first | label "id"}},{{ range $v := sortByLabel "id" .}}{{ . | label "id" }}:{{ . | value }},{{end}}{{end}}{{ end }}{{ template "testtemplate" (args "foo" "bar" 99) }}`,
-							sourceTimeSeriesName, tc.groupName,
+							SourceTimeSeriesName, tc.groupName,
 						),
 					),
 					Alerts: a1,
@@ -454,10 +454,10 @@ func (tc *zeroAndSmallFor) ExpectedAlerts() []ExpectedAlert {
 	_8th := 8 * int64(tc.rwInterval/time.Millisecond)               // Zero 'for' firing.
 	_8th_plus_gi := _8th + int64(tc.groupInterval/time.Millisecond) // Small 'for' firing.
 	_21st := 21 * int64(tc.rwInterval/time.Millisecond)             // All resolved.
-	_21stPlus15m := _21st + int64(15*time.Minute/time.Millisecond)
+	_21stPlus15m := _21st + int64(ResolvedRetention/time.Millisecond)
 	_93rd := 93 * int64(tc.rwInterval/time.Millisecond)   // Zero 'for' firing again.
 	_106th := 106 * int64(tc.rwInterval/time.Millisecond) // Resolved again.
-	_106thPlus15m := _106th + int64(15*time.Minute/time.Millisecond)
+	_106thPlus15m := _106th + int64(ResolvedRetention/time.Millisecond)
 
 	var exp []ExpectedAlert
 	endsAtDelta := 4 * ResendDelay
@@ -3,6 +3,7 @@ package cases
 import (
 	"fmt"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/prometheus/prometheus/model/labels"
@@ -47,6 +48,15 @@ type ExpectedAlert struct {
 	// It is usually 4*resendDelay or 4*groupInterval, whichever is higher.
 	EndsAtDelta time.Duration
 
+	// ClockSkewTolerance is added on both sides of every time range when matching, to compensate
+	// for the clock of the engine being skewed w.r.t. the clock of the tester.
+	// This is set by the test suite from the config and not by the test cases.
+	ClockSkewTolerance time.Duration
+
+	// AnnotationSizeLimit is the size in bytes that annotation values may be truncated to, 0 if they must
+	// be received whole. This is set by the test suite from the config and not by the test cases.
+	AnnotationSizeLimit int
+
 	// This is the expected alert.
 	Alert *notifier.Alert
 }
@@ -56,23 +66,23 @@ func (ea *ExpectedAlert) Matches(now time.Time, a notifier.Alert) (err error) {
 	if labels.Compare(ea.Alert.Labels, a.Labels) != 0 {
 		return fmt.Errorf("labels mismatch, expected: %s, got: %s", ea.Alert.Labels.String(), a.Labels.String())
 	}
-	if labels.Compare(ea.Alert.Annotations, a.Annotations) != 0 {
+	if !ea.annotationsMatch(a.Annotations) {
 		return fmt.Errorf("annotations mismatch, expected: %s, got: %s", ea.Alert.Annotations.String(), a.Annotations.String())
 	}
 
 	// TODO: 2*MaxRTT because of some edge case. Like missed by some milli/micro seconds. Fix it.
 	if !ea.matchesWithinToleranceAndTwiceSendDelay(ea.Ts, now) {
 		return fmt.Errorf("got the alert a little late, expected range: [%s, %s], got: %s",
-			ea.Ts.Format(time.RFC3339Nano),
-			ea.Ts.Add(ea.TimeTolerance).Format(time.RFC3339Nano),
+			ea.Ts.Add(-ea.ClockSkewTolerance).Format(time.RFC3339Nano),
+			ea.Ts.Add(ea.TimeTolerance+ea.ClockSkewTolerance).Format(time.RFC3339Nano),
 			now.Format(time.RFC3339Nano),
 		)
 	}
 
 	if !a.StartsAt.Equal(time.Time{}) && !ea.matchesWithinTolerance(ea.Alert.StartsAt, a.StartsAt) {
 		return fmt.Errorf("mismatch in StartsAt, expected range: [%s, %s], got: %s",
-			ea.Alert.StartsAt.Format(time.RFC3339Nano),
-			ea.Alert.StartsAt.Add(ea.TimeTolerance).Format(time.RFC3339Nano),
+			ea.Alert.StartsAt.Add(-ea.ClockSkewTolerance).Format(time.RFC3339Nano),
+			ea.Alert.StartsAt.Add(ea.TimeTolerance+ea.ClockSkewTolerance).Format(time.RFC3339Nano),
 			a.StartsAt.Format(time.RFC3339Nano),
 		)
 	}
@@ -88,8 +98,8 @@ func (ea *ExpectedAlert) Matches(now time.Time, a notifier.Alert) (err error) {
 		if !(ea.matchesWithinTolerance(expEndsAt, a.EndsAt) || ea.matchesWithinTolerance(expEndsAt.Add(-2*MaxRTT), a.EndsAt)) &&
 			(ea.Resolved || !ea.matchesWithinTolerance(expEndsAt.Add(-2*MaxRTT), a.EndsAt)) {
 			return fmt.Errorf("mismatch in EndsAt, expected range: [%s, %s], got: %s",
-				expEndsAt.Format(time.RFC3339Nano),
-				expEndsAt.Add(ea.TimeTolerance).Format(time.RFC3339Nano),
+				expEndsAt.Add(-ea.ClockSkewTolerance).Format(time.RFC3339Nano),
+				expEndsAt.Add(ea.TimeTolerance+ea.ClockSkewTolerance).Format(time.RFC3339Nano),
 				a.EndsAt.Format(time.RFC3339Nano),
 			)
 		}
@@ -105,12 +115,37 @@ func (ea *ExpectedAlert) Matches(now time.Time, a notifier.Alert) (err error) {
 	return nil
 }
 
+// annotationsMatch tells if the given annotations are the expected ones. With an AnnotationSizeLimit,
+// longer annotation values may be truncated to it, with or without a trailing ellipsis as added by
+// Alertmanager when truncating, but not any shorter.
+func (ea *ExpectedAlert) annotationsMatch(annotations labels.Labels) bool {
+	if ea.AnnotationSizeLimit == 0 || len(ea.Alert.Annotations) != len(annotations) {
+		return labels.Compare(ea.Alert.Annotations, annotations) == 0
+	}
+	for i, exp := range ea.Alert.Annotations {
+		got := annotations[i]
+		if exp.Name != got.Name {
+			return false
+		}
+		if exp.Value == got.Value {
+			continue
+		}
+		// The value must be cut at the limit, not just be any prefix of the expected value.
+		truncated := strings.TrimSuffix(got.Value, "…")
+		if len(exp.Value) <= ea.AnnotationSizeLimit || len(got.Value) > ea.AnnotationSizeLimit ||
+			len(truncated) < ea.AnnotationSizeLimit-len("…") || !strings.HasPrefix(exp.Value, truncated) {
+			return false
+		}
+	}
+	return true
+}
+
 func (ea *ExpectedAlert) matchesWithinTolerance(exp, act time.Time) bool {
-	return act.After(exp) && act.Before(exp.Add(ea.TimeTolerance))
+	return act.After(exp.Add(-ea.ClockSkewTolerance)) && act.Before(exp.Add(ea.TimeTolerance+ea.ClockSkewTolerance))
 }
 
 func (ea *ExpectedAlert) matchesWithinToleranceAndTwiceSendDelay(exp, act time.Time) bool {
-	return act.After(exp) && act.Before(exp.Add(ea.TimeTolerance+(2*MaxRTT)))
+	return act.After(exp.Add(-ea.ClockSkewTolerance)) && act.Before(exp.Add(ea.TimeTolerance+ea.ClockSkewTolerance+(2*MaxRTT)))
 }
 
 func (ea *ExpectedAlert) timeCanBeIgnored(t time.Time) bool {
@@ -124,7 +159,7 @@ func (ea *ExpectedAlert) timeCanBeIgnored(t time.Time) bool {
 // 3. The alert goes into the next state within the tolerance time.
 func (ea *ExpectedAlert) CanBeIgnored() bool {
 	// TODO: because of time adjusting for resends, this might be wrong.
-	return (ea.Resolved && ea.Ts.Sub(ea.ResolvedTime) > 15*time.Minute) || // Time limit for sending resolved.
+	return (ea.Resolved && ea.Ts.Sub(ea.ResolvedTime) > ResolvedRetention) || // Time limit for sending resolved.
 		// Might have gone into next state.
 		(ea.NextState != time.Time{} && ea.timeCanBeIgnored(ea.NextState)) ||
 		// Might be near resolved state.
@@ -136,7 +171,7 @@ func (ea *ExpectedAlert) CanBeIgnored() bool {
 // 2. Ts has crossed the next state time.
 func (ea *ExpectedAlert) ShouldBeIgnored() bool {
 	// TODO: because of time adjusting for resends, this might be wrong.
-	return (ea.Resolved && ea.Ts.Sub(ea.ResolvedTime) > 15*time.Minute) || // Time limit for sending resolved.
+	return (ea.Resolved && ea.Ts.Sub(ea.ResolvedTime) > ResolvedRetention) || // Time limit for sending resolved.
 		// Gone into next state.
 		(ea.NextState != time.Time{} && ea.Ts.After(ea.NextState))
 }
@@ -0,0 +1,44 @@
+package cases
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnnotationsMatch(t *testing.T) {
+	ea := ExpectedAlert{
+		Alert: &notifier.Alert{
+			Annotations: labels.FromStrings("description", "0123456789", "summary", "short"),
+		},
+	}
+
+	cases := []struct {
+		limit       int
+		annotations labels.Labels
+		exp         bool
+	}{
+		{limit: 0, annotations: labels.FromStrings("description", "0123456789", "summary", "short"), exp: true},
+		{limit: 0, annotations: labels.FromStrings("description", "01234", "summary", "short"), exp: false},
+		{limit: 5, annotations: labels.FromStrings("description", "0123456789", "summary", "short"), exp: true},
+		{limit: 5, annotations: labels.FromStrings("description", "01234", "summary", "short"), exp: true},
+		{limit: 5, annotations: labels.FromStrings("description", "01…", "summary", "short"), exp: true},
+		// Longer than the limit.
+		{limit: 5, annotations: labels.FromStrings("description", "012345", "summary", "short"), exp: false},
+		// Cut shorter than the limit.
+		{limit: 5, annotations: labels.FromStrings("description", "", "summary", "short"), exp: false},
+		{limit: 5, annotations: labels.FromStrings("description", "0", "summary", "short"), exp: false},
+		{limit: 5, annotations: labels.FromStrings("description", "0…", "summary", "short"), exp: false},
+		// Not a prefix.
+		{limit: 5, annotations: labels.FromStrings("description", "12345", "summary", "short"), exp: false},
+		// Values within the limit must not be truncated.
+		{limit: 5, annotations: labels.FromStrings("description", "01234", "summary", "sho"), exp: false},
+		{limit: 5, annotations: labels.FromStrings("description", "01234"), exp: false},
+	}
+	for _, c := range cases {
+		ea.AnnotationSizeLimit = c.limit
+		require.Equal(t, c.exp, ea.annotationsMatch(c.annotations), "limit %d, annotations %s", c.limit, c.annotations)
+	}
+}
@@ -12,6 +12,10 @@ import (
 const (
 	ResendDelay = time.Minute
 
+	// ResolvedRetention is the duration after an alert gets resolved during which the
+	// resolved alert must still be sent. No resolved alert must be sent after this.
+	ResolvedRetention = 15 * time.Minute
+
 	// MaxRTT is the max request time for alert-generator sending the alert or making GET requests to the API.
 	MaxRTT = 5 * time.Second
 )
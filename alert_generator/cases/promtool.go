@@ -0,0 +1,348 @@
+package cases
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// promtoolTestFile is the subset of the `promtool test rules` file format that is imported.
+// The PromQL expression tests, the external labels and URL and the group evaluation order are not imported.
+type promtoolTestFile struct {
+	RuleFiles          []string       `yaml:"rule_files"`
+	EvaluationInterval model.Duration `yaml:"evaluation_interval"`
+	Tests              []promtoolTest `yaml:"tests"`
+}
+
+type promtoolTest struct {
+	Name          string                  `yaml:"name"`
+	Interval      model.Duration          `yaml:"interval"`
+	InputSeries   []promtoolSeries        `yaml:"input_series"`
+	AlertRuleTest []promtoolAlertRuleTest `yaml:"alert_rule_test"`
+}
+
+type promtoolSeries struct {
+	Series string `yaml:"series"`
+	Values string `yaml:"values"`
+}
+
+type promtoolAlertRuleTest struct {
+	EvalTime  model.Duration  `yaml:"eval_time"`
+	Alertname string          `yaml:"alertname"`
+	ExpAlerts []promtoolAlert `yaml:"exp_alerts"`
+}
+
+type promtoolAlert struct {
+	ExpLabels      map[string]string `yaml:"exp_labels"`
+	ExpAnnotations map[string]string `yaml:"exp_annotations"`
+}
+
+var invalidGroupNameChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// AddPromtoolTests imports the tests of the given `promtool test rules` files as test cases and adds them to
+// AllCasesMap. Every test becomes a test case named Promtool_<file name>_<index of the test>, whose rule group
+// contains all the rules of the rule files. The `rulegroup` label is added to the input series and to all
+// the selectors of the rules to not interfere with other data in the database.
+//
+// The firing alerts of every alert_rule_test are checked in the alerts API and the ALERTS series for one
+// rule group interval after the eval_time, hence the input series must not change around it. The alerts
+// sent are not known beforehand, so the alert reception check must be disabled for these test cases.
+func AddPromtoolTests(files ...string) error {
+	for _, f := range files {
+		tcs, err := PromtoolTestCases(f)
+		if err != nil {
+			return errors.Wrapf(err, "import promtool test file %s", f)
+		}
+		for _, tc := range tcs {
+			name, _ := tc.Describe()
+			if _, ok := AllCasesMap[name]; ok {
+				return errors.Errorf("test case %q already exists", name)
+			}
+			AllCasesMap[name] = tc
+		}
+	}
+	return nil
+}
+
+// PromtoolTestCases returns the test cases for the tests of the given `promtool test rules` file.
+func PromtoolTestCases(file string) ([]TestCase, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var tf promtoolTestFile
+	if err := yaml.Unmarshal(b, &tf); err != nil {
+		return nil, errors.Wrap(err, "unmarshal test file")
+	}
+	if tf.EvaluationInterval == 0 {
+		tf.EvaluationInterval = model.Duration(time.Minute)
+	}
+
+	// The rule files are relative to the test file, like for promtool.
+	var rules []rulefmt.RuleNode
+	for _, rf := range tf.RuleFiles {
+		if !filepath.IsAbs(rf) {
+			rf = filepath.Join(filepath.Dir(file), rf)
+		}
+		rgs, errs := rulefmt.ParseFile(rf)
+		if len(errs) > 0 {
+			return nil, errors.Wrapf(errs[0], "parse rule file %s", rf)
+		}
+		for _, rg := range rgs.Groups {
+			rules = append(rules, rg.Rules...)
+		}
+	}
+
+	base := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	base = invalidGroupNameChars.ReplaceAllString(base, "_")
+
+	var tcs []TestCase
+	for i, t := range tf.Tests {
+		tc, err := newPromtoolTestCase(fmt.Sprintf("Promtool_%s_%d", base, i), time.Duration(tf.EvaluationInterval), rules, t)
+		if err != nil {
+			return nil, errors.Wrapf(err, "test %d", i)
+		}
+		tcs = append(tcs, tc)
+	}
+	return tcs, nil
+}
+
+func newPromtoolTestCase(groupName string, groupInterval time.Duration, rules []rulefmt.RuleNode, t promtoolTest) (*promtoolTestCase, error) {
+	tc := &promtoolTestCase{
+		groupName:     groupName,
+		description:   t.Name,
+		groupInterval: groupInterval,
+		interval:      time.Duration(t.Interval),
+		alertTests:    t.AlertRuleTest,
+	}
+	if tc.interval == 0 {
+		tc.interval = time.Minute
+	}
+	if tc.description == "" {
+		tc.description = "Imported promtool test."
+	}
+
+	for _, r := range rules {
+		expr, err := parser.ParseExpr(r.Expr.Value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse expression %q", r.Expr.Value)
+		}
+		// Only select the series of this test case.
+		parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+			if vs, ok := node.(*parser.VectorSelector); ok {
+				vs.LabelMatchers = append(vs.LabelMatchers, labels.MustNewMatcher(labels.MatchEqual, "rulegroup", groupName))
+			}
+			return nil
+		})
+		r.Expr = yaml.Node{}
+		if err := r.Expr.Encode(expr.String()); err != nil {
+			return nil, err
+		}
+		lbls := map[string]string{"rulegroup": groupName}
+		for k, v := range r.Labels {
+			lbls[k] = v
+		}
+		r.Labels = lbls
+		tc.rules = append(tc.rules, r)
+	}
+
+	for _, s := range t.InputSeries {
+		lbls, values, err := parser.ParseSeriesDesc(s.Series + " " + s.Values)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse input series %q", s.Series)
+		}
+		lbls = append(lbls, labels.Label{Name: "rulegroup", Value: groupName})
+		sort.Sort(lbls)
+
+		var samples []prompb.Sample
+		for i, v := range values {
+			if v.Omitted {
+				continue
+			}
+			samples = append(samples, prompb.Sample{
+				Timestamp: int64(i) * int64(tc.interval/time.Millisecond),
+				Value:     v.Value,
+			})
+		}
+		if len(values) > tc.totalSamples {
+			tc.totalSamples = len(values)
+		}
+		tc.series = append(tc.series, prompb.TimeSeries{
+			Labels:  toProtoLabels(lbls),
+			Samples: samples,
+		})
+	}
+
+	for _, at := range tc.alertTests {
+		if end := time.Duration(at.EvalTime) + 2*tc.groupInterval; end > tc.testDuration {
+			tc.testDuration = end
+		}
+	}
+	if d := time.Duration(tc.totalSamples) * tc.interval; d > tc.testDuration {
+		tc.testDuration = d
+	}
+
+	return tc, nil
+}
+
+type promtoolTestCase struct {
+	groupName               string
+	description             string
+	rules                   []rulefmt.RuleNode
+	series                  []prompb.TimeSeries
+	alertTests              []promtoolAlertRuleTest
+	interval, groupInterval time.Duration
+	totalSamples            int
+	testDuration            time.Duration
+
+	zeroTime int64
+}
+
+func (tc *promtoolTestCase) Describe() (title string, description string) {
+	return tc.groupName, tc.description
+}
+
+func (tc *promtoolTestCase) RuleGroup() (rulefmt.RuleGroup, error) {
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules:    tc.rules,
+	}, nil
+}
+
+func (tc *promtoolTestCase) SamplesToRemoteWrite() []prompb.TimeSeries {
+	return tc.series
+}
+
+func (tc *promtoolTestCase) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *promtoolTestCase) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(tc.testDuration))
+}
+
+// alertTestsAt returns the alert rule tests whose expectations hold at the given time relative to zeroTime,
+// that is within one group interval after their eval_time, when the rule has been evaluated at least once.
+func (tc *promtoolTestCase) alertTestsAt(relTs int64) []promtoolAlertRuleTest {
+	var ats []promtoolAlertRuleTest
+	for _, at := range tc.alertTests {
+		evalTime := int64(time.Duration(at.EvalTime) / time.Millisecond)
+		if relTs >= evalTime+int64(tc.groupInterval/time.Millisecond) && relTs < evalTime+int64(2*tc.groupInterval/time.Millisecond) {
+			ats = append(ats, at)
+		}
+	}
+	return ats
+}
+
+// expLabels returns the expected labels of the alert, which include the ones added to the series and rules.
+func (tc *promtoolTestCase) expLabels(alertname string, a promtoolAlert) labels.Labels {
+	lbls := labels.FromMap(a.ExpLabels)
+	b := labels.NewBuilder(lbls)
+	b.Set("alertname", alertname)
+	b.Set("rulegroup", tc.groupName)
+	return b.Labels()
+}
+
+func (tc *promtoolTestCase) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	for _, at := range tc.alertTestsAt(ts - tc.zeroTime) {
+		var exp, act []v1.Alert
+		for _, a := range at.ExpAlerts {
+			exp = append(exp, v1.Alert{
+				Labels:      tc.expLabels(at.Alertname, a),
+				Annotations: labels.FromMap(a.ExpAnnotations),
+			})
+		}
+		for _, a := range alerts {
+			if a.State == "firing" && a.Labels.Get("alertname") == at.Alertname {
+				act = append(act, v1.Alert{Labels: a.Labels, Annotations: a.Annotations})
+			}
+		}
+		if err := arePromtoolAlertsEqual(exp, act); err != nil {
+			return errors.Wrapf(err, "alert %s at eval_time %s", at.Alertname, at.EvalTime)
+		}
+	}
+	return nil
+}
+
+// arePromtoolAlertsEqual tells whether both the expected and actual alerts have the same labels and annotations.
+func arePromtoolAlertsEqual(exp, act []v1.Alert) error {
+	if len(exp) != len(act) {
+		return errors.Errorf("different number of firing alerts - expected(%d): %v, actual(%d): %v", len(exp), exp, len(act), act)
+	}
+	for _, as := range [][]v1.Alert{exp, act} {
+		as := as
+		sort.Slice(as, func(i, j int) bool {
+			return labels.Compare(as[i].Labels, as[j].Labels) <= 0
+		})
+	}
+	for i := range exp {
+		if labels.Compare(exp[i].Labels, act[i].Labels) != 0 || labels.Compare(exp[i].Annotations, act[i].Annotations) != 0 {
+			return errors.Errorf("alerts mismatch - expected: %v, actual: %v", exp[i], act[i])
+		}
+	}
+	return nil
+}
+
+func (tc *promtoolTestCase) CheckRuleGroup(ts int64, rg *v1.RuleGroup) error {
+	if ts-tc.zeroTime < 2*int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	if len(rg.Rules) != len(tc.rules) {
+		return errors.Errorf("different number of rules - expected %d, actual %d", len(tc.rules), len(rg.Rules))
+	}
+	return nil
+}
+
+func (tc *promtoolTestCase) CheckMetrics(ts int64, samples []promql.Sample) error {
+	for _, at := range tc.alertTestsAt(ts - tc.zeroTime) {
+		var exp, act []labels.Labels
+		for _, a := range at.ExpAlerts {
+			b := labels.NewBuilder(tc.expLabels(at.Alertname, a))
+			b.Set("__name__", "ALERTS")
+			b.Set("alertstate", "firing")
+			exp = append(exp, b.Labels())
+		}
+		for _, s := range samples {
+			if s.Metric.Get("alertstate") == "firing" && s.Metric.Get("alertname") == at.Alertname {
+				act = append(act, s.Metric)
+			}
+		}
+		sort.Slice(exp, func(i, j int) bool { return labels.Compare(exp[i], exp[j]) < 0 })
+		sort.Slice(act, func(i, j int) bool { return labels.Compare(act[i], act[j]) < 0 })
+		if len(exp) != len(act) {
+			return errors.Errorf("different number of firing ALERTS series for %s at eval_time %s - expected(%d): %v, actual(%d): %v", at.Alertname, at.EvalTime, len(exp), exp, len(act), act)
+		}
+		for i := range exp {
+			if labels.Compare(exp[i], act[i]) != 0 {
+				return errors.Errorf("ALERTS series mismatch for %s at eval_time %s - expected: %v, actual: %v", at.Alertname, at.EvalTime, exp[i], act[i])
+			}
+		}
+	}
+	return nil
+}
+
+// ExpectedAlerts returns no alerts since the times at which the alerts are sent are not known
+// from the promtool test.
+func (tc *promtoolTestCase) ExpectedAlerts() []ExpectedAlert {
+	return nil
+}
@@ -0,0 +1,92 @@
+package cases
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromtoolTestCases(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "rules.yml"), []byte(`
+groups:
+  - name: example
+    rules:
+      - alert: InstanceDown
+        expr: up == 0
+        for: 5m
+        labels:
+          severity: page
+        annotations:
+          summary: 'Instance {{ $labels.instance }} down'
+`), 0o644))
+	testFile := filepath.Join(dir, "alerts-test.yml")
+	require.NoError(t, os.WriteFile(testFile, []byte(`
+rule_files:
+  - rules.yml
+evaluation_interval: 1m
+tests:
+  - interval: 1m
+    input_series:
+      - series: 'up{job="prometheus", instance="localhost:9090"}'
+        values: '0x14'
+    alert_rule_test:
+      - eval_time: 10m
+        alertname: InstanceDown
+        exp_alerts:
+          - exp_labels:
+              severity: page
+              instance: localhost:9090
+              job: prometheus
+            exp_annotations:
+              summary: 'Instance localhost:9090 down'
+`), 0o644))
+
+	tcs, err := PromtoolTestCases(testFile)
+	require.NoError(t, err)
+	require.Len(t, tcs, 1)
+	tc := tcs[0]
+
+	name, _ := tc.Describe()
+	require.Equal(t, "Promtool_alerts_test_0", name)
+
+	rg, err := tc.RuleGroup()
+	require.NoError(t, err)
+	require.Equal(t, name, rg.Name)
+	require.Len(t, rg.Rules, 1)
+	require.Equal(t, `up{rulegroup="Promtool_alerts_test_0"} == 0`, rg.Rules[0].Expr.Value)
+	require.Equal(t, map[string]string{"severity": "page", "rulegroup": name}, rg.Rules[0].Labels)
+
+	series := tc.SamplesToRemoteWrite()
+	require.Len(t, series, 1)
+	require.Len(t, series[0].Samples, 15)
+
+	zt := timestamp.FromTime(time.Now())
+	tc.Init(zt)
+	require.Equal(t, zt+int64(15*time.Minute/time.Millisecond), tc.TestUntil())
+
+	alertLabels := labels.FromStrings("alertname", "InstanceDown", "instance", "localhost:9090", "job", "prometheus", "rulegroup", name, "severity", "page")
+	firing := []v1.Alert{{
+		Labels:      alertLabels,
+		Annotations: labels.FromStrings("summary", "Instance localhost:9090 down"),
+		State:       "firing",
+	}}
+	ts := zt + int64(11*time.Minute/time.Millisecond)
+	require.NoError(t, tc.CheckAlerts(ts, firing))
+	require.Error(t, tc.CheckAlerts(ts, nil))
+	// Not checked outside the eval times.
+	require.NoError(t, tc.CheckAlerts(zt+int64(5*time.Minute/time.Millisecond), nil))
+
+	b := labels.NewBuilder(alertLabels)
+	b.Set("__name__", "ALERTS")
+	b.Set("alertstate", "firing")
+	require.NoError(t, tc.CheckMetrics(ts, []promql.Sample{{Metric: b.Labels()}}))
+	require.Error(t, tc.CheckMetrics(ts, nil))
+}
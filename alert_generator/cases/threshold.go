@@ -0,0 +1,435 @@
+package cases
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+
+	"github.com/prometheus/compliance/alert_generator/config"
+)
+
+// ThresholdCaseOptions defines a test case with a single alerting rule that is active while a synthetic
+// series is above a threshold.
+type ThresholdCaseOptions struct {
+	// Name is the name of the test case and its rule group.
+	Name string
+	// MetricName is the name of the synthetic series. Default: the name of the series of the built-in test cases.
+	MetricName string
+	// Samples are the values of the series in the notation of sampleSlice, e.g. ["0", "0x10", "20", "0x20", "0"].
+	Samples []string
+	// Threshold is the value the series must be above for the alert to be active.
+	Threshold float64
+	// For is the 'for' duration of the alerting rule.
+	For time.Duration
+	// SampleInterval is the interval between the samples. Default: 15s.
+	SampleInterval time.Duration
+	// GroupInterval is the evaluation interval of the rule group. Default: 30s.
+	GroupInterval time.Duration
+}
+
+// ThresholdCaseOptionsFromConfig returns the options of the test cases for the threshold cases of the config.
+func ThresholdCaseOptionsFromConfig(tcs []config.ThresholdCase) []ThresholdCaseOptions {
+	opts := make([]ThresholdCaseOptions, 0, len(tcs))
+	for _, tc := range tcs {
+		opts = append(opts, ThresholdCaseOptions{
+			Name:           tc.Name,
+			MetricName:     tc.MetricName,
+			Samples:        tc.Samples,
+			Threshold:      tc.Threshold,
+			For:            time.Duration(tc.For),
+			SampleInterval: time.Duration(tc.SampleInterval),
+			GroupInterval:  time.Duration(tc.GroupInterval),
+		})
+	}
+	return opts
+}
+
+// AddThresholdCases adds the test cases for the given options to AllCasesMap. This allows to define
+// simple test cases without writing Go, e.g. to reproduce a specific regression.
+func AddThresholdCases(opts ...ThresholdCaseOptions) error {
+	for _, o := range opts {
+		tc, err := NewThresholdCase(o)
+		if err != nil {
+			return errors.Wrapf(err, "threshold case %q", o.Name)
+		}
+		if _, ok := AllCasesMap[o.Name]; ok {
+			return errors.Errorf("test case %q already exists", o.Name)
+		}
+		AllCasesMap[o.Name] = tc
+	}
+	return nil
+}
+
+// NewThresholdCase returns the test case for the given options. It tests the following cases:
+// * Alert that goes from pending->firing->inactive every time the series goes above the threshold
+//   for longer than the 'for' duration, and from pending->inactive when it goes below earlier.
+// * firing and inactive alerts being sent and re-sent at expected intervals.
+// The last sample must not be above the threshold, so that the alert is inactive at the end of the test.
+func NewThresholdCase(opts ThresholdCaseOptions) (TestCase, error) {
+	if opts.Name == "" {
+		return nil, errors.New("name is not set")
+	}
+	if opts.MetricName == "" {
+		opts.MetricName = SourceTimeSeriesName
+	}
+	if opts.SampleInterval == 0 {
+		opts.SampleInterval = 15 * time.Second
+	}
+	if opts.GroupInterval == 0 {
+		opts.GroupInterval = 30 * time.Second
+	}
+
+	samples, err := parseSampleSlice(opts.SampleInterval, opts.Samples...)
+	if err != nil {
+		return nil, err
+	}
+	if len(samples) == 0 {
+		return nil, errors.New("no samples")
+	}
+	if samples[len(samples)-1].Value > opts.Threshold {
+		return nil, errors.New("the last sample is above the threshold, the alert would not be resolved within the test")
+	}
+
+	lbls := labels.FromStrings("__name__", opts.MetricName, "rulegroup", opts.Name)
+	tc := &thresholdCase{
+		groupName:     opts.Name,
+		alertName:     opts.Name + "_Alert",
+		query:         lbls.String() + " > " + strconv.FormatFloat(opts.Threshold, 'f', -1, 64),
+		metricLabels:  lbls,
+		rwInterval:    opts.SampleInterval,
+		groupInterval: opts.GroupInterval,
+		forDuration:   model.Duration(opts.For),
+		samples:       samples,
+	}
+
+	// Find the runs of consecutive samples above the threshold.
+	for i := 0; i < len(samples); i++ {
+		if samples[i].Value <= opts.Threshold {
+			continue
+		}
+		r := thresholdRun{start: i}
+		for i < len(samples) && samples[i].Value > opts.Threshold {
+			i++
+		}
+		r.end = i
+		tc.runs = append(tc.runs, r)
+	}
+	return tc, nil
+}
+
+// thresholdRun is a run of consecutive samples above the threshold, from index start (inclusive)
+// to index end (exclusive).
+type thresholdRun struct {
+	start, end int
+}
+
+type thresholdCase struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+	samples                   []prompb.Sample
+	runs                      []thresholdRun
+
+	zeroTime int64
+}
+
+func (tc *thresholdCase) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) Alert on the query " + tc.query + " that goes from pending->firing->inactive every time the series goes above the threshold for longer than the 'for' duration, and from pending->inactive when it goes below earlier. " +
+			"(2) firing and inactive alerts being sent and re-sent at expected intervals."
+}
+
+func (tc *thresholdCase) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	var expr yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": tc.description()},
+			},
+		},
+	}, nil
+}
+
+func (tc *thresholdCase) description() string {
+	return tc.alertName + " is firing"
+}
+
+func (tc *thresholdCase) SamplesToRemoteWrite() []prompb.TimeSeries {
+	return []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(tc.metricLabels),
+			Samples: tc.samples,
+		},
+	}
+}
+
+func (tc *thresholdCase) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *thresholdCase) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(len(tc.samples)) * tc.rwInterval))
+}
+
+func (tc *thresholdCase) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *thresholdCase) CheckRuleGroup(ts int64, rg *v1.RuleGroup) error {
+	if ts-tc.zeroTime < 2*int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg)
+}
+
+func (tc *thresholdCase) CheckMetrics(ts int64, samples []promql.Sample) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(expSamples, samples)
+}
+
+func (tc *thresholdCase) expAlerts(ts int64) (expAlerts [][]v1.Alert) {
+	canBeInactive, possibleAlerts := tc.allPossibleStates(ts - tc.zeroTime)
+
+	if canBeInactive {
+		expAlerts = append(expAlerts, []v1.Alert{})
+	}
+	for _, a := range possibleAlerts {
+		expAlerts = append(expAlerts, []v1.Alert{a})
+	}
+
+	return expAlerts
+}
+
+func (tc *thresholdCase) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	canBeInactive, possibleAlerts := tc.allPossibleStates(ts - tc.zeroTime)
+
+	getRg := func(state string, alerts []*v1.Alert) v1.RuleGroup {
+		return v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.AlertingRule{
+					State:       state,
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+					Labels:      labels.FromStrings("rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", tc.description()),
+					Alerts:      alerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		}
+	}
+
+	if canBeInactive {
+		expRgs = append(expRgs, getRg("inactive", nil))
+	}
+	for i := range possibleAlerts {
+		expRgs = append(expRgs, getRg(possibleAlerts[i].State, []*v1.Alert{&possibleAlerts[i]}))
+	}
+
+	return expRgs
+}
+
+func (tc *thresholdCase) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	canBeInactive, possibleAlerts := tc.allPossibleStates(ts - tc.zeroTime)
+
+	if canBeInactive {
+		expSamples = append(expSamples, nil)
+	}
+	states := map[string]bool{}
+	for _, a := range possibleAlerts {
+		if states[a.State] {
+			continue
+		}
+		states[a.State] = true
+		expSamples = append(expSamples, []promql.Sample{
+			{
+				Point:  promql.Point{T: ts / 1000, V: 1},
+				Metric: labels.FromStrings("__name__", "ALERTS", "alertstate", a.State, "alertname", tc.alertName, "rulegroup", tc.groupName),
+			},
+		})
+	}
+
+	return expSamples
+}
+
+// allPossibleStates returns whether the alert can be inactive and all the pending and firing alerts
+// possible at the given time. As the evaluations can happen anytime within a group interval, the value
+// of the alert can be the value of any sample that could have been the latest one in the last evaluation.
+// ts is relative time w.r.t. zeroTime.
+func (tc *thresholdCase) allPossibleStates(ts int64) (canBeInactive bool, possibleAlerts []v1.Alert) {
+	between := betweenFunc(ts)
+
+	rwItvlSecFloat, grpItvlSecFloat := float64(tc.rwInterval/time.Second), float64(tc.groupInterval/time.Second)
+	forSecFloat := float64(time.Duration(tc.forDuration) / time.Second)
+	tsSecFloat := float64(ts) / 1000
+	// Lowest and highest index of the sample that could have been the latest one in the last evaluation.
+	lowestIdx := int(math.Ceil((tsSecFloat - grpItvlSecFloat - rwItvlSecFloat - 1 - float64(2*MaxRTT/time.Second)) / rwItvlSecFloat))
+	highestIdx := int(math.Floor(tsSecFloat / rwItvlSecFloat))
+
+	alert := func(state string, r thresholdRun) {
+		lo, hi := lowestIdx, highestIdx
+		if lo < r.start {
+			lo = r.start
+		}
+		if hi >= r.end {
+			hi = r.end - 1
+		}
+		if lo > hi {
+			// Only possible at the edges of the run.
+			if hi < r.start {
+				lo, hi = r.start, r.start
+			} else {
+				lo, hi = r.end-1, r.end-1
+			}
+		}
+		activeAt := timestamp.Time(tc.zeroTime + int64(r.start)*int64(tc.rwInterval/time.Millisecond))
+		seen := map[float64]bool{}
+		for i := lo; i <= hi; i++ {
+			v := tc.samples[i].Value
+			if seen[v] {
+				continue
+			}
+			seen[v] = true
+			possibleAlerts = append(possibleAlerts, v1.Alert{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", tc.description()),
+				State:       state,
+				Value:       strconv.FormatFloat(v, 'f', -1, 64),
+				ActiveAt:    &activeAt,
+			})
+		}
+	}
+
+	inactiveSince := 0.0
+	for _, r := range tc.runs {
+		start, end := float64(r.start)*rwItvlSecFloat, float64(r.end)*rwItvlSecFloat
+		canBeInactive = canBeInactive || between(inactiveSince, start+grpItvlSecFloat)
+
+		firingAt := start + forSecFloat
+		if forSecFloat > 0 && between(start-1, math.Min(firingAt, end)+grpItvlSecFloat) {
+			alert("pending", r)
+		}
+		if firingAt < end && between(firingAt-1, end+grpItvlSecFloat) {
+			alert("firing", r)
+		}
+		inactiveSince = end - 1
+	}
+	canBeInactive = canBeInactive || between(inactiveSince, math.Inf(1))
+	return canBeInactive, possibleAlerts
+}
+
+func (tc *thresholdCase) ExpectedAlerts() []ExpectedAlert {
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	rwItvlMs := int64(tc.rwInterval / time.Millisecond)
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	for i, r := range tc.runs {
+		start, end := int64(r.start)*rwItvlMs, int64(r.end)*rwItvlMs
+		firingAt := start + int64(time.Duration(tc.forDuration)/time.Millisecond)
+		if firingAt >= end {
+			// Never fires.
+			continue
+		}
+		// The resolved alert is not sent anymore once the alert is pending again.
+		resolvedUntil := end + int64(ResolvedRetention/time.Millisecond)
+		var nextState time.Time
+		if i+1 < len(tc.runs) {
+			nextStart := int64(tc.runs[i+1].start) * rwItvlMs
+			nextState = timestamp.Time(tc.zeroTime + nextStart)
+			if nextStart < resolvedUntil {
+				resolvedUntil = nextStart
+			}
+		}
+
+		for ts := firingAt; ts < end; ts += resendDelayMs {
+			addAlert(ExpectedAlert{
+				TimeTolerance: tc.groupInterval,
+				Ts:            timestamp.Time(tc.zeroTime + ts),
+				Resolved:      false,
+				Resend:        ts != firingAt,
+				NextState:     timestamp.Time(tc.zeroTime + end),
+				ResolvedTime:  timestamp.Time(tc.zeroTime + end),
+				EndsAtDelta:   endsAtDelta,
+				Alert: &notifier.Alert{
+					Labels:      labels.FromStrings("alertname", tc.alertName, "rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", tc.description()),
+					StartsAt:    timestamp.Time(tc.zeroTime + firingAt),
+				},
+			})
+		}
+		for ts := end; ts < resolvedUntil; ts += resendDelayMs {
+			tolerance := tc.groupInterval
+			if ts == end {
+				// Since the alert state is reset, the alert sent time for resolved alert can be upto
+				// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+				// account for this delay plus the usual tolerance.
+				tolerance = 2 * tc.groupInterval
+			}
+			addAlert(ExpectedAlert{
+				TimeTolerance: tolerance,
+				Ts:            timestamp.Time(tc.zeroTime + ts),
+				Resolved:      true,
+				Resend:        ts != end,
+				NextState:     nextState,
+				ResolvedTime:  timestamp.Time(tc.zeroTime + end),
+				EndsAtDelta:   endsAtDelta,
+				Alert: &notifier.Alert{
+					Labels:      labels.FromStrings("alertname", tc.alertName, "rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", tc.description()),
+					StartsAt:    timestamp.Time(tc.zeroTime + firingAt),
+				},
+			})
+		}
+	}
+
+	return exp
+}
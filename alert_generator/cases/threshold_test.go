@@ -0,0 +1,66 @@
+package cases
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThresholdCase(t *testing.T) {
+	_, err := NewThresholdCase(ThresholdCaseOptions{Name: "Threshold", Samples: []string{"0", "20"}, Threshold: 10})
+	require.Error(t, err, "the last sample is above the threshold")
+	_, err = NewThresholdCase(ThresholdCaseOptions{Name: "Threshold", Samples: []string{"0", "20y"}, Threshold: 10})
+	require.Error(t, err, "invalid notation")
+
+	tc, err := NewThresholdCase(ThresholdCaseOptions{
+		Name: "Threshold",
+		// Firing run of 5m, short run of 30s that never fires.
+		Samples:   []string{"0", "0x7", "20", "0x19", "0", "0x19", "20", "0x1", "0", "0x7"},
+		Threshold: 10,
+		For:       time.Minute,
+	})
+	require.NoError(t, err)
+
+	rg, err := tc.RuleGroup()
+	require.NoError(t, err)
+	require.Equal(t, `{__name__="alert_generator_test_suite", rulegroup="Threshold"} > 10`, rg.Rules[0].Expr.Value)
+
+	zt := int64(1000000)
+	tc.Init(zt)
+	require.Equal(t, zt+int64(58*15*time.Second/time.Millisecond), tc.TestUntil())
+
+	alertLabels := labels.FromStrings("alertname", "Threshold_Alert", "rulegroup", "Threshold")
+	activeAt := at(zt, 2*time.Minute)
+	state := func(s string) []v1.Alert {
+		return []v1.Alert{{
+			Labels:      alertLabels,
+			Annotations: labels.FromStrings("description", "Threshold_Alert is firing"),
+			State:       s,
+			Value:       "20",
+			ActiveAt:    &activeAt,
+		}}
+	}
+	require.NoError(t, tc.CheckAlerts(at(zt, time.Minute).UnixMilli(), nil))
+	require.Error(t, tc.CheckAlerts(at(zt, time.Minute).UnixMilli(), state("pending")))
+	require.NoError(t, tc.CheckAlerts(at(zt, 150*time.Second).UnixMilli(), state("pending")))
+	require.NoError(t, tc.CheckAlerts(at(zt, 4*time.Minute).UnixMilli(), state("firing")))
+	require.Error(t, tc.CheckAlerts(at(zt, 4*time.Minute).UnixMilli(), nil))
+	require.NoError(t, tc.CheckAlerts(at(zt, 9*time.Minute).UnixMilli(), nil))
+
+	exp := tc.ExpectedAlerts()
+	// Firing from 3m to 7m and resolved from 7m till the next run at 12m, every minute.
+	require.Len(t, exp, 4+5)
+	require.False(t, exp[0].Resend)
+	require.Equal(t, at(zt, 3*time.Minute), exp[0].Ts)
+	require.True(t, exp[4].Resolved)
+	require.Equal(t, at(zt, 7*time.Minute), exp[4].ResolvedTime)
+	require.Equal(t, at(zt, 12*time.Minute), exp[4].NextState)
+}
+
+// at returns the time d after the zero time zt in milliseconds.
+func at(zt int64, d time.Duration) time.Time {
+	return time.UnixMilli(zt).Add(d).UTC()
+}
@@ -17,12 +17,13 @@ import (
 )
 
 const (
-	sourceTimeSeriesName = "alert_generator_test_suite"
+	// SourceTimeSeriesName is the metric name of the series remote written by the test cases.
+	SourceTimeSeriesName = "alert_generator_test_suite"
 )
 
 func metricLabels(groupName, alertName string) labels.Labels {
 	return labels.FromStrings(
-		"__name__", sourceTimeSeriesName,
+		"__name__", SourceTimeSeriesName,
 		"rulegroup", groupName,
 		"alertname", alertName,
 	)
@@ -51,6 +52,15 @@ func toProtoLabels(lbls labels.Labels) []prompb.Label {
 //   Input values : [ "1x1",  "0x3",      "5x3",   "9", "8",   "-2x2" ]
 //   Output values: [   1,   1, 1, 1,   6, 11, 16,  9,   8,     6, 4 ]
 func sampleSlice(interval time.Duration, values ...string) []prompb.Sample {
+	samples, err := parseSampleSlice(interval, values...)
+	if err != nil {
+		panic(err.Error())
+	}
+	return samples
+}
+
+// parseSampleSlice is like sampleSlice, but returns an error for an invalid value notation.
+func parseSampleSlice(interval time.Duration, values ...string) ([]prompb.Sample, error) {
 	var samples []prompb.Sample
 	ts := time.Unix(0, 0)
 	var val float64
@@ -59,12 +69,12 @@ func sampleSlice(interval time.Duration, values ...string) []prompb.Sample {
 		if len(splits) == 2 {
 			a, err := strconv.ParseFloat(splits[0], 64)
 			if err != nil {
-				panic(fmt.Sprintf("invalid values notation %s, err: %s", v, err.Error()))
+				return nil, errors.Errorf("invalid values notation %s, err: %s", v, err.Error())
 			}
 
 			b, err := strconv.Atoi(splits[1])
 			if err != nil {
-				panic(fmt.Sprintf("invalid values notation %s, err: %s", v, err.Error()))
+				return nil, errors.Errorf("invalid values notation %s, err: %s", v, err.Error())
 			}
 
 			for i := 0; i < b; i++ {
@@ -79,7 +89,7 @@ func sampleSlice(interval time.Duration, values ...string) []prompb.Sample {
 			var err error
 			val, err = strconv.ParseFloat(splits[0], 64)
 			if err != nil {
-				panic(fmt.Sprintf("invalid values notation %s, err: %s", splits[0], err.Error()))
+				return nil, errors.Errorf("invalid values notation %s, err: %s", splits[0], err.Error())
 			}
 			samples = append(samples, prompb.Sample{
 				Timestamp: timestamp.FromTime(ts),
@@ -87,11 +97,11 @@ func sampleSlice(interval time.Duration, values ...string) []prompb.Sample {
 			})
 			ts = ts.Add(interval)
 		} else {
-			panic(fmt.Sprintf("invalid values notation %s", v))
+			return nil, errors.Errorf("invalid values notation %s", v)
 		}
 
 	}
-	return samples
+	return samples, nil
 }
 
 // betweenFunc returns a function that returns true if
@@ -3,12 +3,17 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"sort"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
 	"github.com/prometheus/common/promlog"
 
 	"github.com/prometheus/compliance/alert_generator"
@@ -19,15 +24,36 @@ import (
 func main() {
 	// TODO: give option to set log level.
 	configFile := flag.String("config-file", "config.yaml", "Path to the config file.")
+	failedGroupsFile := flag.String("failed-groups-file", "failed-groups.txt", "Path to the file to which the names of the failed rule groups are written at the end of the test, one per line. Not written if empty.")
+	rerunFailed := flag.String("rerun-failed", "", "Path to a file written via -failed-groups-file. If set, only the rule groups in it are run, overriding test_cases of the config file.")
+	listCases := flag.Bool("list-cases", false, "Print the names of all the test cases, as used in test_cases of the config file, with their description and exit.")
+	var promtoolTestFiles config.StringsFlag
+	flag.Var(&promtoolTestFiles, "promtool-test-file", "Path to a unit test file for \"promtool test rules\" whose tests are imported as additional test cases. Can be repeated. The rules file must be generated with the same files.")
 
 	flag.Parse()
 	log := promlog.New(&promlog.Config{})
 
+	if err := cases.AddPromtoolTests(promtoolTestFiles...); err != nil {
+		level.Error(log).Log("msg", "Failed to import the promtool tests", "err", err)
+		os.Exit(1)
+	}
+
 	cfg, err := config.LoadFromFile(*configFile)
-	if err != nil {
+	if err != nil && !*listCases {
 		level.Error(log).Log("msg", "Failed to load config file", "err", err)
 		os.Exit(1)
 	}
+	if err == nil {
+		if err := cases.AddThresholdCases(cases.ThresholdCaseOptionsFromConfig(cfg.ThresholdCases)...); err != nil {
+			level.Error(log).Log("msg", "Failed to add the threshold cases of the config file", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	if *listCases {
+		printCases(os.Stdout)
+		return
+	}
 
 	casesToRun := cases.AllCases()
 	if len(cfg.TestCases) > 0 {
@@ -42,6 +68,20 @@ func main() {
 		}
 	}
 
+	if *rerunFailed != "" {
+		casesToRun, err = failedCases(*rerunFailed)
+		if err != nil {
+			level.Error(log).Log("msg", "Failed to read the failed rule groups", "file", *rerunFailed, "err", err)
+			os.Exit(1)
+		}
+		level.Info(log).Log("msg", "Re-running the failed rule groups", "count", len(casesToRun))
+	}
+
+	if len(promtoolTestFiles) > 0 && !cfg.Settings.DisableAlertsReceptionCheck {
+		level.Error(log).Log("msg", "The alerts sent for imported promtool tests are not known, set disable_alerts_reception_check to run them")
+		os.Exit(1)
+	}
+
 	if cfg.Settings.AlertMessageParser == "" {
 		cfg.Settings.AlertMessageParser = "default"
 	}
@@ -71,23 +111,26 @@ func main() {
 
 	var wg sync.WaitGroup
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	interrupted := false
+	// Container orchestrators stop the tester with SIGTERM, which is handled like SIGINT.
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		for range c {
-			level.Info(log).Log("msg", "Received SIGINT, stopping the test")
-			interrupted = true
+		for sig := range c {
+			level.Info(log).Log("msg", "Received signal, stopping the test", "signal", sig, "time_remaining", time.Until(t.TestUntil()))
 			t.Stop()
 			return
 		}
 	}()
 
 	t.Wait()
+	signal.Stop(c)
 	close(c)
 	wg.Wait()
 
+	// The test is only incomplete if it was stopped while some rule groups were still being tested.
+	incomplete := !t.Finished()
+
 	if err := t.Error(); err != nil {
 		level.Error(log).Log("msg", "Some error in the test suite", "err", err)
 		os.Exit(1)
@@ -99,12 +142,18 @@ func main() {
 	if !yes {
 		exitCode = 1
 		stream = os.Stderr
-	} else if interrupted {
+	} else if incomplete {
 		exitCode = 1
 		stream = os.Stderr
 		describe = "Test was incomplete"
 	}
 
+	if *failedGroupsFile != "" && !incomplete {
+		if err := writeFailedGroups(*failedGroupsFile, t.FailedGroups()); err != nil {
+			level.Error(log).Log("msg", "Failed to write the failed rule groups", "file", *failedGroupsFile, "err", err)
+		}
+	}
+
 	if len(casesToRun) != len(cases.AllCases()) {
 		describe += "\n\n**NOTE: Not all test cases were run**"
 	}
@@ -112,3 +161,47 @@ func main() {
 	fmt.Fprintln(stream, describe)
 	os.Exit(exitCode)
 }
+
+// printCases writes the name, title and description of all the test cases.
+func printCases(w io.Writer) {
+	names := make([]string, 0, len(cases.AllCasesMap))
+	for name := range cases.AllCasesMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		title, description := cases.AllCasesMap[name].Describe()
+		fmt.Fprintf(w, "%s\n\tTitle: %s\n\t%s\n", name, title, description)
+	}
+}
+
+// writeFailedGroups writes the names of the failed rule groups to the file, one per line.
+func writeFailedGroups(fname string, groups []string) error {
+	var content string
+	for _, gn := range groups {
+		content += gn + "\n"
+	}
+	return os.WriteFile(fname, []byte(content), 0o644)
+}
+
+// failedCases returns the test cases of the rule groups listed in the file written by writeFailedGroups.
+func failedCases(fname string) ([]cases.TestCase, error) {
+	content, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+
+	var casesToRun []cases.TestCase
+	for _, gn := range strings.Fields(string(content)) {
+		tc, ok := cases.AllCasesMap[gn]
+		if !ok {
+			return nil, errors.Errorf("test case %q not found", gn)
+		}
+		casesToRun = append(casesToRun, tc)
+	}
+	if len(casesToRun) == 0 {
+		return nil, errors.New("no failed rule groups to re-run")
+	}
+	return casesToRun, nil
+}
@@ -9,15 +9,36 @@ import (
 	"github.com/go-kit/log/level"
 	"github.com/prometheus/common/promlog"
 	"github.com/prometheus/compliance/alert_generator/cases"
+	"github.com/prometheus/compliance/alert_generator/config"
 	"github.com/prometheus/prometheus/model/rulefmt"
 	yaml "gopkg.in/yaml.v3"
 )
 
 func main() {
 	rulesFilePath := flag.String("rules-file-path", "./rules.yaml", "File path to write the rules file.")
+	var promtoolTestFiles config.StringsFlag
+	flag.Var(&promtoolTestFiles, "promtool-test-file", "Path to a unit test file for \"promtool test rules\" whose tests are imported as additional test cases. Can be repeated.")
+	configFile := flag.String("config-file", "", "Path to the config file of the tester. If set, its threshold_cases are added to the rules.")
 	flag.Parse()
 	log := promlog.New(&promlog.Config{})
 
+	if err := cases.AddPromtoolTests(promtoolTestFiles...); err != nil {
+		level.Error(log).Log("msg", "Failed to import the promtool tests", "err", err)
+		os.Exit(1)
+	}
+
+	if *configFile != "" {
+		cfg, err := config.LoadFromFile(*configFile)
+		if err != nil {
+			level.Error(log).Log("msg", "Failed to load config file", "err", err)
+			os.Exit(1)
+		}
+		if err := cases.AddThresholdCases(cases.ThresholdCaseOptionsFromConfig(cfg.ThresholdCases)...); err != nil {
+			level.Error(log).Log("msg", "Failed to add the threshold cases of the config file", "err", err)
+			os.Exit(1)
+		}
+	}
+
 	rgs := rulefmt.RuleGroups{
 		Groups: make([]rulefmt.RuleGroup, 0, len(cases.AllCases())),
 	}
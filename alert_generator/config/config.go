@@ -2,10 +2,13 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
 	"github.com/prometheus/common/sigv4"
 	"gopkg.in/yaml.v2"
 )
@@ -15,6 +18,30 @@ type Config struct {
 	Settings  Settings `yaml:"settings"`
 	Auth      Auth     `yaml:"auth"`
 	TestCases []string `yaml:"test_cases"`
+	// ThresholdCases are simple test cases defined in the config in addition to the built-in ones.
+	// They must be in the rules file too, see rule_config_builder.
+	ThresholdCases []ThresholdCase `yaml:"threshold_cases"`
+}
+
+// ThresholdCase defines a test case with a single alerting rule that is active while a synthetic
+// series is above a threshold.
+type ThresholdCase struct {
+	// Name is the name of the test case and its rule group, as used in test_cases.
+	Name string `yaml:"name"`
+	// MetricName is the name of the synthetic series. Default: alert_generator_test_suite.
+	MetricName string `yaml:"metric_name"`
+	// Samples are the values of the series, one every sample_interval starting at the beginning of the test.
+	// Every value is either "V", an absolute value, or "AxB", B samples each incremented by A, e.g. "0x10".
+	// The last sample must not be above the threshold.
+	Samples []string `yaml:"samples"`
+	// Threshold is the value the series must be above for the alert to be active.
+	Threshold float64 `yaml:"threshold"`
+	// For is the 'for' duration of the alerting rule.
+	For model.Duration `yaml:"for"`
+	// SampleInterval is the interval between the samples. Default: 15s.
+	SampleInterval model.Duration `yaml:"sample_interval"`
+	// GroupInterval is the evaluation interval of the rule group. Default: 30s.
+	GroupInterval model.Duration `yaml:"group_interval"`
 }
 
 type Settings struct {
@@ -32,6 +59,51 @@ type Settings struct {
 	DisableAlertsMetricsCheck   bool `yaml:"disable_alerts_metrics_check"`
 	DisableAlertsReceptionCheck bool `yaml:"disable_alerts_reception_check"`
 
+	// APICheckStabilizationWindow is the time within which the alerts and rules APIs are polled again
+	// if their response does not match the expectation, before the check is considered as failed.
+	// This is for engines whose API is updated slightly after the rule evaluation. It should be well below
+	// the rule groups' evaluation interval. Default: 0 (disabled).
+	APICheckStabilizationWindow model.Duration `yaml:"api_check_stabilization_window"`
+
+	// ClockSkewTolerance is added to every timing tolerance when matching the received alerts, to compensate
+	// for the clock of the engine being skewed w.r.t. the clock of the tester. It does not relax what is
+	// considered correct behaviour and should be set to the expected skew only. Default: 0 (no skew).
+	ClockSkewTolerance model.Duration `yaml:"clock_skew_tolerance"`
+
+	// AnnotationSizeLimit is the size in bytes to which the engine, or a proxy in between, truncates the
+	// annotation values of the alerts it sends. Received annotation values longer than that are expected
+	// to be truncated to it, optionally ending with an ellipsis. Prometheus sends the annotations whole.
+	// Default: 0 (no limit).
+	AnnotationSizeLimit int `yaml:"annotation_size_limit"`
+
+	// TolerateMissingRuleGroups is the time for which a rule group under test may be missing from the
+	// rules API response before it is considered as absent and the check fails. In the meantime the
+	// rule group is treated as not loaded yet and checked again in the next poll. This is for engines
+	// that load or list the rule groups asynchronously. Default: 0 (a missing rule group fails immediately).
+	TolerateMissingRuleGroups model.Duration `yaml:"tolerate_missing_rule_groups"`
+
+	// CheckRuleEvaluationTimestamps enables checking the lastEvaluation and evaluationTime of the rule groups
+	// and their rules in the rules API: the last evaluation must advance by multiples of the group interval
+	// between polls and the evaluation times must be plausible. This catches engines that stall evaluations
+	// or report bogus evaluation times. Default: false.
+	CheckRuleEvaluationTimestamps bool `yaml:"check_rule_evaluation_timestamps"`
+
+	// IngestionProbeTimeout is the time within which the series of the test cases that are remote written
+	// at the start of the test must be returned by the query API, before any check starts. This fails the
+	// test with a single clear error if the engine does not ingest the samples, e.g. because of a wrong
+	// remote write URL or credentials. Default: 0 (disabled).
+	IngestionProbeTimeout model.Duration `yaml:"ingestion_probe_timeout"`
+
+	// RequestTimeout is the timeout of every request to the rules, alerts and query APIs. Default: 30s.
+	RequestTimeout model.Duration `yaml:"request_timeout"`
+	// ProxyURL is the URL of the HTTP proxy used for the requests to the rules, alerts and query APIs.
+	// Default: none, the proxy from the environment is used.
+	ProxyURL string `yaml:"proxy_url"`
+	// DisableKeepAlives disables the reuse of connections between the requests to the APIs.
+	DisableKeepAlives bool `yaml:"disable_keep_alives"`
+	// IdleConnTimeout is the time after which idle connections to the APIs are closed. Default: 90s.
+	IdleConnTimeout model.Duration `yaml:"idle_conn_timeout"`
+
 	AlertMessageParser string `yaml:"alert_message_parser"`
 
 	//APIHeaders         map[string]string `yaml:"api_headers"`
@@ -45,10 +117,15 @@ type Auth struct {
 	Query             AuthConfig `yaml:"query"`
 }
 
+// TenantHeader is the HTTP header used by multi-tenant backends to identify the tenant.
+const TenantHeader = "X-Scope-OrgID"
+
 type AuthConfig struct {
 	SigV4Config   *sigv4.SigV4Config `yaml:"sigv4"`
 	BasicAuthUser string             `yaml:"basic_auth_user"`
 	BasicAuthPass string             `yaml:"basic_auth_pass"`
+	// Tenant is set as the TenantHeader of every request, if not empty.
+	Tenant string `yaml:"tenant"`
 }
 
 func validateConfig(cfg *Config) (*Config, error) {
@@ -71,6 +148,17 @@ func validateConfig(cfg *Config) (*Config, error) {
 	if cfg.Settings.RulesAndAlertsAPIBaseURL == "" {
 		return nil, errors.New("rules_and_alerts_api_base_url is not set")
 	}
+	if cfg.Settings.RequestTimeout == 0 {
+		cfg.Settings.RequestTimeout = model.Duration(30 * time.Second)
+	}
+	if cfg.Settings.IdleConnTimeout == 0 {
+		cfg.Settings.IdleConnTimeout = model.Duration(90 * time.Second)
+	}
+	if cfg.Settings.ProxyURL != "" {
+		if _, err := url.Parse(cfg.Settings.ProxyURL); err != nil {
+			return nil, errors.Wrapf(err, "parsing proxy_url %q", cfg.Settings.ProxyURL)
+		}
+	}
 	if cfg.Settings.AlertReceptionServerPort == "" {
 		cfg.Settings.AlertReceptionServerPort = "8080"
 	}
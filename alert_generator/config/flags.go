@@ -0,0 +1,15 @@
+package config
+
+import "strings"
+
+// StringsFlag is a command line flag that can be repeated, collecting all its values.
+type StringsFlag []string
+
+func (f *StringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *StringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
@@ -0,0 +1,46 @@
+package testsuite
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// metrics are the metrics of the test suite itself, exposed on the /metrics
+// endpoint of the alert reception server. Every test suite has its own
+// registry, so several test suites can run in the same process.
+type metrics struct {
+	reg *prometheus.Registry
+
+	groupsPassed     prometheus.Counter
+	groupsFailed     prometheus.Counter
+	alertsReceived   prometheus.Counter
+	alertsUnexpected prometheus.Counter
+}
+
+func newMetrics(groupsRunning func() float64) *metrics {
+	reg := prometheus.NewRegistry()
+	m := &metrics{
+		reg: reg,
+		groupsPassed: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "compliance_groups_passed_total",
+			Help: "Total number of rule groups that finished without errors in the API checks.",
+		}),
+		groupsFailed: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "compliance_groups_failed_total",
+			Help: "Total number of rule groups that failed an API check.",
+		}),
+		alertsReceived: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "compliance_alerts_received_total",
+			Help: "Total number of alerts received by the alert reception server.",
+		}),
+		alertsUnexpected: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "compliance_alerts_unexpected_total",
+			Help: "Total number of received alerts that were not expected at the time they were received.",
+		}),
+	}
+	promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "compliance_groups_running",
+		Help: "Number of rule groups whose test is still running.",
+	}, groupsRunning)
+	return m
+}
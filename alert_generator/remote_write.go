@@ -34,6 +34,10 @@ func NewRemoteWriter(cfg agconfig.Config, logger log.Logger) (*RemoteWriter, err
 			Password: config.Secret(cfg.Auth.RemoteWrite.BasicAuthPass),
 		}
 	}
+	var headers map[string]string
+	if cfg.Auth.RemoteWrite.Tenant != "" {
+		headers = map[string]string{agconfig.TenantHeader: cfg.Auth.RemoteWrite.Tenant}
+	}
 	client, err := remote.NewWriteClient("alert-generator-test-suite", &remote.ClientConfig{
 		URL:              &config.URL{URL: u},
 		Timeout:          model.Duration(4 * time.Second),
@@ -42,6 +46,7 @@ func NewRemoteWriter(cfg agconfig.Config, logger log.Logger) (*RemoteWriter, err
 			BasicAuth: baseAuth,
 		},
 		SigV4Config: cfg.Auth.RemoteWrite.SigV4Config,
+		Headers:     headers,
 	})
 	if err != nil {
 		return nil, err
@@ -0,0 +1,149 @@
+//go:build selftest
+// +build selftest
+
+package testsuite
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/promlog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/compliance/alert_generator/cases"
+	"github.com/prometheus/compliance/alert_generator/config"
+)
+
+const (
+	selfTestPrometheusVersion = "2.53.2"
+	selfTestPrometheusURL     = "https://github.com/prometheus/prometheus/releases/download/v%[1]s/prometheus-%[1]s.%[2]s-%[3]s.tar.gz"
+)
+
+// TestSelf runs all the test cases against upstream Prometheus, which is the reference implementation
+// of the specification. A failure means that the test cases themselves are wrong.
+// It takes as long as a regular run of the test suite.
+func TestSelf(t *testing.T) {
+	binary, err := downloadPrometheus(filepath.Join("bin", "prometheus-"+selfTestPrometheusVersion))
+	require.NoError(t, err)
+
+	rulesFile, err := filepath.Abs("rules.yaml")
+	require.NoError(t, err)
+	cfg, err := config.LoadFromFile("test-prometheus.yaml")
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	promCfg := fmt.Sprintf(`
+rule_files:
+  - %q
+alerting:
+  alertmanagers:
+    - static_configs:
+        - targets: ['localhost:%s']
+`, rulesFile, cfg.Settings.AlertReceptionServerPort)
+	promCfgFile := filepath.Join(dir, "prometheus.yaml")
+	require.NoError(t, os.WriteFile(promCfgFile, []byte(promCfg), 0o644))
+
+	cmd := exec.Command(binary,
+		"--config.file="+promCfgFile,
+		"--storage.tsdb.path="+filepath.Join(dir, "data"),
+		"--web.listen-address=localhost:9090",
+		"--web.enable-remote-write-receiver",
+	)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	require.NoError(t, cmd.Start())
+	t.Cleanup(func() {
+		_ = cmd.Process.Signal(os.Interrupt)
+		_ = cmd.Wait()
+	})
+	require.NoError(t, waitForReady(cfg.Settings.QueryBaseURL+"/-/ready", time.Minute))
+
+	ts, err := NewTestSuite(TestSuiteOptions{
+		Logger:             promlog.New(&promlog.Config{}),
+		Cases:              cases.AllCases(),
+		Config:             *cfg,
+		AlertMessageParser: AlertMessageParsers["default"],
+	})
+	require.NoError(t, err)
+
+	ts.Start()
+	ts.Wait()
+	require.NoError(t, ts.Error())
+	yes, describe := ts.WasTestSuccessful()
+	require.True(t, yes, describe)
+}
+
+// downloadPrometheus downloads the Prometheus release for the current platform to the given path,
+// unless it already exists, and returns the path of the binary.
+func downloadPrometheus(dest string) (string, error) {
+	if _, err := os.Stat(dest); err == nil {
+		return dest, nil
+	}
+
+	url := fmt.Sprintf(selfTestPrometheusURL, selfTestPrometheusVersion, runtime.GOOS, runtime.GOARCH)
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", errors.Wrapf(err, "downloading %s", url)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("downloading %s: status code %d", url, resp.StatusCode)
+	}
+
+	gzr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return "", errors.Wrapf(err, "decompressing %s", url)
+	}
+	tr := tar.NewReader(gzr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return "", errors.Errorf("prometheus binary not found in %s", url)
+		}
+		if err != nil {
+			return "", errors.Wrapf(err, "reading %s", url)
+		}
+		if hdr.Typeflag != tar.TypeReg || filepath.Base(hdr.Name) != "prometheus" {
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+			return "", err
+		}
+		f, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o755)
+		if err != nil {
+			return "", err
+		}
+		if _, err := io.Copy(f, tr); err != nil {
+			f.Close()
+			os.Remove(dest)
+			return "", errors.Wrapf(err, "extracting %s", hdr.Name)
+		}
+		return dest, f.Close()
+	}
+}
+
+// waitForReady polls the URL until it returns 200 or the timeout expires.
+func waitForReady(url string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		resp, err := http.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+		time.Sleep(time.Second)
+	}
+	return errors.Errorf("%s not ready after %s", url, timeout)
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/compliance/alert_generator/cases"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/notifier"
@@ -27,9 +28,19 @@ type alertsServer struct {
 
 	expectedAlertsMtx sync.Mutex
 	expectedAlerts    map[string]*expectedAlerts
+	// lastMatched is the time at which an alert last matched an expected alert, by its
+	// labels. It is used to tell duplicates apart from other unexpected alerts.
+	lastMatched map[string]time.Time
 
 	messageParser AlertMessageParser
 
+	metrics *metrics
+
+	// clockSkewTolerance is set on all the expected alerts.
+	clockSkewTolerance time.Duration
+	// annotationSizeLimit is set on all the expected alerts.
+	annotationSizeLimit int
+
 	errsMtx sync.Mutex
 	errs    map[string]*allErrs
 
@@ -62,21 +73,32 @@ type matchingErr struct {
 type unexpectedErr struct {
 	t     time.Time
 	alert notifier.Alert
+	// duplicateOf is the time at which the same alert was received within
+	// the last resend delay, if any.
+	duplicateOf time.Time
 }
 
 // TODO: assumes resend delay of 1m.
-func newAlertsServer(port string, disabled bool, logger log.Logger, messageParser AlertMessageParser) *alertsServer {
+func newAlertsServer(port string, disabled bool, clockSkewTolerance time.Duration, annotationSizeLimit int, logger log.Logger, messageParser AlertMessageParser, m *metrics) *alertsServer {
 	as := &alertsServer{
-		logger:         log.With(logger, "component", "alertsServer"),
-		errs:           make(map[string]*allErrs),
-		expectedAlerts: make(map[string]*expectedAlerts),
-		closeC:         make(chan struct{}),
-		disabled:       disabled,
-		messageParser:  messageParser,
+		logger:              log.With(logger, "component", "alertsServer"),
+		errs:                make(map[string]*allErrs),
+		expectedAlerts:      make(map[string]*expectedAlerts),
+		lastMatched:         make(map[string]time.Time),
+		closeC:              make(chan struct{}),
+		disabled:            disabled,
+		messageParser:       messageParser,
+		clockSkewTolerance:  clockSkewTolerance,
+		annotationSizeLimit: annotationSizeLimit,
+		metrics:             m,
 	}
+	// The metrics of the test suite are served alongside, every other path receives alerts.
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.reg, promhttp.HandlerOpts{}))
+	mux.Handle("/", as)
 	as.server = &http.Server{
 		Addr:         ":" + port, // TODO: take this as a config.
-		Handler:      as,
+		Handler:      mux,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
 	}
@@ -107,6 +129,7 @@ func (as *alertsServer) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 	}
 
 	level.Info(as.logger).Log("msg", "Received alerts", "num_alerts", len(alerts))
+	as.metrics.alertsReceived.Add(float64(len(alerts)))
 	as.expectedAlertsMtx.Lock()
 
 	var addBack []cases.ExpectedAlert
@@ -119,10 +142,16 @@ func (as *alertsServer) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 		exp := as.getPossibleAlert(now, id)
 		errs := as.getErr(al.Labels.Get("rulegroup"))
 		if len(exp) == 0 {
-			errs.unexpectedAlerts = append(errs.unexpectedAlerts, unexpectedErr{
+			as.metrics.alertsUnexpected.Inc()
+			ue := unexpectedErr{
 				t:     now,
 				alert: al,
-			})
+			}
+			// The alert was already sent and should not be sent again before the resend delay.
+			if last, ok := as.lastMatched[id]; ok && now.Sub(last) < cases.ResendDelay-cases.MaxRTT {
+				ue.duplicateOf = last
+			}
+			errs.unexpectedAlerts = append(errs.unexpectedAlerts, ue)
 			continue
 		}
 
@@ -133,6 +162,7 @@ func (as *alertsServer) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 			if err == nil {
 				// We found a match.
 				success[id] = ex
+				as.lastMatched[id] = now
 				idx = i
 				me = nil
 				break
@@ -219,6 +249,8 @@ func (as *alertsServer) getErr(rg string) *allErrs {
 func (as *alertsServer) addExpectedAlerts(alerts ...cases.ExpectedAlert) {
 	seen := make(map[string]struct{})
 	for _, a := range alerts {
+		a.ClockSkewTolerance = as.clockSkewTolerance
+		a.AnnotationSizeLimit = as.annotationSizeLimit
 		id := a.Alert.Labels.String()
 		ea := as.expectedAlerts[id]
 		if ea == nil {
@@ -252,12 +284,12 @@ func (as *alertsServer) getPossibleAlert(now time.Time, lblsString string) []cas
 				continue
 			}
 			// For the first alert that comes, the remote write RTT can add to some delay. Hence 2*RTT.
-			tolerance := ea.TimeTolerance + (2 * cases.MaxRTT)
+			tolerance := ea.TimeTolerance + ea.ClockSkewTolerance + (2 * cases.MaxRTT)
 			if ea.Ts.Add(tolerance).Before(now) {
 				if !ea.CanBeIgnored() {
 					missedAlerts = append(missedAlerts, ea)
 				}
-			} else if id == lblsString && now.After(ea.Ts) && now.Before(ea.Ts.Add(tolerance)) {
+			} else if id == lblsString && now.After(ea.Ts.Add(-ea.ClockSkewTolerance)) && now.Before(ea.Ts.Add(tolerance)) {
 				alerts = append(alerts, ea)
 			} else {
 				newExpAlerts = append(newExpAlerts, ea)
@@ -282,7 +314,7 @@ func (as *alertsServer) missedAlertCleanup(now time.Time) {
 				continue
 			}
 			// For the first alert that comes, the remote write RTT can add to some delay. Hence 2*RTT.
-			if ea.Ts.Add(ea.TimeTolerance + (2 * cases.MaxRTT)).Before(now) {
+			if ea.Ts.Add(ea.TimeTolerance + ea.ClockSkewTolerance + (2 * cases.MaxRTT)).Before(now) {
 				if !ea.CanBeIgnored() {
 					missedAlerts = append(missedAlerts, ea)
 				}
@@ -0,0 +1,117 @@
+package testsuite
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/compliance/alert_generator/cases"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlertsServerMatchingIsOrderIndependent(t *testing.T) {
+	orders := [][]int{
+		{0, 1, 2},
+		{2, 1, 0},
+		{1, 2, 0},
+	}
+	for _, order := range orders {
+		now := time.Now().UTC()
+		tc := cases.SimultaneousAlerts()
+		// The alerts of the test case start firing 20 samples after the zero time.
+		tc.Init(timestamp.FromTime(now.Add(-20 * 15 * time.Second)))
+
+		var firing []notifier.Alert
+		for _, ea := range tc.ExpectedAlerts() {
+			if !ea.Resolved && !ea.Resend {
+				firing = append(firing, notifier.Alert{
+					Labels:      ea.Alert.Labels,
+					Annotations: ea.Alert.Annotations,
+					// The engine evaluates the rule a little after the expected time.
+					StartsAt: ea.Alert.StartsAt.Add(time.Second),
+					EndsAt:   now.Add(ea.EndsAtDelta),
+				})
+			}
+		}
+		require.Len(t, firing, len(order))
+
+		var payload []notifier.Alert
+		for _, i := range order {
+			payload = append(payload, firing[i])
+		}
+		b, err := json.Marshal(payload)
+		require.NoError(t, err)
+
+		as := newAlertsServer("0", false, 0, 0, log.NewNopLogger(), AlertMessageParsers["default"],
+			newMetrics(func() float64 { return 0 }))
+		as.addExpectedAlerts(tc.ExpectedAlerts()...)
+
+		rec := httptest.NewRecorder()
+		as.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b)))
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Empty(t, as.groupsFacingErrors(), "order %v", order)
+	}
+}
+
+func TestAlertsServerFlagsDuplicates(t *testing.T) {
+	now := time.Now().UTC()
+	tc := cases.Firing_NoDuplicates()
+	// The alert of the test case starts firing 8 samples after the zero time.
+	tc.Init(timestamp.FromTime(now.Add(-8 * 15 * time.Second)))
+
+	var firing []notifier.Alert
+	for _, ea := range tc.ExpectedAlerts() {
+		if !ea.Resolved && !ea.Resend {
+			firing = append(firing, notifier.Alert{
+				Labels:      ea.Alert.Labels,
+				Annotations: ea.Alert.Annotations,
+				StartsAt:    ea.Alert.StartsAt.Add(time.Second),
+				EndsAt:      now.Add(ea.EndsAtDelta),
+			})
+		}
+	}
+	require.Len(t, firing, 1)
+	b, err := json.Marshal(firing)
+	require.NoError(t, err)
+
+	as := newAlertsServer("0", false, 0, 0, log.NewNopLogger(), AlertMessageParsers["default"],
+		newMetrics(func() float64 { return 0 }))
+	as.addExpectedAlerts(tc.ExpectedAlerts()...)
+
+	rec := httptest.NewRecorder()
+	as.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b)))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Empty(t, as.groupsFacingErrors())
+
+	// The same alert again within the resend delay.
+	rec = httptest.NewRecorder()
+	as.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b)))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	errs := as.groupError()["Firing_NoDuplicates"]
+	require.NotNil(t, errs)
+	require.Len(t, errs.unexpectedAlerts, 1)
+	require.False(t, errs.unexpectedAlerts[0].duplicateOf.IsZero(), "alert not flagged as duplicate")
+	require.Empty(t, errs.missedAlerts)
+	require.Empty(t, errs.matchingErrs)
+}
+
+func TestAlertsServerMetrics(t *testing.T) {
+	// Every alerts server serves the metrics of its own test suite only.
+	for i := 0; i < 2; i++ {
+		as := newAlertsServer("0", false, 0, 0, log.NewNopLogger(), AlertMessageParsers["default"],
+			newMetrics(func() float64 { return 1 }))
+
+		rec := httptest.NewRecorder()
+		as.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Contains(t, rec.Body.String(), "compliance_groups_running 1")
+		require.NotContains(t, rec.Body.String(), "go_goroutines")
+	}
+}
@@ -2,8 +2,10 @@ package testsuite
 
 import (
 	"fmt"
+	"net/http"
 	"net/url"
 	"path"
+	"sort"
 	"sync"
 	"time"
 
@@ -11,8 +13,11 @@ import (
 	"github.com/go-kit/log/level"
 	"github.com/pkg/errors"
 	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/rulefmt"
 	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/prompb"
+	v1 "github.com/prometheus/prometheus/web/api/v1"
 
 	"github.com/prometheus/compliance/alert_generator/cases"
 	"github.com/prometheus/compliance/alert_generator/config"
@@ -24,10 +29,16 @@ type TestSuite struct {
 	opts                      TestSuiteOptions
 	alertsAPIURL, rulesAPIURL string
 	promqlURL                 *url.URL
+	httpClient                *http.Client // For all the API requests.
 
 	remoteWriter         *RemoteWriter
 	remoteWriteStartTime time.Time
 
+	// probeSeries is the number of series of the test cases with the source metric name that are
+	// remote written at the start of the test, which the ingestion probe waits for.
+	probeSeries int
+	probeErr    error
+
 	as *alertsServer
 
 	ruleGroupTestsMtx   sync.RWMutex
@@ -36,6 +47,15 @@ type TestSuite struct {
 
 	minGroupInterval model.Duration
 
+	// missingRuleGroupsSince is the time since when a rule group is missing from the rules API response.
+	// It is only accessed from the rules check loop.
+	missingRuleGroupsSince map[string]time.Time
+	// lastEvaluations is the last evaluation time of a rule group in the previous rules API response.
+	// It is only accessed from the rules check loop.
+	lastEvaluations map[string]time.Time
+
+	metrics *metrics
+
 	stopc chan struct{}
 	wg    sync.WaitGroup
 }
@@ -57,12 +77,20 @@ func NewTestSuite(opts TestSuiteOptions) (*TestSuite, error) {
 	}
 
 	m := &TestSuite{
-		logger:              log.With(opts.Logger, "component", "testsuite"),
-		opts:                opts,
-		ruleGroupTests:      make(map[string]cases.TestCase, len(opts.Cases)),
-		ruleGroupTestErrors: make(map[string][]error),
-		stopc:               make(chan struct{}),
-		as:                  newAlertsServer(opts.Config.Settings.AlertReceptionServerPort, opts.Config.Settings.DisableAlertsReceptionCheck, opts.Logger, opts.AlertMessageParser),
+		logger:                 log.With(opts.Logger, "component", "testsuite"),
+		opts:                   opts,
+		ruleGroupTests:         make(map[string]cases.TestCase, len(opts.Cases)),
+		ruleGroupTestErrors:    make(map[string][]error),
+		missingRuleGroupsSince: make(map[string]time.Time),
+		lastEvaluations:        make(map[string]time.Time),
+		stopc:                  make(chan struct{}),
+	}
+	m.metrics = newMetrics(m.groupsRunning)
+	m.as = newAlertsServer(opts.Config.Settings.AlertReceptionServerPort, opts.Config.Settings.DisableAlertsReceptionCheck, time.Duration(opts.Config.Settings.ClockSkewTolerance), opts.Config.Settings.AnnotationSizeLimit, opts.Logger, opts.AlertMessageParser, m.metrics)
+
+	m.httpClient, err = NewHTTPClient(opts.Config.Settings)
+	if err != nil {
+		return nil, errors.Wrap(err, "create HTTP client")
 	}
 
 	m.remoteWriter, err = NewRemoteWriter(opts.Config, opts.Logger)
@@ -71,7 +99,9 @@ func NewTestSuite(opts TestSuiteOptions) (*TestSuite, error) {
 	}
 
 	for i, c := range opts.Cases {
-		m.remoteWriter.AddTimeSeries(c.SamplesToRemoteWrite())
+		series := c.SamplesToRemoteWrite()
+		m.remoteWriter.AddTimeSeries(series)
+		m.probeSeries += countProbeSeries(series)
 		groupName, _ := c.Describe()
 		m.ruleGroupTests[groupName] = c
 
@@ -200,6 +230,16 @@ func (ts *TestSuite) Start() {
 
 	time.Sleep(15 * time.Second / 2)
 
+	if timeout := time.Duration(ts.opts.Config.Settings.IngestionProbeTimeout); timeout > 0 {
+		level.Info(ts.logger).Log("msg", "Waiting for the engine to ingest the remote written series", "series", ts.probeSeries, "timeout", timeout)
+		if err := ts.probeIngestion(timeout); err != nil {
+			level.Error(ts.logger).Log("msg", "Ingestion probe failed, stopping the test", "err", err)
+			ts.probeErr = err
+			ts.Stop()
+			return
+		}
+	}
+
 	if !ts.opts.Config.Settings.DisableAlertsAPICheck {
 		ts.wg.Add(1)
 		go ts.checkAlertsLoop()
@@ -222,35 +262,23 @@ func (ts *TestSuite) checkAlertsLoop() {
 	defer ts.wg.Done()
 
 	ts.loopTillItsOver(func() {
-		nowTs := timestamp.FromTime(time.Now())
-
-		b, err := DoGetRequest(ts.alertsAPIURL, ts.opts.Config.Auth.RulesAndAlertsAPI)
-		if err != nil {
-			level.Error(ts.logger).Log("msg", "Error in fetching alerts", "url", ts.alertsAPIURL, "err", err)
-			return
-		}
-
-		mappedAlerts, err := ParseAndGroupAlerts(b)
-		if err != nil {
-			level.Error(ts.logger).Log("msg", "Error in parsing alerts response", "url", ts.alertsAPIURL, "err", err)
-			return
-		}
-
-		groupsToRemove := make(map[string]error)
-		ts.ruleGroupTestsMtx.RLock()
-		for groupName, c := range ts.ruleGroupTests {
-			if c.TestUntil() < nowTs {
-				groupsToRemove[groupName] = nil
-				continue
+		ts.checkGroups(func() (groupCheckFunc, error) {
+			b, err := DoGetRequest(ts.httpClient, ts.alertsAPIURL, ts.opts.Config.Auth.RulesAndAlertsAPI)
+			if err != nil {
+				level.Error(ts.logger).Log("msg", "Error in fetching alerts", "url", ts.alertsAPIURL, "err", err)
+				return nil, err
 			}
-			err := c.CheckAlerts(nowTs, mappedAlerts[groupName])
+
+			mappedAlerts, err := ParseAndGroupAlerts(b)
 			if err != nil {
-				groupsToRemove[groupName] = err
+				level.Error(ts.logger).Log("msg", "Error in parsing alerts response", "url", ts.alertsAPIURL, "err", err)
+				return nil, err
 			}
-		}
-		ts.ruleGroupTestsMtx.RUnlock()
 
-		ts.removeGroups(groupsToRemove)
+			return func(groupName string, c cases.TestCase, nowTs int64) error {
+				return c.CheckAlerts(nowTs, mappedAlerts[groupName])
+			}, nil
+		})
 	})
 }
 
@@ -258,36 +286,230 @@ func (ts *TestSuite) checkRulesLoop() {
 	defer ts.wg.Done()
 
 	ts.loopTillItsOver(func() {
-		nowTs := timestamp.FromTime(time.Now())
+		ts.checkGroups(func() (groupCheckFunc, error) {
+			b, err := DoGetRequest(ts.httpClient, ts.rulesAPIURL, ts.opts.Config.Auth.RulesAndAlertsAPI)
+			if err != nil {
+				level.Error(ts.logger).Log("msg", "Error in fetching rules", "url", ts.rulesAPIURL, "err", err)
+				return nil, err
+			}
 
-		b, err := DoGetRequest(ts.rulesAPIURL, ts.opts.Config.Auth.RulesAndAlertsAPI)
-		if err != nil {
-			level.Error(ts.logger).Log("msg", "Error in fetching rules", "url", ts.rulesAPIURL, "err", err)
-			return
+			mappedGroups, err := ParseAndGroupRules(b)
+			if err != nil {
+				level.Error(ts.logger).Log("msg", "Error in parsing rules response", "url", ts.rulesAPIURL, "err", err)
+				return nil, err
+			}
+
+			return func(groupName string, c cases.TestCase, nowTs int64) error {
+				rg, ok := mappedGroups[groupName]
+				if !ok && ts.ruleGroupTransientlyMissing(groupName, nowTs) {
+					return nil
+				}
+				if ok {
+					delete(ts.missingRuleGroupsSince, groupName)
+				}
+				if err := c.CheckRuleGroup(nowTs, rg); err != nil {
+					return err
+				}
+				if ok && ts.opts.Config.Settings.CheckRuleEvaluationTimestamps {
+					return ts.checkEvaluationTimestamps(rg, timestamp.Time(nowTs))
+				}
+				return nil
+			}, nil
+		})
+	})
+}
+
+// ruleGroupTransientlyMissing returns true if the rule group, which is missing from the rules API
+// response at nowTs, has been missing for less than the configured tolerance and should be checked
+// again in the next poll instead of failing.
+func (ts *TestSuite) ruleGroupTransientlyMissing(groupName string, nowTs int64) bool {
+	tolerance := time.Duration(ts.opts.Config.Settings.TolerateMissingRuleGroups)
+	if tolerance <= 0 {
+		return false
+	}
+	now := timestamp.Time(nowTs)
+	since, ok := ts.missingRuleGroupsSince[groupName]
+	if !ok {
+		since = now
+		ts.missingRuleGroupsSince[groupName] = since
+	}
+	if now.Sub(since) < tolerance {
+		level.Warn(ts.logger).Log("msg", "Rule group missing from the rules API, checking again", "group", groupName, "missing_for", now.Sub(since))
+		return true
+	}
+	return false
+}
+
+// evaluationScheduleTolerance is how far the evaluations of a rule group may drift from the schedule
+// given by its first observed evaluation and its interval.
+const evaluationScheduleTolerance = time.Second
+
+// checkEvaluationTimestamps checks the evaluation times of the rule group and its rules in the rules API
+// response fetched at now: the last evaluation must not be in the future, must have advanced by a
+// multiple of the group interval since the previous response, and every rule must have been evaluated
+// within the last evaluation of the group or the one in progress. The evaluation time of the group may
+// exceed its interval, e.g. for an expensive query in a short group.
+func (ts *TestSuite) checkEvaluationTimestamps(rg *v1.RuleGroup, now time.Time) error {
+	if rg.LastEvaluation.IsZero() {
+		// Not evaluated yet, the test case checks that the group gets evaluated in time.
+		return nil
+	}
+	itvl := time.Duration(rg.Interval * float64(time.Second))
+	skew := time.Duration(ts.opts.Config.Settings.ClockSkewTolerance)
+
+	if rg.LastEvaluation.After(now.Add(skew)) {
+		return errors.Errorf("last evaluation of the group %s is in the future, now: %s",
+			rg.LastEvaluation.Format(time.RFC3339Nano), now.Format(time.RFC3339Nano))
+	}
+	evalTime := time.Duration(rg.EvaluationTime * float64(time.Second))
+	if evalTime < 0 {
+		return errors.Errorf("evaluation time of the group %s is negative", evalTime)
+	}
+
+	prev, seen := ts.lastEvaluations[rg.Name]
+	ts.lastEvaluations[rg.Name] = rg.LastEvaluation
+	if seen {
+		advanced := rg.LastEvaluation.Sub(prev)
+		if advanced < 0 {
+			return errors.Errorf("last evaluation of the group went back from %s to %s",
+				prev.Format(time.RFC3339Nano), rg.LastEvaluation.Format(time.RFC3339Nano))
 		}
+		if advanced > 0 {
+			// The evaluation time is only approximately aligned to the schedule.
+			intervals := (advanced + itvl/2) / itvl
+			if drift := advanced - intervals*itvl; intervals == 0 || drift < -evaluationScheduleTolerance || drift > evaluationScheduleTolerance {
+				return errors.Errorf("last evaluation of the group advanced by %s from %s to %s, which is not a multiple of the group interval %s",
+					advanced, prev.Format(time.RFC3339Nano), rg.LastEvaluation.Format(time.RFC3339Nano), itvl)
+			}
+		}
+	}
 
-		mappedGroups, err := ParseAndGroupRules(b)
+	for _, r := range rg.Rules {
+		ar, ok := r.(v1.AlertingRule)
+		if !ok {
+			continue
+		}
+		// The last evaluation of a rule is updated as soon as the rule is evaluated, but the one of the group
+		// only once all its rules are, so the rules already evaluated in the evaluation in progress are ahead
+		// of the group by up to the interval and the evaluation time.
+		if ar.LastEvaluation.Before(rg.LastEvaluation.Add(-evaluationScheduleTolerance)) ||
+			ar.LastEvaluation.After(rg.LastEvaluation.Add(itvl+evalTime+evaluationScheduleTolerance)) {
+			return errors.Errorf("last evaluation of the rule %s at %s is not within the last evaluation of the group at %s",
+				ar.Name, ar.LastEvaluation.Format(time.RFC3339Nano), rg.LastEvaluation.Format(time.RFC3339Nano))
+		}
+		if ar.EvaluationTime < 0 || ar.EvaluationTime > rg.EvaluationTime+evaluationScheduleTolerance.Seconds() {
+			return errors.Errorf("evaluation time of the rule %s of %fs is not within the evaluation time of the group of %fs",
+				ar.Name, ar.EvaluationTime, rg.EvaluationTime)
+		}
+	}
+	return nil
+}
+
+// groupCheckFunc checks the API response fetched at nowTs for the given rule group.
+type groupCheckFunc func(groupName string, c cases.TestCase, nowTs int64) error
+
+// stabilizationPollInterval is the interval at which the APIs are polled again within the
+// API check stabilization window.
+const stabilizationPollInterval = 100 * time.Millisecond
+
+// checkGroups fetches an API response with poll and checks it for all the rule groups under test.
+// If the check fails for some groups and the API check stabilization window is set, the API is
+// polled again for those groups until their check passes or the window is over.
+func (ts *TestSuite) checkGroups(poll func() (groupCheckFunc, error)) {
+	start := time.Now()
+	nowTs := timestamp.FromTime(start)
+	check, err := poll()
+	if err != nil {
+		return
+	}
+
+	groupsToRemove := make(map[string]error)
+	failedGroups := make(map[string]cases.TestCase)
+	ts.ruleGroupTestsMtx.RLock()
+	for groupName, c := range ts.ruleGroupTests {
+		if c.TestUntil() < nowTs {
+			groupsToRemove[groupName] = nil
+			continue
+		}
+		err := check(groupName, c, nowTs)
 		if err != nil {
-			level.Error(ts.logger).Log("msg", "Error in parsing rules response", "url", ts.rulesAPIURL, "err", err)
-			return
+			groupsToRemove[groupName] = err
+			failedGroups[groupName] = c
 		}
+	}
+	ts.ruleGroupTestsMtx.RUnlock()
 
-		groupsToRemove := make(map[string]error)
-		ts.ruleGroupTestsMtx.RLock()
-		for groupName, c := range ts.ruleGroupTests {
-			if c.TestUntil() < nowTs {
-				groupsToRemove[groupName] = nil
-				continue
+	deadline := start.Add(time.Duration(ts.opts.Config.Settings.APICheckStabilizationWindow))
+	for len(failedGroups) > 0 && time.Now().Add(stabilizationPollInterval).Before(deadline) {
+		time.Sleep(stabilizationPollInterval)
+		nowTs := timestamp.FromTime(time.Now())
+		check, err := poll()
+		if err != nil {
+			continue
+		}
+		for groupName, c := range failedGroups {
+			if err := check(groupName, c, nowTs); err == nil {
+				// The API converged to an expected state within the window.
+				delete(groupsToRemove, groupName)
+				delete(failedGroups, groupName)
 			}
-			err := c.CheckRuleGroup(nowTs, mappedGroups[groupName])
-			if err != nil {
-				groupsToRemove[groupName] = err
+		}
+	}
+
+	ts.removeGroups(groupsToRemove)
+}
+
+// countProbeSeries returns the number of series with the source metric name whose first sample is
+// remote written at the start of the test.
+func countProbeSeries(series []prompb.TimeSeries) int {
+	n := 0
+	for _, s := range series {
+		if len(s.Samples) == 0 || s.Samples[0].Timestamp != 0 {
+			continue
+		}
+		for _, l := range s.Labels {
+			if l.Name == labels.MetricName && l.Value == cases.SourceTimeSeriesName {
+				n++
+				break
 			}
 		}
-		ts.ruleGroupTestsMtx.RUnlock()
+	}
+	return n
+}
 
-		ts.removeGroups(groupsToRemove)
-	})
+// probeIngestion polls the query API until it returns at least the series that are remote written at the
+// start of the test, and returns an error if it does not within the timeout.
+func (ts *TestSuite) probeIngestion(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	found := 0.0
+	for {
+		u := *ts.promqlURL
+		q := u.Query()
+		q.Set("query", fmt.Sprintf("count(%s)", cases.SourceTimeSeriesName))
+		q.Set("time", time.Now().Format(time.RFC3339))
+		u.RawQuery = q.Encode()
+
+		b, err := DoGetRequest(ts.httpClient, u.String(), ts.opts.Config.Auth.Query)
+		if err != nil {
+			level.Error(ts.logger).Log("msg", "Error in probing the ingestion", "url", u.String(), "err", err)
+		} else if mappedMetrics, err := ParseAndGroupMetrics(b); err != nil {
+			level.Error(ts.logger).Log("msg", "Error in parsing the ingestion probe response", "url", u.String(), "err", err)
+		} else if samples := mappedMetrics[""]; len(samples) > 0 {
+			found = samples[0].V
+		}
+		if found >= float64(ts.probeSeries) {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return errors.Errorf("engine did not ingest %d expected series of %s within %s, found %v", ts.probeSeries, cases.SourceTimeSeriesName, timeout, found)
+		}
+		select {
+		case <-ts.stopc:
+			return errors.New("test stopped during the ingestion probe")
+		case <-time.After(time.Second):
+		}
+	}
 }
 
 func (ts *TestSuite) checkMetricsLoop() {
@@ -302,7 +524,7 @@ func (ts *TestSuite) checkMetricsLoop() {
 		q.Set("time", timestamp.Time(nowTs).Format(time.RFC3339))
 		u.RawQuery = q.Encode()
 
-		b, err := DoGetRequest(u.String(), ts.opts.Config.Auth.Query)
+		b, err := DoGetRequest(ts.httpClient, u.String(), ts.opts.Config.Auth.Query)
 		if err != nil {
 			level.Error(ts.logger).Log("msg", "Error in fetching metrics", "url", u.String(), "err", err)
 			return
@@ -379,19 +601,34 @@ func (ts *TestSuite) removeGroups(groupsToRemove map[string]error) {
 		delete(ts.ruleGroupTests, gn)
 		if err != nil {
 			ts.ruleGroupTestErrors[gn] = append(ts.ruleGroupTestErrors[gn], err)
+			ts.metrics.groupsFailed.Inc()
 			level.Error(ts.logger).Log("msg", "Test failed for a rule group", "rulegroup", gn, "err", err)
 		} else {
+			ts.metrics.groupsPassed.Inc()
 			level.Info(ts.logger).Log("msg", "Test finished successfully for a rule group", "rulegroup", gn)
 		}
 	}
 }
 
+// groupsRunning returns the number of rule groups whose test is still running.
+func (ts *TestSuite) groupsRunning() float64 {
+	ts.ruleGroupTestsMtx.RLock()
+	defer ts.ruleGroupTestsMtx.RUnlock()
+	return float64(len(ts.ruleGroupTests))
+}
+
 func (ts *TestSuite) isOver() bool {
 	ts.ruleGroupTestsMtx.RLock()
 	defer ts.ruleGroupTestsMtx.RUnlock()
 	return len(ts.ruleGroupTests) == 0
 }
 
+// Finished tells if the tests of all the rule groups have finished, either by passing or failing,
+// as opposed to the test suite being stopped while some of them were still running.
+func (ts *TestSuite) Finished() bool {
+	return ts.isOver()
+}
+
 func (ts *TestSuite) Stop() {
 	select {
 	case <-ts.stopc:
@@ -416,14 +653,15 @@ func (ts *TestSuite) Error() error {
 	merr := NewMulti()
 	merr.Add(errors.Wrap(ts.remoteWriter.Error(), "remote writer"))
 	merr.Add(errors.Wrap(ts.as.runningError(), "alert server"))
+	merr.Add(errors.Wrap(ts.probeErr, "ingestion probe"))
 	return merr.Err()
 }
 
 // WasTestSuccessful tells if all the tests passed.
 // It returns an explanation if any test failed.
 // Before calling this method:
-// 	* Error() should be checked for no errors.
-//  * The test should have finished (i.e. Wait() is not blocking).
+//   - Error() should be checked for no errors.
+//   - The test should have finished (i.e. Wait() is not blocking).
 func (ts *TestSuite) WasTestSuccessful() (yes bool, describe string) {
 	select {
 	case <-ts.stopc:
@@ -518,7 +756,7 @@ func (ts *TestSuite) WasTestSuccessful() (yes bool, describe string) {
 			if len(errs.unexpectedAlerts) > 0 {
 				describe += "\tReason: Unexpected alerts (Example: alerts that we didn't expect OR received outside expected time range OR duplicate alerts)\n"
 				for i, alert := range errs.unexpectedAlerts {
-					describe += fmt.Sprintf("\t\t%d: At %s, Labels: %s, Annotations: %s, StartsAt: %s, EndsAt: %s, GeneratorURL: %s\n",
+					describe += fmt.Sprintf("\t\t%d: At %s, Labels: %s, Annotations: %s, StartsAt: %s, EndsAt: %s, GeneratorURL: %s",
 						i+1,
 						alert.t.Format(time.RFC3339Nano),
 						alert.alert.Labels.String(),
@@ -527,6 +765,10 @@ func (ts *TestSuite) WasTestSuccessful() (yes bool, describe string) {
 						alert.alert.EndsAt.Format(time.RFC3339Nano),
 						alert.alert.GeneratorURL,
 					)
+					if !alert.duplicateOf.IsZero() {
+						describe += fmt.Sprintf(", Duplicate of the alert received at %s", alert.duplicateOf.Format(time.RFC3339Nano))
+					}
+					describe += "\n"
 				}
 			}
 
@@ -567,6 +809,28 @@ func (ts *TestSuite) WasTestSuccessful() (yes bool, describe string) {
 	return false, describe
 }
 
+// FailedGroups returns the sorted names of the rule groups that failed any of the checks.
+// It must only be called after the test suite has stopped.
+func (ts *TestSuite) FailedGroups() []string {
+	failed := make(map[string]bool)
+	for gn := range ts.ruleGroupTestErrors {
+		failed[gn] = true
+	}
+	for gn := range ts.as.groupsFacingErrors() {
+		failed[gn] = true
+	}
+	for gn := range ts.as.expectedAlertsError() {
+		failed[gn] = true
+	}
+
+	groups := make([]string, 0, len(failed))
+	for gn := range failed {
+		groups = append(groups, gn)
+	}
+	sort.Strings(groups)
+	return groups
+}
+
 func (ts *TestSuite) TestUntil() time.Time {
 	var tu int64
 	ts.ruleGroupTestsMtx.RLock()
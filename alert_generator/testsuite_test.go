@@ -0,0 +1,121 @@
+package testsuite
+
+import (
+	"testing"
+	"time"
+
+	v1 "github.com/prometheus/prometheus/web/api/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckEvaluationTimestamps(t *testing.T) {
+	now := time.Unix(1000, 0).UTC()
+	group := func(lastEval time.Time, ruleLastEval time.Time) *v1.RuleGroup {
+		return &v1.RuleGroup{
+			Name:           "group",
+			Interval:       30,
+			EvaluationTime: 0.01,
+			LastEvaluation: lastEval,
+			Rules: []v1.Rule{
+				v1.AlertingRule{Name: "alert", EvaluationTime: 0.005, LastEvaluation: ruleLastEval},
+			},
+		}
+	}
+
+	// shortGroup is a group with a 1s interval whose evaluation takes evalTime seconds.
+	shortGroup := func(lastEval, ruleLastEval time.Time, evalTime float64) *v1.RuleGroup {
+		return &v1.RuleGroup{
+			Name:           "short",
+			Interval:       1,
+			EvaluationTime: evalTime,
+			LastEvaluation: lastEval,
+			Rules: []v1.Rule{
+				v1.AlertingRule{Name: "alert", EvaluationTime: evalTime / 2, LastEvaluation: ruleLastEval},
+			},
+		}
+	}
+
+	cases := []struct {
+		name    string
+		polls   []*v1.RuleGroup
+		expErrs []bool
+	}{
+		{
+			name: "advancing by the interval",
+			polls: []*v1.RuleGroup{
+				group(now.Add(-100*time.Second), now.Add(-100*time.Second)),
+				group(now.Add(-100*time.Second), now.Add(-100*time.Second)),
+				group(now.Add(-70*time.Second), now.Add(-70*time.Second)),
+				// Two evaluations later, slightly off the schedule.
+				group(now.Add(-10*time.Second+200*time.Millisecond), now.Add(-10*time.Second+200*time.Millisecond)),
+			},
+			expErrs: []bool{false, false, false, false},
+		},
+		{
+			name: "not a multiple of the interval",
+			polls: []*v1.RuleGroup{
+				group(now.Add(-40*time.Second), now.Add(-40*time.Second)),
+				group(now.Add(-25*time.Second), now.Add(-25*time.Second)),
+			},
+			expErrs: []bool{false, true},
+		},
+		{
+			name: "going back",
+			polls: []*v1.RuleGroup{
+				group(now.Add(-10*time.Second), now.Add(-10*time.Second)),
+				group(now.Add(-40*time.Second), now.Add(-40*time.Second)),
+			},
+			expErrs: []bool{false, true},
+		},
+		{
+			name:    "in the future",
+			polls:   []*v1.RuleGroup{group(now.Add(time.Minute), now.Add(time.Minute))},
+			expErrs: []bool{true},
+		},
+		{
+			name:    "rule evaluated before the group",
+			polls:   []*v1.RuleGroup{group(now.Add(-10*time.Second), now.Add(-40*time.Second))},
+			expErrs: []bool{true},
+		},
+		{
+			// The rule was already evaluated in the evaluation in progress, the group not yet.
+			name: "mid-evaluation snapshot",
+			polls: []*v1.RuleGroup{
+				group(now.Add(-31*time.Second), now.Add(-time.Second+50*time.Millisecond)),
+				shortGroup(now.Add(-2*time.Second), now.Add(-time.Second+300*time.Millisecond), 0.4),
+			},
+			expErrs: []bool{false, false},
+		},
+		{
+			name:    "rule evaluated far after the group",
+			polls:   []*v1.RuleGroup{shortGroup(now.Add(-10*time.Second), now.Add(-5*time.Second), 0.4)},
+			expErrs: []bool{true},
+		},
+		{
+			name: "evaluation longer than the interval",
+			polls: []*v1.RuleGroup{
+				shortGroup(now.Add(-4*time.Second), now.Add(-4*time.Second+500*time.Millisecond), 1.5),
+				shortGroup(now.Add(-2*time.Second), now.Add(-2*time.Second+500*time.Millisecond), 1.5),
+			},
+			expErrs: []bool{false, false},
+		},
+		{
+			name:    "not evaluated yet",
+			polls:   []*v1.RuleGroup{group(time.Time{}, time.Time{})},
+			expErrs: []bool{false},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ts := &TestSuite{lastEvaluations: make(map[string]time.Time)}
+			for i, rg := range c.polls {
+				err := ts.checkEvaluationTimestamps(rg, now)
+				if c.expErrs[i] {
+					require.Error(t, err, "poll %d", i)
+				} else {
+					require.NoError(t, err, "poll %d", i)
+				}
+			}
+		})
+	}
+}
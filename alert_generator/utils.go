@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -18,8 +19,28 @@ import (
 	v1 "github.com/prometheus/prometheus/web/api/v1"
 )
 
-// TODO: add retries and set some timeouts.
-func DoGetRequest(u string, auth config.AuthConfig) ([]byte, error) {
+// NewHTTPClient returns the client for the requests to the rules, alerts and query APIs
+// as configured in the given settings.
+func NewHTTPClient(s config.Settings) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if s.ProxyURL != "" {
+		proxyURL, err := url.Parse(s.ProxyURL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse proxy URL %q", s.ProxyURL)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	transport.DisableKeepAlives = s.DisableKeepAlives
+	transport.IdleConnTimeout = time.Duration(s.IdleConnTimeout)
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   time.Duration(s.RequestTimeout),
+	}, nil
+}
+
+// TODO: add retries.
+func DoGetRequest(client *http.Client, u string, auth config.AuthConfig) ([]byte, error) {
 
 	// Give the GET request empty body instead of nil to avoid segmentation fault
 	// when doing sigv4 signing.
@@ -28,22 +49,27 @@ func DoGetRequest(u string, auth config.AuthConfig) ([]byte, error) {
 		return nil, err
 	}
 
-	client := &http.Client{}
-	transport := client.Transport
+	if auth.Tenant != "" {
+		req.Header.Set(config.TenantHeader, auth.Tenant)
+	}
+
 	if auth.SigV4Config != nil {
-		transport, err = sigv4.NewSigV4RoundTripper(auth.SigV4Config, transport)
+		// Copy the client to not wrap the shared transport for every request.
+		signingClient := *client
+		signingClient.Transport, err = sigv4.NewSigV4RoundTripper(auth.SigV4Config, client.Transport)
 		if err != nil {
 			return nil, err
 		}
+		client = &signingClient
 	} else if auth.BasicAuthUser != "" {
 		req.SetBasicAuth(auth.BasicAuthUser, auth.BasicAuthPass)
 	}
 
-	client.Transport = transport
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, errors.Wrap(err, "get request")
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		return nil, errors.Errorf("non 200 response code %d", resp.StatusCode)
@@ -0,0 +1,57 @@
+// compliance-diff compares the JSON outputs of two runs of the compliance tester, e.g. against two
+// Prometheus versions, and reports the test cases that regressed, were fixed, are new or were removed.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/compliance/promql/output"
+)
+
+func readRun(fileName string) (*output.Run, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening %q", fileName)
+	}
+	defer f.Close()
+
+	run, err := output.ReadRun(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %q", fileName)
+	}
+	return run, nil
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <old run JSON file> <new run JSON file>\n\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "Both runs must have been written by the compliance tester with -output-format=json.")
+		flag.PrintDefaults()
+	}
+	failOnRegression := flag.Bool("fail-on-regression", false, "Exit with status 3 if a test case that passed in the old run failed in the new run, e.g. for \"git bisect run\".")
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	oldRun, err := readRun(flag.Arg(0))
+	if err != nil {
+		log.Fatalf("Error reading old run: %v", err)
+	}
+	newRun, err := readRun(flag.Arg(1))
+	if err != nil {
+		log.Fatalf("Error reading new run: %v", err)
+	}
+
+	d := output.DiffRuns(oldRun, newRun)
+	d.Write(os.Stdout)
+
+	if *failOnRegression && len(d.Regressed) > 0 {
+		os.Exit(3)
+	}
+}
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
+	"io"
 	"log"
 	"math"
 	"net/http"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -18,27 +22,30 @@ import (
 	"github.com/prometheus/compliance/promql/comparer"
 	"github.com/prometheus/compliance/promql/config"
 	"github.com/prometheus/compliance/promql/output"
+	"github.com/prometheus/compliance/promql/seed"
 	"github.com/prometheus/compliance/promql/testcases"
 	"go.uber.org/atomic"
+	"gopkg.in/yaml.v2"
 )
 
 func newPromAPI(targetConfig config.TargetConfig) (v1.API, error) {
 	apiConfig := api.Config{Address: targetConfig.QueryURL}
-	if len(targetConfig.Headers) > 0 || targetConfig.BasicAuthUser != "" {
-		apiConfig.RoundTripper = roundTripperWithSettings{headers: targetConfig.Headers, basicAuthUser: targetConfig.BasicAuthUser, basicAuthPass: targetConfig.BasicAuthPass}
+	if len(targetConfig.Headers) > 0 || targetConfig.BasicAuthUser != "" || targetConfig.Tenant != "" {
+		apiConfig.RoundTripper = roundTripperWithSettings{headers: targetConfig.Headers, basicAuthUser: targetConfig.BasicAuthUser, basicAuthPass: string(targetConfig.BasicAuthPass), tenant: targetConfig.Tenant}
 	}
 	client, err := api.NewClient(apiConfig)
 	if err != nil {
-		return nil, errors.Wrapf(err, "creating Prometheus API client for %q: %v", targetConfig.QueryURL, err)
+		return nil, errors.Wrapf(err, "creating Prometheus API client for %q: %v", config.RedactURL(targetConfig.QueryURL), err)
 	}
 
-	return v1.NewAPI(client), nil
+	return v1.NewAPI(comparer.RecordHTTPMetadata(client)), nil
 }
 
 type roundTripperWithSettings struct {
 	headers       map[string]string
 	basicAuthUser string
 	basicAuthPass string
+	tenant        string
 }
 
 func (rt roundTripperWithSettings) RoundTrip(req *http.Request) (*http.Response, error) {
@@ -50,6 +57,10 @@ func (rt roundTripperWithSettings) RoundTrip(req *http.Request) (*http.Response,
 		req.SetBasicAuth(rt.basicAuthUser, rt.basicAuthPass)
 	}
 
+	if rt.tenant != "" {
+		req.Header.Set(config.TenantHeader, rt.tenant)
+	}
+
 	for key, value := range rt.headers {
 		if strings.ToLower(key) == "host" {
 			req.Host = value
@@ -74,34 +85,72 @@ func (i *arrayFlags) Set(value string) error {
 func main() {
 	var configFiles arrayFlags
 	flag.Var(&configFiles, "config-file", "The path to the configuration file. If repeated, the specified files will be concatenated before YAML parsing.")
-	outputFormat := flag.String("output-format", "text", "The comparison output format. Valid values: [text, html, json]")
+	outputFormat := flag.String("output-format", "text", "The comparison output format. Valid values: [text, html, json, jsonl, tsv]. A comma-separated list writes the results in each of the formats.")
+	outputFile := flag.String("output-file", "", "Comma-separated list of the files to write the output to, one per -output-format. Empty or \"-\" entries write to stdout. Default: stdout for all formats.")
 	outputHTMLTemplate := flag.String("output-html-template", "./output/example-output.html", "The HTML template to use when using HTML as the output format.")
 	outputPassing := flag.Bool("output-passing", false, "Whether to also include passing test cases in the output.")
 	queryParallelism := flag.Int("query-parallelism", 20, "Maximum number of comparison queries to run in parallel.")
+	configCheck := flag.Bool("config-check", false, "Validate the configuration, print the effective configuration with secrets redacted and exit.")
+	listCases := flag.Bool("list-cases", false, "Print the query templates of all the test cases of the configuration with their variant arguments and exit.")
+	maxFailures := flag.Int("max-failures", 0, "Abort the remaining comparisons once this many test cases have failed and output the partial results. 0 means no limit.")
+	profile := flag.String("profile", "", fmt.Sprintf("The bundled profile of query tweaks and known differences for a backend to add to the configuration, which overrides it. Valid values: %v.", config.Profiles()))
 	flag.Parse()
 
-	var outp output.Outputter
-	switch *outputFormat {
-	case "text":
-		outp = output.Text
-	case "html":
-		var err error
-		outp, err = output.HTML(*outputHTMLTemplate)
+	cfg, err := config.LoadFromFiles(configFiles)
+	if err != nil {
+		log.Fatalf("Error loading configuration file: %v", err)
+	}
+	if *profile != "" {
+		p, err := config.LoadProfile(*profile)
 		if err != nil {
-			log.Fatalf("Error reading output HTML template: %v", err)
+			log.Fatalf("Error loading profile: %v", err)
 		}
-	case "json":
-		outp = output.JSON
-	case "tsv":
-		outp = output.TSV
-	default:
-		log.Fatalf("Invalid output format %q", *outputFormat)
+		cfg.ApplyProfile(p)
 	}
 
-	cfg, err := config.LoadFromFiles(configFiles)
+	end := getTime(cfg.QueryTimeParameters.EndTime, time.Now().UTC().Add(-12*time.Minute))
+	start := end.Add(
+		-getNonZeroDuration(cfg.QueryTimeParameters.RangeInSeconds, 10*time.Minute))
+	resolution := getNonZeroDuration(
+		cfg.QueryTimeParameters.ResolutionInSeconds, 10*time.Second)
+	chunk := time.Duration(cfg.QueryTimeParameters.ChunkInSeconds * float64(time.Second))
+
+	windows, err := timeWindows(cfg.QueryTimeParameters.TimeWindows, start, end)
 	if err != nil {
-		log.Fatalf("Error loading configuration file: %v", err)
+		log.Fatalf("Error parsing time windows: %v", err)
+	}
+
+	if *configCheck {
+		if err := printEffectiveConfig(os.Stdout, cfg, start, end, resolution); err != nil {
+			log.Fatalf("Error printing effective configuration: %v", err)
+		}
+		return
+	}
+
+	if *listCases {
+		printTestCases(os.Stdout, cfg.TestCases)
+		return
+	}
+
+	// The output files are only created once it's clear that the test cases will be run, so that checking
+	// the configuration or listing the test cases doesn't truncate the results of a previous run.
+	streams, batches, files, err := newOutputs(*outputFormat, *outputFile, *outputHTMLTemplate, *outputPassing)
+	if err != nil {
+		log.Fatalf("Error setting up the output: %v", err)
 	}
+	defer func() {
+		for _, f := range files {
+			if err := f.Close(); err != nil {
+				log.Printf("Error closing output file: %v", err)
+			}
+		}
+	}()
+	// Formats that don't need the full set of results write them out as they complete.
+	var streamOutp output.StreamingOutputter
+	if len(streams) > 0 {
+		streamOutp = output.Multi(streams...)
+	}
+
 	refAPI, err := newPromAPI(cfg.ReferenceTargetConfig)
 	if err != nil {
 		log.Fatalf("Error creating reference API: %v", err)
@@ -111,51 +160,296 @@ func main() {
 		log.Fatalf("Error creating test API: %v", err)
 	}
 
-	comp := comparer.New(refAPI, testAPI, cfg.QueryTweaks)
+	if cfg.SeedData != nil {
+		for _, w := range windows {
+			if err := seedData(cfg, refAPI, testAPI, w.start, w.end); err != nil {
+				log.Fatalf("Error seeding data: %v", err)
+			}
+		}
+	}
+
+	testCases := cfg.TestCases
+	if cfg.SeedData == nil {
+		var skipped int
+		testCases, skipped = withoutSeedDataCases(testCases)
+		if skipped > 0 {
+			log.Printf("Skipping %d test cases that require seed data, as seed_data is not set", skipped)
+		}
+	}
 
-	end := getTime(cfg.QueryTimeParameters.EndTime, time.Now().UTC().Add(-12*time.Minute))
-	start := end.Add(
-		-getNonZeroDuration(cfg.QueryTimeParameters.RangeInSeconds, 10*time.Minute))
-	resolution := getNonZeroDuration(
-		cfg.QueryTimeParameters.ResolutionInSeconds, 10*time.Second)
-	expandedTestCases := testcases.ExpandTestCases(cfg.TestCases, cfg.QueryTweaks, start, end, resolution)
+	comp := comparer.New(refAPI, testAPI, cfg.QueryTweaks, cfg.KnownDifferences)
+
+	var expandedTestCases []*comparer.TestCase
+	for _, w := range windows {
+		for _, tc := range testcases.ExpandTestCases(testCases, cfg.QueryTweaks, w.start, w.end, resolution) {
+			tc.TimeWindow = w.name
+			tc.Chunk = chunk
+			expandedTestCases = append(expandedTestCases, tc)
+		}
+	}
 
 	var wg sync.WaitGroup
-	results := make([]*comparer.Result, len(expandedTestCases))
-	progressBar := pb.StartNew(len(results))
-	wg.Add(len(results))
+	var results []*comparer.Result
+	if streamOutp != nil {
+		streamOutp.Start(cfg.QueryTweaks)
+	}
+	if len(batches) > 0 {
+		results = make([]*comparer.Result, len(expandedTestCases))
+	}
+	progressBar := pb.StartNew(len(expandedTestCases))
+	wg.Add(len(expandedTestCases))
 
 	workCh := make(chan struct{}, *queryParallelism)
 
+	// The context is canceled once -max-failures test cases have failed, which aborts the comparisons
+	// in flight and stops starting new ones.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	failures := atomic.NewInt64(0)
+	completed := atomic.NewInt64(0)
+
 	allSuccess := atomic.NewBool(true)
 	for i, tc := range expandedTestCases {
 		workCh <- struct{}{}
+		if ctx.Err() != nil {
+			<-workCh
+			// The remaining test cases are not started.
+			wg.Add(i - len(expandedTestCases))
+			break
+		}
 
 		go func(i int, tc *comparer.TestCase) {
-			res, err := comp.Compare(tc)
+			defer wg.Done()
+			defer func() { <-workCh }()
+
+			res, err := comp.Compare(ctx, tc)
+			if ctx.Err() != nil {
+				// The comparison was aborted, its result is incomplete.
+				return
+			}
 			if err != nil {
 				log.Fatalf("Error running comparison: %v", err)
 			}
-			results[i] = res
+			if streamOutp != nil {
+				streamOutp.Emit(res)
+			}
+			if results != nil {
+				results[i] = res
+			}
 			if !res.Success() {
 				allSuccess.Store(false)
+				if *maxFailures > 0 && failures.Inc() >= int64(*maxFailures) {
+					cancel()
+				}
 			}
+			completed.Inc()
 			progressBar.Increment()
-			<-workCh
-			wg.Done()
 		}(i, tc)
 	}
 
 	wg.Wait()
 	progressBar.Finish()
 
-	outp(results, *outputPassing, cfg.QueryTweaks)
+	if ctx.Err() != nil {
+		log.Printf("Aborted after %d failed test cases, %d of %d test cases were compared", failures.Load(), completed.Load(), len(expandedTestCases))
+		// Only the results of the completed comparisons are output.
+		if results != nil {
+			completedResults := make([]*comparer.Result, 0, completed.Load())
+			for _, res := range results {
+				if res != nil {
+					completedResults = append(completedResults, res)
+				}
+			}
+			results = completedResults
+		}
+	}
+
+	if streamOutp != nil {
+		streamOutp.Finish()
+	}
+	for _, b := range batches {
+		b.outp(b.w, results, *outputPassing, cfg.QueryTweaks)
+	}
 
 	if !allSuccess.Load() {
 		os.Exit(1)
 	}
 }
 
+// batchOutput is an output format that needs the full set of results.
+type batchOutput struct {
+	outp output.Outputter
+	w    io.Writer
+}
+
+// newOutputs returns the outputs for the comma-separated formats, writing to the corresponding files
+// of the comma-separated list or to stdout. The returned files have to be closed by the caller.
+func newOutputs(formats, fileNames, htmlTemplate string, includePassing bool) ([]output.StreamingOutputter, []batchOutput, []*os.File, error) {
+	var (
+		streams []output.StreamingOutputter
+		batches []batchOutput
+		files   []*os.File
+	)
+	fail := func(err error) ([]output.StreamingOutputter, []batchOutput, []*os.File, error) {
+		for _, f := range files {
+			f.Close()
+		}
+		return nil, nil, nil, err
+	}
+
+	fs := strings.Split(formats, ",")
+	var names []string
+	if fileNames != "" {
+		names = strings.Split(fileNames, ",")
+		if len(names) != len(fs) {
+			return fail(errors.Errorf("got %d output files for %d output formats", len(names), len(fs)))
+		}
+	}
+	for i, format := range fs {
+		var w io.Writer = os.Stdout
+		if names != nil && names[i] != "" && names[i] != "-" {
+			f, err := os.Create(names[i])
+			if err != nil {
+				return fail(errors.Wrap(err, "creating output file"))
+			}
+			files = append(files, f)
+			w = f
+		}
+
+		switch strings.TrimSpace(format) {
+		case "text":
+			streams = append(streams, output.NewText(w, includePassing))
+		case "html":
+			outp, err := output.HTML(htmlTemplate)
+			if err != nil {
+				return fail(errors.Wrap(err, "reading output HTML template"))
+			}
+			batches = append(batches, batchOutput{outp: outp, w: w})
+		case "json":
+			streams = append(streams, output.NewJSON(w, includePassing))
+		case "jsonl":
+			streams = append(streams, output.NewJSONL(w, includePassing))
+		case "tsv":
+			streams = append(streams, output.NewTSV(w))
+		default:
+			return fail(errors.Errorf("invalid output format %q", format))
+		}
+	}
+	return streams, batches, files, nil
+}
+
+type timeWindow struct {
+	name       string
+	start, end time.Time
+}
+
+// timeWindows parses the configured time windows, sorted by their start. Without any configured
+// time windows, it returns a single unnamed one from start to end.
+func timeWindows(cfgWindows []config.TimeWindow, start, end time.Time) ([]timeWindow, error) {
+	if len(cfgWindows) == 0 {
+		return []timeWindow{{start: start, end: end}}, nil
+	}
+
+	windows := make([]timeWindow, 0, len(cfgWindows))
+	for _, cw := range cfgWindows {
+		w := timeWindow{name: cw.Name}
+		var err error
+		if w.start, err = parseTime(cw.Start); err != nil {
+			return nil, errors.Wrapf(err, "start of time window %q", cw.Name)
+		}
+		if w.end, err = parseTime(cw.End); err != nil {
+			return nil, errors.Wrapf(err, "end of time window %q", cw.Name)
+		}
+		if !w.start.Before(w.end) {
+			return nil, errors.Errorf("start of time window %q is not before its end", cw.Name)
+		}
+		if w.name == "" {
+			w.name = w.start.Format(time.RFC3339) + "/" + w.end.Format(time.RFC3339)
+		}
+		windows = append(windows, w)
+	}
+	// Seed data has to be pushed in chronological order.
+	sort.Slice(windows, func(i, j int) bool { return windows[i].start.Before(windows[j].start) })
+	return windows, nil
+}
+
+// seedData pushes the same synthetic data to both targets and waits until both return it.
+func seedData(cfg *config.Config, refAPI, testAPI v1.API, start, end time.Time) error {
+	ctx := context.Background()
+	series := seed.Series(start, end)
+	if err := seed.Push(ctx, cfg.ReferenceTargetConfig, series); err != nil {
+		return errors.Wrap(err, "pushing to reference target")
+	}
+	if err := seed.Push(ctx, cfg.TestTargetConfig, series); err != nil {
+		return errors.Wrap(err, "pushing to test target")
+	}
+
+	timeout := time.Duration(cfg.SeedData.WaitTimeout)
+	if err := seed.WaitForData(ctx, refAPI, cfg.SeedData.ProbeQuery, end, timeout); err != nil {
+		return errors.Wrap(err, "reference target")
+	}
+	if err := seed.WaitForData(ctx, testAPI, cfg.SeedData.ProbeQuery, end, timeout); err != nil {
+		return errors.Wrap(err, "test target")
+	}
+	return nil
+}
+
+// withoutSeedDataCases returns the test cases that don't require seed data and the number of the others.
+func withoutSeedDataCases(tcs []*config.TestCase) ([]*config.TestCase, int) {
+	var kept []*config.TestCase
+	for _, tc := range tcs {
+		if !tc.RequiresSeedData {
+			kept = append(kept, tc)
+		}
+	}
+	return kept, len(tcs) - len(kept)
+}
+
+// printTestCases writes the query template of every test case, followed by the arguments its variants
+// are generated from and whether it is expected to fail, not compared or requires seed data.
+func printTestCases(w io.Writer, tcs []*config.TestCase) {
+	for _, tc := range tcs {
+		var notes []string
+		if len(tc.VariantArgs) > 0 {
+			notes = append(notes, "variant args: "+strings.Join(tc.VariantArgs, ", "))
+		}
+		if tc.ShouldFail {
+			notes = append(notes, "should fail")
+		}
+		if tc.SkipComparison {
+			notes = append(notes, "comparison skipped")
+		}
+		if tc.RequiresSeedData {
+			notes = append(notes, "requires seed data")
+		}
+		if len(notes) > 0 {
+			fmt.Fprintf(w, "%s\t(%s)\n", tc.Query, strings.Join(notes, "; "))
+		} else {
+			fmt.Fprintln(w, tc.Query)
+		}
+	}
+}
+
+// printEffectiveConfig writes the configuration with the defaults applied and the secrets redacted as YAML.
+func printEffectiveConfig(w io.Writer, cfg *config.Config, start, end time.Time, resolution time.Duration) error {
+	effective := *cfg
+	effective.ReferenceTargetConfig = cfg.ReferenceTargetConfig.Redacted()
+	effective.TestTargetConfig = cfg.TestTargetConfig.Redacted()
+	effective.QueryTimeParameters = config.QueryTimeParameters{
+		EndTime:             end.Format(time.RFC3339Nano),
+		RangeInSeconds:      end.Sub(start).Seconds(),
+		ResolutionInSeconds: resolution.Seconds(),
+		TimeWindows:         cfg.QueryTimeParameters.TimeWindows,
+		ChunkInSeconds:      cfg.QueryTimeParameters.ChunkInSeconds,
+	}
+	out, err := yaml.Marshal(effective)
+	if err != nil {
+		return errors.Wrap(err, "marshaling configuration")
+	}
+	_, err = w.Write(out)
+	return err
+}
+
 func getTime(timeStr string, defaultTime time.Time) time.Time {
 	result, err := parseTime(timeStr)
 	if err != nil {
@@ -0,0 +1,63 @@
+package comparer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// absentLabels returns the labels that absent() and absent_over_time() synthesize for their result from
+// the matchers of the selector: the labels with a single equality matcher, other than the metric name.
+// Labels with several matchers are dropped, e.g. `absent(x{job="a",job="b",foo="bar"})` only
+// synthesizes {foo="bar"}.
+func absentLabels(call *parser.Call) labels.Labels {
+	var lm []*labels.Matcher
+	switch n := call.Args[0].(type) {
+	case *parser.VectorSelector:
+		lm = n.LabelMatchers
+	case *parser.MatrixSelector:
+		lm = n.VectorSelector.(*parser.VectorSelector).LabelMatchers
+	default:
+		return labels.EmptyLabels()
+	}
+
+	b := labels.NewBuilder(labels.EmptyLabels())
+	has := make(map[string]bool, len(lm))
+	for _, m := range lm {
+		if m.Name == labels.MetricName {
+			continue
+		}
+		if m.Type == labels.MatchEqual && !has[m.Name] {
+			b.Set(m.Name, m.Value)
+			has[m.Name] = true
+		} else {
+			b.Del(m.Name)
+		}
+	}
+	return b.Labels()
+}
+
+// isAbsentCall returns whether the call is to absent() or absent_over_time().
+func isAbsentCall(call *parser.Call) bool {
+	return (call.Func.Name == "absent" || call.Func.Name == "absent_over_time") && len(call.Args) > 0
+}
+
+// describeAbsentCall describes the labels that the absent() or absent_over_time() call should synthesize
+// according to its matchers, and the label sets both APIs returned.
+func describeAbsentCall(call *parser.Call, refResult, testResult model.Matrix) string {
+	describe := func(m model.Matrix) string {
+		if len(m) == 0 {
+			return "no series"
+		}
+		var sets []string
+		for _, s := range m {
+			sets = append(sets, s.Metric.String())
+		}
+		return strings.Join(sets, ", ")
+	}
+	return fmt.Sprintf("labels synthesized by `%s`: expected %s, reference: %s, test: %s\n",
+		call.String(), absentLabels(call).String(), describe(refResult), describe(testResult))
+}
@@ -0,0 +1,37 @@
+package comparer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// describeBinaryOp describes a comparison or set operation together with its bool modifier and vector
+// matching, as implementations often differ in which labels survive these operations and in whether they
+// filter or return 0/1. It returns false for other binary operations.
+func describeBinaryOp(be *parser.BinaryExpr) (string, bool) {
+	if !(be.Op.IsComparisonOperator() || be.Op.IsSetOperator()) {
+		return "", false
+	}
+	op := be.Op.String()
+	if be.ReturnBool {
+		op += " bool"
+	}
+	if vm := be.VectorMatching; vm != nil {
+		if vm.On || len(vm.MatchingLabels) > 0 {
+			matching := "ignoring"
+			if vm.On {
+				matching = "on"
+			}
+			op += fmt.Sprintf(" %s(%s)", matching, strings.Join(vm.MatchingLabels, ", "))
+		}
+		switch vm.Card {
+		case parser.CardManyToOne:
+			op += fmt.Sprintf(" group_left(%s)", strings.Join(vm.Include, ", "))
+		case parser.CardOneToMany:
+			op += fmt.Sprintf(" group_right(%s)", strings.Join(vm.Include, ", "))
+		}
+	}
+	return "`" + op + "`", true
+}
@@ -0,0 +1,68 @@
+package comparer
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+)
+
+// calendarFuncs are the PromQL functions that return a calendar field of a Unix timestamp,
+// as a function of the timestamp in the location to evaluate them in.
+var calendarFuncs = map[string]func(t time.Time) float64{
+	"day_of_month": func(t time.Time) float64 { return float64(t.Day()) },
+	"day_of_week":  func(t time.Time) float64 { return float64(t.Weekday()) },
+	"day_of_year":  func(t time.Time) float64 { return float64(t.YearDay()) },
+	"days_in_month": func(t time.Time) float64 {
+		return float64(32 - time.Date(t.Year(), t.Month(), 32, 0, 0, 0, 0, time.UTC).Day())
+	},
+	"hour":   func(t time.Time) float64 { return float64(t.Hour()) },
+	"minute": func(t time.Time) float64 { return float64(t.Minute()) },
+	"month":  func(t time.Time) float64 { return float64(t.Month()) },
+	"year":   func(t time.Time) float64 { return float64(t.Year()) },
+}
+
+// IsCalendarFunc returns whether the PromQL function returns a calendar field of a timestamp, which
+// depends on the time zone the function is evaluated in.
+func IsCalendarFunc(name string) bool {
+	_, ok := calendarFuncs[name]
+	return ok
+}
+
+// calendarInTimeZone applies the calendar function of the test case in its time zone to the results of
+// the reference API for the argument of the function, which are Unix timestamps. Like in PromQL, the
+// metric name is dropped and NaN and infinite timestamps result in NaN.
+func calendarInTimeZone(tc *TestCase, argResult model.Value) (model.Matrix, error) {
+	fn, ok := calendarFuncs[tc.CalendarFunc]
+	if !ok {
+		return nil, errors.Errorf("unknown calendar function %q", tc.CalendarFunc)
+	}
+	loc, err := time.LoadLocation(tc.TimeZone)
+	if err != nil {
+		return nil, errors.Wrapf(err, "loading time zone %q", tc.TimeZone)
+	}
+	m, ok := argResult.(model.Matrix)
+	if !ok {
+		return nil, errors.Errorf("unexpected result type %s of calendar function argument %q", argResult.Type(), tc.CalendarArg)
+	}
+
+	res := make(model.Matrix, 0, len(m))
+	for _, s := range m {
+		metric := s.Metric.Clone()
+		delete(metric, model.MetricNameLabel)
+		values := make([]model.SamplePair, 0, len(s.Values))
+		for _, v := range s.Values {
+			f := float64(v.Value)
+			if math.IsNaN(f) || math.IsInf(f, 0) {
+				values = append(values, model.SamplePair{Timestamp: v.Timestamp, Value: model.SampleValue(math.NaN())})
+				continue
+			}
+			values = append(values, model.SamplePair{Timestamp: v.Timestamp, Value: model.SampleValue(fn(time.Unix(int64(f), 0).In(loc)))})
+		}
+		res = append(res, &model.SampleStream{Metric: metric, Values: values})
+	}
+	sort.Sort(res)
+	return res, nil
+}
@@ -0,0 +1,173 @@
+package comparer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+)
+
+// ChunkResult is the comparison result of a single chunk of a test case whose range is compared in chunks.
+type ChunkResult struct {
+	Start             time.Time `json:"start"`
+	End               time.Time `json:"end"`
+	Diff              string    `json:"diff,omitempty"`
+	UnexpectedFailure string    `json:"unexpectedFailure,omitempty"`
+	UnexpectedSuccess bool      `json:"unexpectedSuccess,omitempty"`
+}
+
+// Success returns true if the chunk's comparison was successful.
+func (cr *ChunkResult) Success() bool {
+	return cr.Diff == "" && !cr.UnexpectedSuccess && cr.UnexpectedFailure == ""
+}
+
+// chunkRanges splits the range from start to end at every multiple of chunk since the Unix epoch, so
+// that the chunks of different test cases and runs cover the same time periods. Every chunk starts at the
+// first step of the whole range at or after its boundary, so that the chunks together evaluate the query
+// at the same timestamps as the whole range.
+func chunkRanges(start, end time.Time, chunk, step time.Duration) [][2]time.Time {
+	var ranges [][2]time.Time
+	from := start
+	// The first multiple of chunk since the Unix epoch after start. time.Time.Truncate aligns to the
+	// zero time instead, which differs from the epoch for chunks such as 7m.
+	epoch := time.Unix(0, 0)
+	first := epoch.Add((start.Sub(epoch)/chunk + 1) * chunk)
+	for boundary := first; boundary.Before(end); boundary = boundary.Add(chunk) {
+		// The first step at or after the boundary.
+		next := start.Add((boundary.Sub(start) + step - 1) / step * step)
+		if !next.After(from) || next.After(end) {
+			continue
+		}
+		ranges = append(ranges, [2]time.Time{from, next.Add(-step)})
+		from = next
+	}
+	return append(ranges, [2]time.Time{from, end})
+}
+
+// compareChunks compares the test case in chunks of tc.Chunk and stitches their results together. The
+// test case fails if any of its chunks fails, and the diff of every failing chunk is prefixed with its
+// time range, so that divergences confined to a specific time period, e.g. around a compaction, stand out.
+func (c *Comparer) compareChunks(ctx context.Context, tc *TestCase) (*Result, error) {
+	res := &Result{TestCase: tc, BothEmpty: true}
+	onlyInRef, onlyInTest := map[string]struct{}{}, map[string]struct{}{}
+	for _, r := range chunkRanges(tc.Start, tc.End, tc.Chunk, tc.Resolution) {
+		chunkTC := *tc
+		chunkTC.Start, chunkTC.End, chunkTC.Chunk = r[0], r[1], 0
+		if tc.EquivalentQuery != "" {
+			// The explicit timestamps of the equivalent query keep the "@ start()" and "@ end()"
+			// modifiers at the range of the whole test case.
+			chunkTC.Query, chunkTC.EquivalentQuery = tc.EquivalentQuery, ""
+		}
+
+		chunkRes, err := c.compare(ctx, &chunkTC)
+		if err != nil {
+			return nil, errors.Wrapf(err, "comparing chunk %s", formatChunk(r[0], r[1]))
+		}
+
+		cr := &ChunkResult{
+			Start:             r[0],
+			End:               r[1],
+			Diff:              chunkRes.Diff,
+			UnexpectedFailure: chunkRes.UnexpectedFailure,
+			UnexpectedSuccess: chunkRes.UnexpectedSuccess,
+		}
+		res.Chunks = append(res.Chunks, cr)
+
+		if cr.Diff != "" {
+			res.Diff += fmt.Sprintf("chunk %s returned different results:\n%s", formatChunk(r[0], r[1]), cr.Diff)
+		}
+		if cr.UnexpectedFailure != "" && res.UnexpectedFailure == "" {
+			res.UnexpectedFailure = fmt.Sprintf("chunk %s: %s", formatChunk(r[0], r[1]), cr.UnexpectedFailure)
+		}
+		res.UnexpectedSuccess = res.UnexpectedSuccess || cr.UnexpectedSuccess
+		res.Unsupported = res.Unsupported || chunkRes.Unsupported
+		res.BothEmpty = res.BothEmpty && chunkRes.BothEmpty
+		for _, s := range chunkRes.OnlyInReference {
+			onlyInRef[s] = struct{}{}
+		}
+		for _, s := range chunkRes.OnlyInTest {
+			onlyInTest[s] = struct{}{}
+		}
+
+		if res.RefHTTPMetadata == nil {
+			res.RefHTTPMetadata, res.TestHTTPMetadata = chunkRes.RefHTTPMetadata, chunkRes.TestHTTPMetadata
+		}
+		for _, w := range chunkRes.Warnings {
+			res.Warnings = append(res.Warnings, fmt.Sprintf("chunk %s: %s", formatChunk(r[0], r[1]), w))
+		}
+		res.ReferenceResult = stitchTargetResults(res.ReferenceResult, chunkRes.ReferenceResult)
+		res.TestResult = stitchTargetResults(res.TestResult, chunkRes.TestResult)
+	}
+
+	res.OnlyInReference = sortedKeys(onlyInRef)
+	res.OnlyInTest = sortedKeys(onlyInTest)
+	return res, nil
+}
+
+// stitchTargetResults appends the result of the next chunk to the results of the previous chunks. The
+// latencies are summed up and the first error is kept.
+func stitchTargetResults(prev, next *TargetResult) *TargetResult {
+	if prev == nil || next == nil {
+		if prev == nil {
+			return next
+		}
+		return prev
+	}
+	res := &TargetResult{
+		StatusCode: prev.StatusCode,
+		Latency:    prev.Latency + next.Latency,
+		Error:      prev.Error,
+	}
+	if res.Error == "" {
+		res.StatusCode, res.Error = next.StatusCode, next.Error
+	}
+
+	prevMatrix, prevOK := prev.Value.(model.Matrix)
+	nextMatrix, nextOK := next.Value.(model.Matrix)
+	if !prevOK || !nextOK {
+		res.Value = prev.Value
+		if res.Value == nil {
+			res.Value = next.Value
+		}
+		return res
+	}
+	stitched := make(model.Matrix, 0, len(prevMatrix))
+	series := make(map[model.Fingerprint]*model.SampleStream, len(prevMatrix))
+	for _, s := range append(append(model.Matrix{}, prevMatrix...), nextMatrix...) {
+		if ss, ok := series[s.Metric.Fingerprint()]; ok {
+			ss.Values = append(ss.Values, s.Values...)
+			ss.Histograms = append(ss.Histograms, s.Histograms...)
+			continue
+		}
+		ss := &model.SampleStream{
+			Metric:     s.Metric,
+			Values:     append([]model.SamplePair(nil), s.Values...),
+			Histograms: append([]model.SampleHistogramPair(nil), s.Histograms...),
+		}
+		series[s.Metric.Fingerprint()] = ss
+		stitched = append(stitched, ss)
+	}
+	res.Value = stitched
+	return res
+}
+
+// formatChunk formats the time range of a chunk.
+func formatChunk(start, end time.Time) string {
+	return fmt.Sprintf("%s - %s", start.UTC().Format(time.RFC3339), end.UTC().Format(time.RFC3339))
+}
+
+// sortedKeys returns the sorted keys of the set, or nil if it is empty.
+func sortedKeys(set map[string]struct{}) []string {
+	if len(set) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
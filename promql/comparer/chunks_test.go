@@ -0,0 +1,179 @@
+package comparer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+func TestChunkRanges(t *testing.T) {
+	// Midnight is a multiple of every chunk length below since the Unix epoch, except for 7m.
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) time.Time { return base.Add(d) }
+
+	for _, tc := range []struct {
+		name         string
+		start, end   time.Duration
+		chunk, step  time.Duration
+		expectRanges [][2]time.Duration
+	}{
+		{
+			name:  "exact multiples",
+			start: 0, end: 30 * time.Minute, chunk: 10 * time.Minute, step: time.Minute,
+			expectRanges: [][2]time.Duration{{0, 9 * time.Minute}, {10 * time.Minute, 19 * time.Minute}, {20 * time.Minute, 30 * time.Minute}},
+		},
+		{
+			name:  "remainder chunk",
+			start: 5 * time.Minute, end: 25 * time.Minute, chunk: 10 * time.Minute, step: time.Minute,
+			expectRanges: [][2]time.Duration{{5 * time.Minute, 9 * time.Minute}, {10 * time.Minute, 19 * time.Minute}, {20 * time.Minute, 25 * time.Minute}},
+		},
+		{
+			name:  "shorter than a chunk",
+			start: time.Minute, end: 5 * time.Minute, chunk: 10 * time.Minute, step: time.Minute,
+			expectRanges: [][2]time.Duration{{time.Minute, 5 * time.Minute}},
+		},
+		{
+			// The chunks start at the first step after the boundaries at 2m and 4m.
+			name:  "step alignment",
+			start: 0, end: 6 * time.Minute, chunk: 2 * time.Minute, step: 45 * time.Second,
+			expectRanges: [][2]time.Duration{{0, 90 * time.Second}, {135 * time.Second, 225 * time.Second}, {270 * time.Second, 6 * time.Minute}},
+		},
+		{
+			// The multiples of 7m since the epoch are at 00:01, 00:08, 00:15, ... on that day, not relative to the start.
+			name:  "epoch alignment",
+			start: 10 * time.Minute, end: 30 * time.Minute, chunk: 7 * time.Minute, step: time.Minute,
+			expectRanges: [][2]time.Duration{{10 * time.Minute, 14 * time.Minute}, {15 * time.Minute, 21 * time.Minute}, {22 * time.Minute, 28 * time.Minute}, {29 * time.Minute, 30 * time.Minute}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var expected [][2]time.Time
+			for _, r := range tc.expectRanges {
+				expected = append(expected, [2]time.Time{at(r[0]), at(r[1])})
+			}
+			got := chunkRanges(at(tc.start), at(tc.end), tc.chunk, tc.step)
+			if fmt.Sprint(got) != fmt.Sprint(expected) {
+				t.Errorf("expected chunks\n%v\ngot\n%v", expected, got)
+			}
+		})
+	}
+}
+
+// fakeAPI serves range queries with a single series whose value at every step is the step's Unix
+// timestamp, multiplied by the result of diverge for it if set. It records the ranges it was queried for.
+type fakeAPI struct {
+	diverge func(ts float64) float64
+
+	mtx    sync.Mutex
+	ranges [][2]float64
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var params [3]float64
+	for i, name := range []string{"start", "end", "step"} {
+		v, err := strconv.ParseFloat(r.Form.Get(name), 64)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		params[i] = v
+	}
+	f.mtx.Lock()
+	f.ranges = append(f.ranges, [2]float64{params[0], params[1]})
+	f.mtx.Unlock()
+
+	var values []string
+	for ts := params[0]; ts <= params[1]; ts += params[2] {
+		v := ts
+		if f.diverge != nil {
+			v *= f.diverge(ts)
+		}
+		values = append(values, fmt.Sprintf("[%v,%q]", ts, strconv.FormatFloat(v, 'f', -1, 64)))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"__name__":"demo"},"values":[%s]}]}}`, strings.Join(values, ","))
+}
+
+func newFakeAPI(t *testing.T, f *fakeAPI) v1.API {
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	client, err := api.NewClient(api.Config{Address: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v1.NewAPI(RecordHTTPMetadata(client))
+}
+
+func TestCompareChunks(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 5, 0, 0, time.UTC)
+	end := start.Add(20 * time.Minute)
+	newTestCase := func() *TestCase {
+		return &TestCase{Query: "demo", Start: start, End: end, Resolution: time.Minute, Chunk: 10 * time.Minute}
+	}
+
+	t.Run("same results", func(t *testing.T) {
+		ref := &fakeAPI{}
+		c := New(newFakeAPI(t, ref), newFakeAPI(t, &fakeAPI{}), nil, nil)
+		res, err := c.Compare(context.Background(), newTestCase())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Success() {
+			t.Fatalf("expected success, got diff:\n%s", res.Diff)
+		}
+		if len(res.Chunks) != 3 {
+			t.Fatalf("expected 3 chunks, got %d", len(res.Chunks))
+		}
+		// The chunks are queried separately and their results stitched back together.
+		midnight := float64(start.Add(-5 * time.Minute).Unix())
+		expRanges := [][2]float64{{midnight + 300, midnight + 540}, {midnight + 600, midnight + 1140}, {midnight + 1200, midnight + 1500}}
+		if fmt.Sprint(ref.ranges) != fmt.Sprint(expRanges) {
+			t.Errorf("expected queried ranges %v, got %v", expRanges, ref.ranges)
+		}
+		m, ok := res.ReferenceResult.Value.(model.Matrix)
+		if !ok || len(m) != 1 || len(m[0].Values) != 21 {
+			t.Errorf("expected a single series with 21 stitched samples, got %v", res.ReferenceResult.Value)
+		}
+	})
+
+	t.Run("divergence in one chunk", func(t *testing.T) {
+		// The test API diverges from 00:12 to 00:14, all within the second chunk.
+		from, to := float64(start.Add(7*time.Minute).Unix()), float64(start.Add(9*time.Minute).Unix())
+		test := &fakeAPI{diverge: func(ts float64) float64 {
+			if ts >= from && ts <= to {
+				return 2
+			}
+			return 1
+		}}
+		c := New(newFakeAPI(t, &fakeAPI{}), newFakeAPI(t, test), nil, nil)
+		res, err := c.Compare(context.Background(), newTestCase())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Success() {
+			t.Fatal("expected failure")
+		}
+		for i, cr := range res.Chunks {
+			if cr.Success() != (i != 1) {
+				t.Errorf("chunk %d %s: unexpected success %t", i, formatChunk(cr.Start, cr.End), cr.Success())
+			}
+		}
+		prefix := "chunk 2024-01-01T00:10:00Z - 2024-01-01T00:19:00Z returned different results:\n"
+		if !strings.HasPrefix(res.Diff, prefix) || strings.Count(res.Diff, "returned different results") != 1 {
+			t.Errorf("expected a single diff starting with %q, got:\n%s", prefix, res.Diff)
+		}
+	})
+}
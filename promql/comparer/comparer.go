@@ -3,6 +3,7 @@ package comparer
 import (
 	"context"
 	"fmt"
+	"math"
 	"sort"
 	"strings"
 	"time"
@@ -18,6 +19,10 @@ import (
 const (
 	defaultFraction = 0.00001
 	defaultMargin   = 0.0
+
+	// defaultNativeHistogramTolerance is the default fraction by which quantiles estimated from native
+	// histograms may diverge from the ones estimated from classic histograms.
+	defaultNativeHistogramTolerance = 0.1
 )
 
 // PromAPI allows running instant and range queries against a Prometheus-compatible API.
@@ -36,27 +41,54 @@ type TestCase struct {
 	Start          time.Time     `json:"start"`
 	End            time.Time     `json:"end"`
 	Resolution     time.Duration `json:"resolution"`
+	// Category is the family of the outermost operation of the query, e.g. "over_time", "aggregation" or
+	// "binary_operator", and Functions are the names of all functions and aggregations called in it.
+	Category  string   `json:"category,omitempty"`
+	Functions []string `json:"functions,omitempty"`
+	// TimeWindow is the name of the configured time window the test case is run in, if any.
+	TimeWindow string `json:"timeWindow,omitempty"`
+	// Chunk is the length of the chunks the range is split into to compare them separately, if not zero.
+	Chunk time.Duration `json:"chunk,omitempty"`
+
+	// EquivalentQuery is the query with all "@ start()" and "@ end()" modifiers replaced by the explicit
+	// timestamps of the range. If set, both APIs are expected to return the same results for both queries.
+	EquivalentQuery string `json:"equivalentQuery,omitempty"`
+
+	// NativeHistogramQuery is the query over native histograms equivalent to the query over classic
+	// histograms. If both APIs support it, each API's results for both queries are expected to be within
+	// NativeHistogramTolerance of each other.
+	NativeHistogramQuery     string  `json:"nativeHistogramQuery,omitempty"`
+	NativeHistogramTolerance float64 `json:"nativeHistogramTolerance,omitempty"`
+
+	// TimeZone is the time zone the test API is expected to evaluate the calendar function CalendarFunc in,
+	// which is called on CalendarArg at the top level of the query. If set, the reference API is queried for
+	// CalendarArg instead and the calendar function is applied to its results in TimeZone.
+	TimeZone     string `json:"timeZone,omitempty"`
+	CalendarFunc string `json:"calendarFunc,omitempty"`
+	CalendarArg  string `json:"calendarArg,omitempty"`
 }
 
 // A Comparer allows comparing query results for test cases between a reference API and a test API.
 type Comparer struct {
-	refAPI         PromAPI
-	testAPI        PromAPI
-	queryTweaks    []*config.QueryTweak
-	compareOptions cmp.Options
+	refAPI           PromAPI
+	testAPI          PromAPI
+	queryTweaks      []*config.QueryTweak
+	knownDifferences []*config.KnownDifference
+	compareOptions   cmp.Options
 }
 
 // New returns a new Comparer.
-func New(refAPI, testAPI PromAPI, queryTweaks []*config.QueryTweak) *Comparer {
+func New(refAPI, testAPI PromAPI, queryTweaks []*config.QueryTweak, knownDifferences []*config.KnownDifference) *Comparer {
 	var options cmp.Options
 	addFloatCompareOptions(queryTweaks, &options)
 	addDropResultLabelsOptions(queryTweaks, &options)
 	addCaseInsensitiveCompareOptions(queryTweaks, &options)
 	return &Comparer{
-		refAPI:         refAPI,
-		testAPI:        testAPI,
-		queryTweaks:    queryTweaks,
-		compareOptions: options,
+		refAPI:           aliasingAPI{refAPI},
+		testAPI:          aliasingAPI{testAPI},
+		queryTweaks:      queryTweaks,
+		knownDifferences: knownDifferences,
+		compareOptions:   options,
 	}
 }
 
@@ -67,16 +99,101 @@ type Result struct {
 	UnexpectedFailure string    `json:"unexpectedFailure"`
 	UnexpectedSuccess bool      `json:"unexpectedSuccess"`
 	Unsupported       bool      `json:"unsupported"`
+
+	// HTTP metadata of the range query responses and their differences, only set when comparing HTTP metadata.
+	// Warnings do not affect whether the comparison was successful.
+	RefHTTPMetadata  *HTTPMetadata `json:"refHTTPMetadata,omitempty"`
+	TestHTTPMetadata *HTTPMetadata `json:"testHTTPMetadata,omitempty"`
+	Warnings         []string      `json:"warnings,omitempty"`
+
+	// BothEmpty is set if both APIs returned an empty result, e.g. because the queried data is missing from both.
+	BothEmpty bool `json:"bothEmpty,omitempty"`
+
+	// Series returned by only one of the APIs, only set when the series sets are compared strictly.
+	OnlyInReference []string `json:"onlyInReference,omitempty"`
+	OnlyInTest      []string `json:"onlyInTest,omitempty"`
+
+	// What each API returned for the range query of the test case.
+	ReferenceResult *TargetResult `json:"referenceResult,omitempty"`
+	TestResult      *TargetResult `json:"testResult,omitempty"`
+
+	// Chunks are the results of the chunks of the range, only set when the range is compared in chunks.
+	Chunks []*ChunkResult `json:"chunks,omitempty"`
+
+	// KnownDifference is set if the comparison failed, but the query is covered by a known difference.
+	KnownDifference *config.KnownDifference `json:"knownDifference,omitempty"`
 }
 
-// Success returns true if the comparison result was successful.
+// TargetResult describes what a single API returned for the range query of a test case.
+type TargetResult struct {
+	// Value is the result as returned by the API, before any query tweaks are applied.
+	Value      model.Value   `json:"value,omitempty"`
+	StatusCode int           `json:"statusCode,omitempty"`
+	Latency    time.Duration `json:"latency"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// newTargetResult returns the TargetResult for the given response. The value is copied, as the
+// comparison modifies the series in place.
+func newTargetResult(v model.Value, resp httpResponse, latency time.Duration, err error) *TargetResult {
+	tr := &TargetResult{
+		Value:      v,
+		StatusCode: resp.statusCode,
+		Latency:    latency,
+	}
+	if m, ok := v.(model.Matrix); ok {
+		cp := make(model.Matrix, 0, len(m))
+		for _, s := range m {
+			cp = append(cp, &model.SampleStream{
+				Metric:     s.Metric.Clone(),
+				Values:     append([]model.SamplePair(nil), s.Values...),
+				Histograms: append([]model.SampleHistogramPair(nil), s.Histograms...),
+			})
+		}
+		tr.Value = cp
+	}
+	if err != nil {
+		tr.Error = err.Error()
+	}
+	return tr
+}
+
+// Success returns true if the comparison result was successful or failed due to a known difference.
 func (r *Result) Success() bool {
-	return r.Diff == "" && !r.UnexpectedSuccess && r.UnexpectedFailure == ""
+	return r.KnownDifference != nil || (r.Diff == "" && !r.UnexpectedSuccess && r.UnexpectedFailure == "")
 }
 
 // Compare runs a test case query against the reference API and the test API and compares the results.
-func (c *Comparer) Compare(tc *TestCase) (*Result, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// Canceling the context aborts the queries of the comparison.
+// If the range of the test case is longer than its chunk length, it is compared chunk by chunk. Queries
+// returning a range vector are compared by instant queries at the start and the end of the range.
+func (c *Comparer) Compare(ctx context.Context, tc *TestCase) (*Result, error) {
+	compare := c.compare
+	switch {
+	case isMatrixQuery(tc.Query):
+		compare = c.compareMatrixQuery
+	case tc.Chunk > 0 && tc.End.Sub(tc.Start) > tc.Chunk:
+		compare = c.compareChunks
+	}
+	res, err := compare(ctx, tc)
+	if err != nil || res.Success() {
+		return res, err
+	}
+	if len(res.OnlyInReference) > 0 || len(res.OnlyInTest) > 0 {
+		// Differing series sets are not covered by known differences.
+		return res, nil
+	}
+	for _, kd := range c.knownDifferences {
+		if kd.Matches(tc.Query) {
+			res.KnownDifference = kd
+			break
+		}
+	}
+	return res, nil
+}
+
+func (c *Comparer) compare(ctx context.Context, tc *TestCase) (*Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	r := v1.Range{
@@ -85,30 +202,324 @@ func (c *Comparer) Compare(tc *TestCase) (*Result, error) {
 		Step:  tc.Resolution,
 	}
 
-	// TODO: Handle warnings (second, ignored return value).
-	refResult, _, refErr := c.refAPI.QueryRange(ctx, tc.Query, r)
-	testResult, _, testErr := c.testAPI.QueryRange(ctx, tc.Query, r)
+	var refResp, testResp httpResponse
+	compareMetadata, metadataHeaders := httpMetadataHeaders(c.queryTweaks)
+
+	// TODO: Handle warnings other than the ones about function aliases.
+	refStart := time.Now()
+	refQuery := tc.Query
+	if tc.TimeZone != "" {
+		refQuery = tc.CalendarArg
+	}
+	refResult, refWarnings, refErr := c.refAPI.QueryRange(withHTTPResponse(ctx, &refResp), refQuery, r)
+	refTarget := newTargetResult(refResult, refResp, time.Since(refStart), refErr)
+	testStart := time.Now()
+	testResult, testWarnings, testErr := c.testAPI.QueryRange(withHTTPResponse(ctx, &testResp), tc.Query, r)
+	testTarget := newTargetResult(testResult, testResp, time.Since(testStart), testErr)
+
+	// withMetadata attaches the results of both APIs, the HTTP metadata of both responses, if enabled, and the
+	// warnings about function aliases to a result.
+	withMetadata := func(res *Result) *Result {
+		res.ReferenceResult, res.TestResult = refTarget, testTarget
+		if compareMetadata {
+			res.RefHTTPMetadata = refResp.metadata(metadataHeaders)
+			res.TestHTTPMetadata = testResp.metadata(metadataHeaders)
+			sameQueryError := refErr != nil && testErr != nil && !strictHTTPStatus(c.queryTweaks)
+			res.Warnings = compareHTTPMetadata(res.RefHTTPMetadata, res.TestHTTPMetadata, metadataHeaders, sameQueryError)
+		}
+		res.Warnings = append(res.Warnings, aliasWarnings("reference", refWarnings)...)
+		res.Warnings = append(res.Warnings, aliasWarnings("test", testWarnings)...)
+		return res
+	}
 
 	if (refErr != nil) != tc.ShouldFail {
 		if refErr != nil {
-			return nil, errors.Wrapf(refErr, "querying reference API for %q", tc.Query)
+			return nil, errors.Wrapf(refErr, "querying reference API for %q", refQuery)
 		}
-		return nil, fmt.Errorf("expected reference API query %q to fail, but succeeded", tc.Query)
+		return nil, fmt.Errorf("expected reference API query %q to fail, but succeeded", refQuery)
 	}
 
 	if (testErr != nil) != tc.ShouldFail {
 		if testErr != nil {
-			return &Result{TestCase: tc, UnexpectedFailure: testErr.Error(), Unsupported: strings.Contains(testErr.Error(), "501")}, nil
+			return withMetadata(&Result{TestCase: tc, UnexpectedFailure: testErr.Error(), Unsupported: strings.Contains(testErr.Error(), "501")}), nil
 		}
-		return &Result{TestCase: tc, UnexpectedSuccess: true}, nil
+		return withMetadata(&Result{TestCase: tc, UnexpectedSuccess: true}), nil
 	}
 
 	if tc.SkipComparison || tc.ShouldFail {
-		return &Result{TestCase: tc}, nil
+		return withMetadata(&Result{TestCase: tc}), nil
 	}
 
+	if tc.TimeZone != "" {
+		calendarResult, err := calendarInTimeZone(tc, refResult)
+		if err != nil {
+			return nil, err
+		}
+		refResult = calendarResult
+	}
+
+	bothEmpty := isEmpty(refResult) && isEmpty(testResult)
+
+	c.dropLabelsBeforeCompare(refResult, testResult)
 	sort.Sort(testResult.(model.Matrix))
+	c.ignoreFirstStep(tc, refResult)
+
+	diff := cmp.Diff(refResult, testResult, c.compareOptions)
+	if bothEmpty && failOnBothEmpty(c.queryTweaks) {
+		diff = "both APIs returned an empty result, the queried data may be missing from both\n" + diff
+	}
+	if diff != "" {
+		// The query is only described if it parses, as the notes are merely hints.
+		expr, renamed, err := parseQuery(tc.Query)
+		if err != nil {
+			expr = nil
+		}
+		diff = divergenceNotes(tc, expr, renamed, refResult.(model.Matrix), testResult.(model.Matrix)) +
+			c.firstDivergences(refResult.(model.Matrix), testResult.(model.Matrix)) + diff
+	}
+
+	if tc.EquivalentQuery != "" {
+		equivalentDiff, testErr, err := c.compareEquivalentQuery(ctx, tc, r, refResult, testResult)
+		if err != nil {
+			return nil, err
+		}
+		if testErr != nil {
+			return withMetadata(&Result{TestCase: tc, UnexpectedFailure: testErr.Error(), Unsupported: strings.Contains(testErr.Error(), "501")}), nil
+		}
+		diff += equivalentDiff
+	}
+
+	if tc.NativeHistogramQuery != "" {
+		diff += c.compareNativeHistogramQuery(ctx, tc, r, refResult, testResult)
+	}
+
+	// The reference results of the limited and over-cap queries are not converted to the time zone.
+	if limit := queryLimit(c.queryTweaks); limit > 0 && tc.TimeZone == "" {
+		limitedDiff, testErr, err := c.compareLimitedInstantQuery(ctx, tc, limit)
+		if err != nil {
+			return nil, err
+		}
+		if testErr != nil {
+			return withMetadata(&Result{TestCase: tc, UnexpectedFailure: testErr.Error(), Unsupported: strings.Contains(testErr.Error(), "501")}), nil
+		}
+		if limitedDiff != "" {
+			diff += fmt.Sprintf("instant query at %v with limit=%d returned different results:\n%s", tc.End, limit, limitedDiff)
+		}
+	}
+
+	if pc := pointsCap(c.queryTweaks); pc > 0 && tc.TimeZone == "" {
+		diff += c.compareOverCapRangeQuery(ctx, tc, pc)
+	}
+
+	var onlyInRef, onlyInTest []string
+	if strictSeriesSet(c.queryTweaks) {
+		onlyInRef, onlyInTest = c.seriesSetDifference(refResult.(model.Matrix), testResult.(model.Matrix))
+		if len(onlyInRef) > 0 || len(onlyInTest) > 0 {
+			diff = fmt.Sprintf("series only in reference: %v\nseries only in test: %v\n", onlyInRef, onlyInTest) + diff
+		}
+	}
+
+	return withMetadata(&Result{
+		TestCase:        tc,
+		Diff:            diff,
+		BothEmpty:       bothEmpty,
+		OnlyInReference: onlyInRef,
+		OnlyInTest:      onlyInTest,
+	}), nil
+}
+
+// isEmpty returns whether the range query result has no samples.
+func isEmpty(v model.Value) bool {
+	for _, s := range v.(model.Matrix) {
+		if len(s.Values) > 0 || len(s.Histograms) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// stepBoundaryDifference describes a difference in the number of points returned by both APIs or in
+// whether a point at the end of the range was returned, as implementations differ in whether the last
+// step of a range query is inclusive of the end. It returns an empty string if there is no such difference.
+func stepBoundaryDifference(tc *TestCase, refResult, testResult model.Matrix) string {
+	end := model.TimeFromUnixNano(tc.End.UnixNano())
+	describe := func(m model.Matrix) (points int, last model.Time, endIncluded bool) {
+		for _, s := range m {
+			points += len(s.Values)
+			if n := len(s.Values); n > 0 {
+				if s.Values[n-1].Timestamp > last {
+					last = s.Values[n-1].Timestamp
+				}
+				if s.Values[n-1].Timestamp == end {
+					endIncluded = true
+				}
+			}
+		}
+		return points, last, endIncluded
+	}
+
+	refPoints, refLast, refEnd := describe(refResult)
+	testPoints, testLast, testEnd := describe(testResult)
+	if refPoints == testPoints && refEnd == testEnd {
+		return ""
+	}
+	format := func(points int, last model.Time, endIncluded bool) string {
+		if points == 0 {
+			return "no points"
+		}
+		return fmt.Sprintf("%d points, last at %s, end included: %t", points, last.Time().UTC().Format(time.RFC3339Nano), endIncluded)
+	}
+	return fmt.Sprintf("step boundary differs at end %s (reference: %s, test: %s)\n",
+		tc.End.UTC().Format(time.RFC3339Nano), format(refPoints, refLast, refEnd), format(testPoints, testLast, testEnd))
+}
+
+// firstDivergences describes, for every series returned by both APIs, the first timestamp at which the
+// samples differ, as the differences are often confined to a few steps, e.g. at the edges of the range.
+func (c *Comparer) firstDivergences(refResult, testResult model.Matrix) string {
+	testSeries := make(map[string]*model.SampleStream, len(testResult))
+	for _, s := range testResult {
+		testSeries[s.Metric.String()] = s
+	}
+
+	describe := func(v *model.SamplePair) string {
+		if v == nil {
+			return "none"
+		}
+		return v.Value.String()
+	}
+
+	var res string
+	for _, ref := range refResult {
+		test, ok := testSeries[ref.Metric.String()]
+		if !ok {
+			continue
+		}
+		for i, j := 0, 0; i < len(ref.Values) || j < len(test.Values); {
+			var refV, testV *model.SamplePair
+			switch {
+			case j == len(test.Values) || (i < len(ref.Values) && ref.Values[i].Timestamp < test.Values[j].Timestamp):
+				refV = &ref.Values[i]
+				i++
+			case i == len(ref.Values) || test.Values[j].Timestamp < ref.Values[i].Timestamp:
+				testV = &test.Values[j]
+				j++
+			default:
+				refV, testV = &ref.Values[i], &test.Values[j]
+				i++
+				j++
+			}
+			if refV != nil && testV != nil && cmp.Equal(refV.Value, testV.Value, c.compareOptions) {
+				continue
+			}
+
+			ts := refV
+			if ts == nil {
+				ts = testV
+			}
+			res += fmt.Sprintf("series %s first diverges at %s (reference: %s, test: %s)\n",
+				ref.Metric, ts.Timestamp.Time().UTC().Format(time.RFC3339Nano), describe(refV), describe(testV))
+			break
+		}
+	}
+	return res
+}
+
+// seriesSetDifference returns the label sets of the series that are only in the reference result and only in
+// the test result. Labels are dropped and lowercased the same way as for the comparison of the results.
+func (c *Comparer) seriesSetDifference(refResult, testResult model.Matrix) (onlyInRef, onlyInTest []string) {
+	normalize := func(m model.Metric) string {
+		m = m.Clone()
+		for _, qt := range c.queryTweaks {
+			for _, ln := range qt.DropResultLabels {
+				delete(m, ln)
+			}
+		}
+		s := m.String()
+		for _, qt := range c.queryTweaks {
+			if qt.IgnoreCase {
+				s = strings.ToLower(s)
+			}
+		}
+		return s
+	}
+
+	refSeries := make(map[string]struct{}, len(refResult))
+	for _, s := range refResult {
+		refSeries[normalize(s.Metric)] = struct{}{}
+	}
+	testSeries := make(map[string]struct{}, len(testResult))
+	for _, s := range testResult {
+		testSeries[normalize(s.Metric)] = struct{}{}
+	}
+
+	for s := range refSeries {
+		if _, ok := testSeries[s]; !ok {
+			onlyInRef = append(onlyInRef, s)
+		}
+	}
+	for s := range testSeries {
+		if _, ok := refSeries[s]; !ok {
+			onlyInTest = append(onlyInTest, s)
+		}
+	}
+	sort.Strings(onlyInRef)
+	sort.Strings(onlyInTest)
+	return onlyInRef, onlyInTest
+}
 
+// dropLabelsBeforeCompare removes the labels configured in the DropLabelsBeforeCompare query tweaks
+// from the series of the given results in place. Matrices whose series lost labels are re-sorted, so that
+// series that only differed in the dropped labels are matched against each other.
+func (c *Comparer) dropLabelsBeforeCompare(results ...model.Value) {
+	var names []model.LabelName
+	for _, qt := range c.queryTweaks {
+		names = append(names, qt.DropLabelsBeforeCompare...)
+	}
+	if len(names) == 0 {
+		return
+	}
+
+	for _, res := range results {
+		switch v := res.(type) {
+		case model.Matrix:
+			for _, s := range v {
+				for _, ln := range names {
+					delete(s.Metric, ln)
+				}
+			}
+			sort.Sort(v)
+		case model.Vector:
+			for _, s := range v {
+				for _, ln := range names {
+					delete(s.Metric, ln)
+				}
+			}
+		}
+	}
+}
+
+// failOnBothEmpty returns true if test cases should fail when both APIs return an empty result.
+func failOnBothEmpty(queryTweaks []*config.QueryTweak) bool {
+	for _, qt := range queryTweaks {
+		if qt.FailOnBothEmpty {
+			return true
+		}
+	}
+	return false
+}
+
+// strictSeriesSet returns true if the series sets of both APIs should be compared strictly.
+func strictSeriesSet(queryTweaks []*config.QueryTweak) bool {
+	for _, qt := range queryTweaks {
+		if qt.StrictSeriesSet {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoreFirstStep drops the first step of every series of a reference range query result if configured to.
+func (c *Comparer) ignoreFirstStep(tc *TestCase, refResult model.Value) {
 	for _, qt := range c.queryTweaks {
 		if qt.IgnoreFirstStep {
 			for _, r := range refResult.(model.Matrix) {
@@ -118,17 +529,219 @@ func (c *Comparer) Compare(tc *TestCase) (*Result, error) {
 			}
 		}
 	}
+}
+
+// compareEquivalentQuery runs the test case's equivalent query with explicit timestamps as a range query against
+// both APIs. Each API's result is compared against its own result for the original query, so that an API that
+// consistently gets "@ start()" or "@ end()" wrong is still caught, and the results of both APIs are compared
+// against each other. Errors from the test API are returned as testErr, while errors from the reference API are
+// returned as err.
+func (c *Comparer) compareEquivalentQuery(ctx context.Context, tc *TestCase, r v1.Range, refResult, testResult model.Value) (diff string, testErr, err error) {
+	refEquivalent, _, err := c.refAPI.QueryRange(ctx, tc.EquivalentQuery, r)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "querying reference API for %q", tc.EquivalentQuery)
+	}
+	testEquivalent, _, testErr := c.testAPI.QueryRange(ctx, tc.EquivalentQuery, r)
+	if testErr != nil {
+		return "", errors.Wrapf(testErr, "querying test API for %q", tc.EquivalentQuery), nil
+	}
+	c.dropLabelsBeforeCompare(refEquivalent, testEquivalent)
+	sort.Sort(testEquivalent.(model.Matrix))
+	c.ignoreFirstStep(tc, refEquivalent)
+
+	if d := cmp.Diff(refResult, refEquivalent, c.compareOptions); d != "" {
+		diff += fmt.Sprintf("reference API returned different results for %q:\n%s", tc.EquivalentQuery, d)
+	}
+	if d := cmp.Diff(testResult, testEquivalent, c.compareOptions); d != "" {
+		diff += fmt.Sprintf("test API returned different results for %q:\n%s", tc.EquivalentQuery, d)
+	}
+	if d := cmp.Diff(refEquivalent, testEquivalent, c.compareOptions); d != "" {
+		diff += fmt.Sprintf("reference and test API returned different results for %q:\n%s", tc.EquivalentQuery, d)
+	}
+	return diff, nil, nil
+}
+
+// compareNativeHistogramQuery runs the test case's query over native histograms as a range query against both
+// APIs and compares each API's results against its own results for the query over classic histograms, within
+// the test case's tolerance. Native histograms are optional, so nothing is compared if either API fails the query
+// or returns no series. It returns a description of the divergence, or an empty string if the results are within the tolerance.
+func (c *Comparer) compareNativeHistogramQuery(ctx context.Context, tc *TestCase, r v1.Range, refResult, testResult model.Value) string {
+	refNative, _, refErr := c.refAPI.QueryRange(ctx, tc.NativeHistogramQuery, r)
+	testNative, _, testErr := c.testAPI.QueryRange(ctx, tc.NativeHistogramQuery, r)
+	if refErr != nil || testErr != nil {
+		return ""
+	}
+	c.dropLabelsBeforeCompare(refNative, testNative)
+	sort.Sort(testNative.(model.Matrix))
+	c.ignoreFirstStep(tc, refNative)
+
+	tolerance := tc.NativeHistogramTolerance
+	if tolerance == 0 {
+		tolerance = defaultNativeHistogramTolerance
+	}
+	options := cmp.Options{
+		cmp.Transformer("TranslateFloat64", func(in model.SampleValue) float64 {
+			return float64(in)
+		}),
+		cmpopts.EquateApprox(tolerance, 0),
+		cmpopts.EquateNaNs(),
+	}
+
+	// An empty result means that the native histograms were not ingested.
+	if len(refNative.(model.Matrix)) == 0 || len(testNative.(model.Matrix)) == 0 {
+		return ""
+	}
+
+	var diff string
+	if d := cmp.Diff(refResult, refNative, options); d != "" {
+		diff += fmt.Sprintf("reference API's results for native histograms %q diverge beyond tolerance %v:\n%s", tc.NativeHistogramQuery, tolerance, d)
+	}
+	if d := cmp.Diff(testResult, testNative, options); d != "" {
+		diff += fmt.Sprintf("test API's results for native histograms %q diverge beyond tolerance %v:\n%s", tc.NativeHistogramQuery, tolerance, d)
+	}
+	return diff
+}
+
+// compareOverCapRangeQuery runs the test case query as a range query with a step small enough for the
+// result to exceed the given number of points per series. Both APIs are expected to either fail or succeed
+// with the same results. It returns a description of the divergence, including the number of points per
+// series each API returned, or an empty string if both APIs behaved consistently.
+func (c *Comparer) compareOverCapRangeQuery(ctx context.Context, tc *TestCase, pointsCap int64) string {
+	step := tc.End.Sub(tc.Start) / time.Duration(pointsCap+1)
+	if step < time.Millisecond {
+		step = time.Millisecond
+	}
+	r := v1.Range{
+		Start: tc.Start,
+		End:   tc.End,
+		Step:  step,
+	}
+	refResult, _, refErr := c.refAPI.QueryRange(ctx, tc.Query, r)
+	testResult, _, testErr := c.testAPI.QueryRange(ctx, tc.Query, r)
+
+	describe := func(res model.Value, err error) string {
+		if err != nil {
+			return fmt.Sprintf("error %q", err)
+		}
+		return fmt.Sprintf("%d points per series", maxPointsPerSeries(res))
+	}
+
+	if refErr != nil && testErr != nil {
+		// Both APIs rejected the query consistently.
+		return ""
+	}
+	if refErr != nil || testErr != nil {
+		return fmt.Sprintf("range query with step=%v (over %d points) behaved inconsistently (reference: %s, test: %s)\n",
+			step, pointsCap, describe(refResult, refErr), describe(testResult, testErr))
+	}
+
+	c.dropLabelsBeforeCompare(refResult, testResult)
+	if m, ok := testResult.(model.Matrix); ok {
+		sort.Sort(m)
+	}
+	diff := cmp.Diff(refResult, testResult, c.compareOptions)
+	if diff == "" {
+		return ""
+	}
+	return fmt.Sprintf("range query with step=%v (over %d points) returned different results (reference: %s, test: %s):\n%s",
+		step, pointsCap, describe(refResult, refErr), describe(testResult, testErr), diff)
+}
+
+// maxPointsPerSeries returns the highest number of points of any series in a range query result.
+func maxPointsPerSeries(v model.Value) int {
+	m, ok := v.(model.Matrix)
+	if !ok {
+		return 0
+	}
+	var points int
+	for _, s := range m {
+		if n := len(s.Values) + len(s.Histograms); n > points {
+			points = n
+		}
+	}
+	return points
+}
+
+// httpMetadataHeaders returns whether HTTP metadata should be compared and which headers to compare.
+func httpMetadataHeaders(queryTweaks []*config.QueryTweak) (bool, []string) {
+	var (
+		enabled bool
+		headers []string
+	)
+	for _, qt := range queryTweaks {
+		if qt.CompareHTTPMetadata {
+			enabled = true
+		}
+		headers = append(headers, qt.HTTPMetadataHeaders...)
+	}
+	return enabled, headers
+}
 
-	return &Result{
-		TestCase: tc,
-		Diff:     cmp.Diff(refResult, testResult, c.compareOptions),
-	}, nil
+// strictHTTPStatus returns true if the HTTP status codes of failed queries should be compared as well.
+func strictHTTPStatus(queryTweaks []*config.QueryTweak) bool {
+	for _, qt := range queryTweaks {
+		if qt.StrictHTTPStatus {
+			return true
+		}
+	}
+	return false
+}
+
+// pointsCap returns the number of points per series that range queries should exceed, or 0 if none is configured.
+func pointsCap(queryTweaks []*config.QueryTweak) int64 {
+	var pc int64
+	for _, qt := range queryTweaks {
+		if qt.PointsCap != 0 {
+			pc = qt.PointsCap
+		}
+	}
+	return pc
+}
+
+// compareLimitedInstantQuery runs the test case query as an instant query at the end of the test case's
+// range with the given series limit against both APIs and returns the diff of the (possibly truncated) results.
+// Errors from the test API are returned as testErr, while errors from the reference API are returned as err.
+func (c *Comparer) compareLimitedInstantQuery(ctx context.Context, tc *TestCase, limit uint64) (diff string, testErr, err error) {
+	refResult, _, err := c.refAPI.Query(ctx, tc.Query, tc.End, v1.WithLimit(limit))
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "querying reference API for %q with limit=%d", tc.Query, limit)
+	}
+	testResult, _, testErr := c.testAPI.Query(ctx, tc.Query, tc.End, v1.WithLimit(limit))
+	if testErr != nil {
+		return "", errors.Wrapf(testErr, "querying test API with limit=%d", limit), nil
+	}
+
+	c.dropLabelsBeforeCompare(refResult, testResult)
+	// Only vectors are subject to series limits, and their order is not significant.
+	if v, ok := refResult.(model.Vector); ok {
+		sort.Sort(v)
+	}
+	if v, ok := testResult.(model.Vector); ok {
+		sort.Sort(v)
+	}
+
+	return cmp.Diff(refResult, testResult, c.compareOptions), nil, nil
+}
+
+// queryLimit returns the series limit to use for instant queries, or 0 if none is configured.
+func queryLimit(queryTweaks []*config.QueryTweak) uint64 {
+	var limit uint64
+	for _, qt := range queryTweaks {
+		if qt.QueryLimit != 0 {
+			limit = qt.QueryLimit
+		}
+	}
+	return limit
 }
 
 func addFloatCompareOptions(queryTweaks []*config.QueryTweak, options *cmp.Options) {
 	fraction := defaultFraction
 	margin := defaultMargin
+	digits := 0
 	for _, rt := range queryTweaks {
+		if rt.RoundToSignificantDigits > 0 {
+			digits = rt.RoundToSignificantDigits
+		}
 		if rt.AdjustValueTolerance != nil {
 			if rt.AdjustValueTolerance.Fraction != nil {
 				fraction = *rt.AdjustValueTolerance.Fraction
@@ -142,6 +755,9 @@ func addFloatCompareOptions(queryTweaks []*config.QueryTweak, options *cmp.Optio
 		*options,
 		// Translate sample values into float64 so that cmpopts.EquateApprox() works.
 		cmp.Transformer("TranslateFloat64", func(in model.SampleValue) float64 {
+			if digits > 0 {
+				return roundToSignificantDigits(float64(in), digits)
+			}
 			return float64(in)
 		}),
 		cmpopts.EquateApprox(fraction, margin),
@@ -150,6 +766,18 @@ func addFloatCompareOptions(queryTweaks []*config.QueryTweak, options *cmp.Optio
 	)
 }
 
+// roundToSignificantDigits rounds v to the given number of significant digits.
+func roundToSignificantDigits(v float64, digits int) float64 {
+	if v == 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+		return v
+	}
+	scale := math.Pow(10, float64(digits)-math.Ceil(math.Log10(math.Abs(v))))
+	if math.IsInf(scale, 0) {
+		return v
+	}
+	return math.Round(v*scale) / scale
+}
+
 func addDropResultLabelsOptions(queryTweaks []*config.QueryTweak, options *cmp.Options) {
 	for _, rt := range queryTweaks {
 		if len(rt.DropResultLabels) != 0 {
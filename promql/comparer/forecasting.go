@@ -0,0 +1,105 @@
+package comparer
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// functionAliases maps functions to the name they have in other Prometheus versions: holt_winters was
+// renamed to double_exponential_smoothing in Prometheus 3.0.
+var functionAliases = map[string]string{
+	"holt_winters":                 "double_exponential_smoothing",
+	"double_exponential_smoothing": "holt_winters",
+}
+
+// aliasWarningPrefix marks the warnings of an aliasingAPI about running a query with a function alias.
+const aliasWarningPrefix = "function alias: "
+
+var unknownFunctionRE = regexp.MustCompile(`unknown function with name "([a-z_]+)"`)
+
+// aliasQuery returns the query with the function renamed to its alias and a warning about it, if the
+// query failed with an error about the function being unknown and the function has an alias.
+func aliasQuery(query string, err error) (aliased, warning string, ok bool) {
+	if err == nil {
+		return "", "", false
+	}
+	m := unknownFunctionRE.FindStringSubmatch(err.Error())
+	if m == nil {
+		return "", "", false
+	}
+	alias, ok := functionAliases[m[1]]
+	if !ok {
+		return "", "", false
+	}
+	re := regexp.MustCompile(`\b` + m[1] + `\s*\(`)
+	return re.ReplaceAllString(query, alias+"("), fmt.Sprintf("%sran %s instead of %s, which it does not know", aliasWarningPrefix, alias, m[1]), true
+}
+
+// aliasingAPI runs queries again with the alias of a function if the wrapped API does not know the
+// function by the name used in the query, and returns a warning about it.
+type aliasingAPI struct {
+	PromAPI
+}
+
+// Query implements PromAPI.
+func (a aliasingAPI) Query(ctx context.Context, query string, ts time.Time, opts ...v1.Option) (model.Value, v1.Warnings, error) {
+	v, warnings, err := a.PromAPI.Query(ctx, query, ts, opts...)
+	if aliased, warning, ok := aliasQuery(query, err); ok {
+		v, warnings, err = a.PromAPI.Query(ctx, aliased, ts, opts...)
+		warnings = append(warnings, warning)
+	}
+	return v, warnings, err
+}
+
+// QueryRange implements PromAPI.
+func (a aliasingAPI) QueryRange(ctx context.Context, query string, r v1.Range, opts ...v1.Option) (model.Value, v1.Warnings, error) {
+	v, warnings, err := a.PromAPI.QueryRange(ctx, query, r, opts...)
+	if aliased, warning, ok := aliasQuery(query, err); ok {
+		v, warnings, err = a.PromAPI.QueryRange(ctx, aliased, r, opts...)
+		warnings = append(warnings, warning)
+	}
+	return v, warnings, err
+}
+
+// aliasWarnings returns the warnings about function aliases among the warnings of the named API.
+func aliasWarnings(api string, warnings v1.Warnings) []string {
+	var res []string
+	for _, w := range warnings {
+		if strings.HasPrefix(w, aliasWarningPrefix) {
+			res = append(res, api+" API "+strings.TrimPrefix(w, aliasWarningPrefix))
+		}
+	}
+	return res
+}
+
+// forecastingFuncs are the functions that extrapolate from the samples in their input window, whose
+// results are numerically sensitive to the handling of the window's edges.
+var forecastingFuncs = map[string]bool{
+	"predict_linear":               true,
+	"holt_winters":                 true,
+	"double_exponential_smoothing": true,
+}
+
+// describeForecastingCall describes a call to a forecasting function with its input window. The call is
+// described with the function name used in the query, which is renamed if the query was parsed with its alias.
+func describeForecastingCall(call *parser.Call, renamed string) string {
+	s := call.String()
+	if renamed != "" {
+		s = strings.ReplaceAll(s, functionAliases[renamed]+"(", renamed+"(")
+	}
+	var window time.Duration
+	switch arg := call.Args[0].(type) {
+	case *parser.MatrixSelector:
+		window = arg.Range
+	case *parser.SubqueryExpr:
+		window = arg.Range
+	}
+	return fmt.Sprintf("`%s` (input window: %s before each step)", s, model.Duration(window))
+}
@@ -0,0 +1,86 @@
+package comparer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/api"
+	"github.com/prometheus/compliance/promql/config"
+)
+
+// HTTPMetadata describes the HTTP status code and selected headers of a query response.
+type HTTPMetadata struct {
+	StatusCode int               `json:"statusCode"`
+	Headers    map[string]string `json:"headers,omitempty"`
+}
+
+type httpResponseKey struct{}
+
+// httpResponse holds the last HTTP response received for a query.
+type httpResponse struct {
+	statusCode int
+	header     http.Header
+}
+
+// RecordHTTPMetadata wraps an API client so that the comparer can record the HTTP
+// status code and headers of query responses when comparing HTTP metadata.
+func RecordHTTPMetadata(c api.Client) api.Client {
+	return httpMetadataClient{Client: c}
+}
+
+type httpMetadataClient struct {
+	api.Client
+}
+
+func (c httpMetadataClient) Do(ctx context.Context, req *http.Request) (*http.Response, []byte, error) {
+	resp, body, err := c.Client.Do(ctx, req)
+	if r, ok := ctx.Value(httpResponseKey{}).(*httpResponse); ok && resp != nil {
+		r.statusCode = resp.StatusCode
+		r.header = resp.Header.Clone()
+	}
+	return resp, body, err
+}
+
+// withHTTPResponse returns a context that records the HTTP response of a query into r.
+func withHTTPResponse(ctx context.Context, r *httpResponse) context.Context {
+	return context.WithValue(ctx, httpResponseKey{}, r)
+}
+
+// metadata returns the HTTP metadata of the response, restricted to the given headers.
+// Values of headers holding credentials are redacted. It returns nil if no response was recorded.
+func (r *httpResponse) metadata(headers []string) *HTTPMetadata {
+	if r.statusCode == 0 {
+		return nil
+	}
+	md := &HTTPMetadata{StatusCode: r.statusCode}
+	for _, h := range headers {
+		if v := r.header.Get(h); v != "" {
+			if md.Headers == nil {
+				md.Headers = map[string]string{}
+			}
+			md.Headers[http.CanonicalHeaderKey(h)] = config.RedactHeader(h, v)
+		}
+	}
+	return md
+}
+
+// compareHTTPMetadata returns a warning for every difference between the reference and test HTTP metadata.
+// If both queries failed and sameQueryError is true, the status codes are not compared, since they are the
+// same query error outcome, e.g. a 200 with an error status and a 400, or a 400 and a 422.
+func compareHTTPMetadata(ref, test *HTTPMetadata, headers []string, sameQueryError bool) []string {
+	if ref == nil || test == nil {
+		return nil
+	}
+	var warnings []string
+	if ref.StatusCode != test.StatusCode && !sameQueryError {
+		warnings = append(warnings, fmt.Sprintf("HTTP status code differs (reference: %d, test: %d)", ref.StatusCode, test.StatusCode))
+	}
+	for _, h := range headers {
+		h = http.CanonicalHeaderKey(h)
+		if ref.Headers[h] != test.Headers[h] {
+			warnings = append(warnings, fmt.Sprintf("HTTP header %q differs (reference: %q, test: %q)", h, ref.Headers[h], test.Headers[h]))
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,24 @@
+package comparer
+
+import "testing"
+
+func TestCompareHTTPMetadataStatusCodes(t *testing.T) {
+	for _, tc := range []struct {
+		ref, test      int
+		sameQueryError bool
+		warn           bool
+	}{
+		{ref: 200, test: 200},
+		{ref: 200, test: 503, warn: true},
+		{ref: 400, test: 422, warn: true},
+		{ref: 400, test: 422, sameQueryError: true},
+		{ref: 500, test: 503, sameQueryError: true},
+		{ref: 400, test: 503, sameQueryError: true},
+		{ref: 200, test: 400, sameQueryError: true},
+	} {
+		warnings := compareHTTPMetadata(&HTTPMetadata{StatusCode: tc.ref}, &HTTPMetadata{StatusCode: tc.test}, nil, tc.sameQueryError)
+		if warn := len(warnings) > 0; warn != tc.warn {
+			t.Errorf("status codes %d and %d (same query error: %t): expected warning %t, got %v", tc.ref, tc.test, tc.sameQueryError, tc.warn, warnings)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+package comparer
+
+// edgeValueFuncs are the math functions whose handling of NaN, infinite and negative inputs and bounds
+// often differs between implementations.
+var edgeValueFuncs = map[string]bool{
+	"clamp":     true,
+	"clamp_min": true,
+	"clamp_max": true,
+	"round":     true,
+}
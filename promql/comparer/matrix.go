@@ -0,0 +1,111 @@
+package comparer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// isMatrixQuery returns whether the query returns a range vector, e.g. a bare matrix selector, which
+// can only be evaluated by instant queries.
+func isMatrixQuery(query string) bool {
+	expr, err := parser.ParseExpr(query)
+	return err == nil && expr.Type() == parser.ValueTypeMatrix
+}
+
+// compareMatrixQuery compares the samples both APIs return for a range vector query, evaluated by instant
+// queries at the start and the end of the range of the test case. This checks that both APIs select
+// the same samples within each window, as implementations differ in whether the start of the window
+// is inclusive and in the lookback of the samples.
+func (c *Comparer) compareMatrixQuery(ctx context.Context, tc *TestCase) (*Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	res := &Result{TestCase: tc, BothEmpty: true}
+	for _, ts := range []time.Time{tc.Start, tc.End} {
+		refStart := time.Now()
+		refResult, _, refErr := c.refAPI.Query(ctx, tc.Query, ts)
+		refTarget := newTargetResult(refResult, httpResponse{}, time.Since(refStart), refErr)
+		testStart := time.Now()
+		testResult, _, testErr := c.testAPI.Query(ctx, tc.Query, ts)
+		testTarget := newTargetResult(testResult, httpResponse{}, time.Since(testStart), testErr)
+		res.ReferenceResult, res.TestResult = refTarget, testTarget
+
+		if (refErr != nil) != tc.ShouldFail {
+			if refErr != nil {
+				return nil, errors.Wrapf(refErr, "querying reference API for %q at %v", tc.Query, ts)
+			}
+			return nil, fmt.Errorf("expected reference API query %q to fail, but succeeded", tc.Query)
+		}
+		if (testErr != nil) != tc.ShouldFail {
+			if testErr != nil {
+				res.UnexpectedFailure = testErr.Error()
+				res.Unsupported = strings.Contains(testErr.Error(), "501")
+			} else {
+				res.UnexpectedSuccess = true
+			}
+			return res, nil
+		}
+		if tc.SkipComparison || tc.ShouldFail {
+			continue
+		}
+
+		refMatrix, refOK := refResult.(model.Matrix)
+		testMatrix, testOK := testResult.(model.Matrix)
+		if !refOK || !testOK {
+			res.Diff += fmt.Sprintf("window ending at %s returned a %s from the reference API and a %s from the test API\n",
+				ts.UTC().Format(time.RFC3339Nano), refResult.Type(), testResult.Type())
+			continue
+		}
+		res.BothEmpty = res.BothEmpty && isEmpty(refMatrix) && isEmpty(testMatrix)
+
+		c.dropLabelsBeforeCompare(refMatrix, testMatrix)
+		sort.Sort(refMatrix)
+		sort.Sort(testMatrix)
+		if diff := cmp.Diff(refMatrix, testMatrix, c.compareOptions); diff != "" {
+			res.Diff += fmt.Sprintf("window ending at %s returned different samples (%s):\n%s%s",
+				ts.UTC().Format(time.RFC3339Nano), describeWindows(refMatrix, testMatrix),
+				c.firstDivergences(refMatrix, testMatrix), diff)
+		}
+	}
+	if res.BothEmpty && failOnBothEmpty(c.queryTweaks) && !tc.SkipComparison && !tc.ShouldFail {
+		res.Diff = "both APIs returned an empty result, the queried data may be missing from both\n" + res.Diff
+	}
+	return res, nil
+}
+
+// describeWindows describes the number of samples and the first and last sample timestamps that both
+// APIs returned for a range vector, which tell whether the windows of both APIs are aligned.
+func describeWindows(refResult, testResult model.Matrix) string {
+	describe := func(m model.Matrix) string {
+		var (
+			samples     int
+			first, last model.Time
+		)
+		for _, s := range m {
+			if len(s.Values) == 0 {
+				continue
+			}
+			if f := s.Values[0].Timestamp; samples == 0 || f < first {
+				first = f
+			}
+			samples += len(s.Values)
+			if l := s.Values[len(s.Values)-1].Timestamp; l > last {
+				last = l
+			}
+		}
+		if samples == 0 {
+			return "no samples"
+		}
+		return fmt.Sprintf("%d samples from %s to %s", samples,
+			first.Time().UTC().Format(time.RFC3339Nano), last.Time().UTC().Format(time.RFC3339Nano))
+	}
+	return fmt.Sprintf("reference: %s, test: %s", describe(refResult), describe(testResult))
+}
@@ -0,0 +1,75 @@
+package comparer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// parseQuery parses the query of a test case to describe its divergences. Functions unknown to the
+// vendored parser are parsed by their alias, and renamed is the name used in the query of such a function.
+func parseQuery(query string) (expr parser.Expr, renamed string, err error) {
+	parsed := query
+	for name, alias := range functionAliases {
+		if _, ok := parser.Functions[name]; !ok && strings.Contains(query, name+"(") {
+			parsed, renamed = strings.ReplaceAll(query, name+"(", alias+"("), name
+		}
+	}
+	expr, err = parser.ParseExpr(parsed)
+	return expr, renamed, err
+}
+
+// divergenceNotes describes the parts of the query whose handling often differs between implementations,
+// and the differences in the step boundaries of the results, to precede the diff of a diverging test case.
+// The expression may be nil if the query could not be parsed. It returns an empty string if there is
+// nothing to note.
+func divergenceNotes(tc *TestCase, expr parser.Expr, renamed string, refResult, testResult model.Matrix) string {
+	var (
+		binaryOps, mathCalls, forecastingCalls, calendarCalls []string
+		absent                                                string
+	)
+	if expr != nil {
+		parser.Inspect(expr, func(node parser.Node, path []parser.Node) error {
+			switch n := node.(type) {
+			case *parser.BinaryExpr:
+				if op, ok := describeBinaryOp(n); ok {
+					binaryOps = append(binaryOps, op)
+				}
+			case *parser.Call:
+				switch {
+				case edgeValueFuncs[n.Func.Name]:
+					mathCalls = append(mathCalls, "`"+n.String()+"`")
+				case forecastingFuncs[n.Func.Name] && len(n.Args) > 0:
+					forecastingCalls = append(forecastingCalls, describeForecastingCall(n, renamed))
+				case IsCalendarFunc(n.Func.Name):
+					calendarCalls = append(calendarCalls, "`"+n.String()+"`")
+				case len(path) == 0 && isAbsentCall(n):
+					// Only an absent() call at the top level determines the labels of the result.
+					absent = describeAbsentCall(n, refResult, testResult)
+				}
+			}
+			return nil
+		})
+	}
+
+	var notes string
+	if len(binaryOps) > 0 {
+		notes += fmt.Sprintf("comparison and set operations of the diverging query: %s\n", strings.Join(binaryOps, ", "))
+	}
+	if len(mathCalls) > 0 {
+		notes += fmt.Sprintf("math function calls of the diverging query: %s\n", strings.Join(mathCalls, ", "))
+	}
+	if len(forecastingCalls) > 0 {
+		notes += fmt.Sprintf("forecasting function calls of the diverging query: %s\n", strings.Join(forecastingCalls, ", "))
+	}
+	if len(calendarCalls) > 0 {
+		tz := "UTC"
+		if tc.TimeZone != "" {
+			tz = tc.TimeZone
+		}
+		notes += fmt.Sprintf("calendar function calls of the diverging query, evaluated in %s: %s\n", tz, strings.Join(calendarCalls, ", "))
+	}
+	return notes + absent + stepBoundaryDifference(tc, refResult, testResult)
+}
@@ -0,0 +1,57 @@
+package comparer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestDivergenceNotes(t *testing.T) {
+	end := time.Unix(600, 0)
+	tc := &TestCase{Start: end.Add(-time.Minute), End: end, Resolution: time.Minute}
+	result := model.Matrix{{
+		Metric: model.Metric{"job": "demo"},
+		Values: []model.SamplePair{{Timestamp: model.TimeFromUnix(540), Value: 1}, {Timestamp: model.TimeFromUnix(600), Value: 1}},
+	}}
+
+	for _, c := range []struct {
+		query, expected string
+	}{
+		{query: "demo_num_cpus"},
+		{
+			query:    "demo_num_cpus > bool on(job) group_left(instance) clamp_min(demo_num_cpus, 0)",
+			expected: "comparison and set operations of the diverging query: `> bool on(job) group_left(instance)`\nmath function calls of the diverging query: `clamp_min(demo_num_cpus, 0)`\n",
+		},
+		{
+			query:    "predict_linear(demo_disk_usage_bytes[5m], 600) and round(demo_disk_usage_bytes)",
+			expected: "comparison and set operations of the diverging query: `and`\nmath function calls of the diverging query: `round(demo_disk_usage_bytes)`\nforecasting function calls of the diverging query: `predict_linear(demo_disk_usage_bytes[5m], 600)` (input window: 5m before each step)\n",
+		},
+		{
+			query:    "month(vector(time())) > bool day_of_week()",
+			expected: "comparison and set operations of the diverging query: `> bool`\ncalendar function calls of the diverging query, evaluated in UTC: `month(vector(time()))`, `day_of_week()`\n",
+		},
+		{
+			query:    `absent(nonexistent{job="demo"})`,
+			expected: "labels synthesized by `absent(nonexistent{job=\"demo\"})`: expected {job=\"demo\"}, reference: {job=\"demo\"}, test: {job=\"demo\"}\n",
+		},
+		{
+			// Only top-level absent() calls are described.
+			query: `sum(absent(nonexistent{job="demo"}))`,
+		},
+	} {
+		expr, renamed, err := parseQuery(c.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := divergenceNotes(tc, expr, renamed, result, result); got != c.expected {
+			t.Errorf("%s: expected notes\n%q\ngot\n%q", c.query, c.expected, got)
+		}
+	}
+
+	// The step boundary difference is noted without an expression, too.
+	truncated := model.Matrix{{Metric: result[0].Metric, Values: result[0].Values[:1]}}
+	if got := divergenceNotes(tc, nil, "", result, truncated); got == "" {
+		t.Error("expected a step boundary note")
+	}
+}
@@ -2,7 +2,11 @@ package config
 
 import (
 	"bytes"
+	"fmt"
 	"os"
+	"regexp"
+	"strconv"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/prometheus/common/model"
@@ -16,23 +20,85 @@ type Config struct {
 	QueryTweaks           []*QueryTweak       `yaml:"query_tweaks"`
 	TestCases             []*TestCase         `yaml:"test_cases"`
 	QueryTimeParameters   QueryTimeParameters `yaml:"query_time_parameters"`
+	KnownDifferences      []*KnownDifference  `yaml:"known_differences"`
+	SeedData              *SeedData           `yaml:"seed_data,omitempty"`
+}
+
+// SeedData configures pushing the same synthetic data to both targets via remote write before running
+// the test cases, for targets that don't contain the series queried by the test cases yet.
+type SeedData struct {
+	// ProbeQuery has to return data from both targets at the end of the query time range before the
+	// test cases are run. Default: demo_memory_usage_bytes.
+	ProbeQuery string `yaml:"probe_query,omitempty"`
+	// WaitTimeout is the maximum time to wait for the probe query to return data. Default: 5m.
+	WaitTimeout model.Duration `yaml:"wait_timeout,omitempty"`
+}
+
+// A KnownDifference is an accepted divergence of the test target from the reference target.
+// Failing test cases whose query matches it are reported as a known difference instead of a failure.
+type KnownDifference struct {
+	// Query is a regular expression that has to match the full expanded query.
+	Query  string `yaml:"query" json:"query"`
+	Reason string `yaml:"reason,omitempty" json:"reason,omitempty"`
+
+	queryRegexp *regexp.Regexp
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (kd *KnownDifference) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain KnownDifference
+	if err := unmarshal((*plain)(kd)); err != nil {
+		return err
+	}
+	re, err := regexp.Compile("^(?:" + kd.Query + ")$")
+	if err != nil {
+		return errors.Wrapf(err, "compiling known difference query regex %q", kd.Query)
+	}
+	kd.queryRegexp = re
+	return nil
+}
+
+// Matches returns true if the given query is covered by the known difference.
+func (kd *KnownDifference) Matches(query string) bool {
+	return kd.queryRegexp != nil && kd.queryRegexp.MatchString(query)
 }
 
 type QueryTimeParameters struct {
 	EndTime             string  `yaml:"end_time"`
 	RangeInSeconds      float64 `yaml:"range_in_seconds"`
 	ResolutionInSeconds float64 `yaml:"resolution_in_seconds"`
+	// TimeWindows are explicit time ranges to run all the test cases in, instead of the single time range
+	// derived from EndTime and RangeInSeconds. ResolutionInSeconds applies to all of them.
+	TimeWindows []TimeWindow `yaml:"time_windows,omitempty"`
+	// ChunkInSeconds splits longer time ranges at every multiple of it into chunks that are queried and
+	// compared separately, e.g. for long historical ranges that exceed the points limit of a single query.
+	ChunkInSeconds float64 `yaml:"chunk_in_seconds,omitempty"`
+}
+
+// A TimeWindow is a time range to run the test cases in, e.g. around a DST change. Start and End have
+// the same format as EndTime: a Unix timestamp in seconds or RFC3339.
+type TimeWindow struct {
+	Name  string `yaml:"name,omitempty"`
+	Start string `yaml:"start"`
+	End   string `yaml:"end"`
 }
 
 // TargetConfig represents the configuration of a single Prometheus API endpoint.
 type TargetConfig struct {
 	QueryURL      string            `yaml:"query_url"`
 	BasicAuthUser string            `yaml:"basic_auth_user"`
-	BasicAuthPass string            `yaml:"basic_auth_pass"`
+	BasicAuthPass Secret            `yaml:"basic_auth_pass"`
 	Headers       map[string]string `yaml:"headers"`
 	TSDBPath      string            `yaml:"tsdb_path"`
+	// RemoteWriteURL is the URL to push the seed data to, required if seed_data is set.
+	RemoteWriteURL string `yaml:"remote_write_url,omitempty"`
+	// Tenant is set as the TenantHeader of every query to this target, if not empty.
+	Tenant string `yaml:"tenant,omitempty"`
 }
 
+// TenantHeader is the HTTP header used by multi-tenant backends to identify the tenant.
+const TenantHeader = "X-Scope-OrgID"
+
 // A QueryTweak restricts or modifies a query in certain ways that avoids certain systematic errors and/or later comparison problems.
 type QueryTweak struct {
 	Note                   string                `yaml:"note" json:"note"`
@@ -44,6 +110,36 @@ type QueryTweak struct {
 	IgnoreFirstStep        bool                  `yaml:"ignore_first_step" json:"ignoreFirstStep,omitempty"`
 	IgnoreCase             bool                  `yaml:"ignore_case" json:"ignoreCase,omitempty"`
 	AdjustValueTolerance   *AdjustValueTolerance `yaml:"adjust_value_tolerance" json:"adjustValueTolerance,omitempty"`
+	// QueryLimit additionally runs every test case as an instant query with the "limit" parameter set
+	// to this value and compares the (possibly truncated) results between both targets.
+	QueryLimit uint64 `yaml:"query_limit" json:"queryLimit,omitempty"`
+	// PointsCap additionally runs every test case as a range query with a step derived from the range so
+	// that it exceeds this number of points per series, and checks that both targets either fail or adjust
+	// the step consistently.
+	PointsCap int64 `yaml:"points_cap" json:"pointsCap,omitempty"`
+	// CompareHTTPMetadata records the HTTP status code and the HTTPMetadataHeaders of the responses to
+	// the range queries and reports differences between both targets as warnings.
+	CompareHTTPMetadata bool     `yaml:"compare_http_metadata" json:"compareHTTPMetadata,omitempty"`
+	HTTPMetadataHeaders []string `yaml:"http_metadata_headers" json:"httpMetadataHeaders,omitempty"`
+	// StrictHTTPStatus also reports differing HTTP status codes when the query failed on both targets, e.g. 400 and
+	// 422, or 200 and 400. By default, any two failures are treated as the same query error outcome.
+	StrictHTTPStatus bool `yaml:"strict_http_status" json:"strictHTTPStatus,omitempty"`
+	// StrictSeriesSet lists the series that are returned by only one of the targets in the result and
+	// makes such test cases fail even if they are covered by a known difference.
+	StrictSeriesSet bool `yaml:"strict_series_set" json:"strictSeriesSet,omitempty"`
+	// DropLabelsBeforeCompare removes the given labels from the results of both targets before their series
+	// are matched, unlike DropResultLabels, which only ignores them when comparing already matched series.
+	DropLabelsBeforeCompare []model.LabelName `yaml:"drop_labels_before_compare" json:"dropLabelsBeforeCompare,omitempty"`
+	// RoundToSignificantDigits rounds the sample values of both targets to this number of significant
+	// digits before comparing them, to ignore differences in the trailing digits only.
+	RoundToSignificantDigits int `yaml:"round_to_significant_digits" json:"roundToSignificantDigits,omitempty"`
+	// TimeZone is the time zone (e.g. "Europe/Berlin" or "UTC") the test target evaluates calendar functions
+	// like hour() in. For test cases calling a calendar function at the top level of the query, the expected
+	// results are computed from the reference target's results for the function's argument in this time zone.
+	TimeZone string `yaml:"time_zone" json:"timeZone,omitempty"`
+	// FailOnBothEmpty makes test cases fail if both targets return an empty result, which usually means
+	// that the data queried by the test case is missing from both targets rather than that they agree.
+	FailOnBothEmpty bool `yaml:"fail_on_both_empty" json:"failOnBothEmpty,omitempty"`
 }
 
 type AdjustValueTolerance struct {
@@ -57,33 +153,101 @@ type TestCase struct {
 	VariantArgs    []string `yaml:"variant_args,omitempty"`
 	SkipComparison bool     `yaml:"skip_comparison,omitempty"`
 	ShouldFail     bool     `yaml:"should_fail,omitempty"`
+	// RequiresSeedData marks test cases that query series only found in the seed data. They are skipped
+	// unless the seed_data section is set.
+	RequiresSeedData bool `yaml:"requires_seed_data,omitempty"`
+	// NativeHistogramQuery is the query over native histograms that is equivalent to the query over
+	// classic histograms. If both targets support it, each target's results for both queries are expected
+	// to be within NativeHistogramTolerance (a fraction, default 0.1) of each other.
+	NativeHistogramQuery     string  `yaml:"native_histogram_query,omitempty"`
+	NativeHistogramTolerance float64 `yaml:"native_histogram_tolerance,omitempty"`
 }
 
 // LoadFromFiles parses the given YAML files into a Config.
+// Errors for unknown or malformed keys point at the file and the line within it.
 func LoadFromFiles(filenames []string) (*Config, error) {
-	var buf bytes.Buffer
+	var (
+		buf   bytes.Buffer
+		files []fileLines
+	)
 	for _, f := range filenames {
 		content, err := os.ReadFile(f)
 		if err != nil {
 			return nil, errors.Wrapf(err, "reading config file %s", f)
 		}
+		files = append(files, fileLines{name: f, start: bytes.Count(buf.Bytes(), []byte("\n")) + 1})
 		if _, err := buf.Write(content); err != nil {
 			return nil, errors.Wrapf(err, "appending config file %s to buffer", f)
 		}
 	}
 	cfg, err := Load(buf.Bytes())
 	if err != nil {
-		return nil, errors.Wrapf(err, "parsing YAML files %s", filenames)
+		return nil, errors.Errorf("parsing YAML files %s: %s", filenames, fileLineErrorMessage(err, files))
 	}
 	return cfg, nil
 }
 
-// Load parses the YAML input into a Config.
+// fileLines is the first line of a file within the concatenated config files.
+type fileLines struct {
+	name  string
+	start int
+}
+
+var lineRegexp = regexp.MustCompile(`line (\d+)`)
+
+// fileLineErrorMessage returns the error message with the line numbers of the concatenated
+// config files replaced by the file name and the line within that file.
+func fileLineErrorMessage(err error, files []fileLines) string {
+	return lineRegexp.ReplaceAllStringFunc(err.Error(), func(m string) string {
+		line, convErr := strconv.Atoi(lineRegexp.FindStringSubmatch(m)[1])
+		if convErr != nil {
+			return m
+		}
+		for i := len(files) - 1; i >= 0; i-- {
+			if line >= files[i].start {
+				return fmt.Sprintf("%s line %d", files[i].name, line-files[i].start+1)
+			}
+		}
+		return m
+	})
+}
+
+// Load parses the YAML input into a Config. Unknown keys are rejected.
 func Load(content []byte) (*Config, error) {
 	cfg := &Config{}
 	err := yaml.UnmarshalStrict(content, cfg)
 	if err != nil {
 		return nil, err
 	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
 	return cfg, nil
 }
+
+// Validate checks that all required fields of the Config are set.
+func (c *Config) Validate() error {
+	if c.ReferenceTargetConfig.QueryURL == "" {
+		return errors.New("reference_target_config.query_url is required: set it to the base URL of the Prometheus API to compare against, e.g. http://localhost:9090/")
+	}
+	if c.TestTargetConfig.QueryURL == "" {
+		return errors.New("test_target_config.query_url is required: set it to the base URL of the Prometheus-compatible API under test")
+	}
+	for _, t := range c.QueryTweaks {
+		if t.TimeZone == "" {
+			continue
+		}
+		if _, err := time.LoadLocation(t.TimeZone); err != nil {
+			return errors.Wrapf(err, "query_tweaks: invalid time_zone %q: set it to a name from the IANA time zone database, e.g. Europe/Berlin", t.TimeZone)
+		}
+	}
+	if c.SeedData != nil {
+		if c.ReferenceTargetConfig.RemoteWriteURL == "" {
+			return errors.New("reference_target_config.remote_write_url is required when seed_data is set: set it to the remote write endpoint of the reference target, e.g. http://localhost:9090/api/v1/write")
+		}
+		if c.TestTargetConfig.RemoteWriteURL == "" {
+			return errors.New("test_target_config.remote_write_url is required when seed_data is set: set it to the remote write endpoint of the target under test")
+		}
+	}
+	return nil
+}
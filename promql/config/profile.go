@@ -0,0 +1,82 @@
+package config
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/prometheus/compliance/promql"
+)
+
+// profilePrefix is the prefix of the names of the bundled test configuration files that profiles are read from.
+const profilePrefix = "test-"
+
+// A Profile is a bundled set of query tweaks and known differences for a specific backend. The profile of a
+// backend is read from the query tweaks and known differences of its test-<backend>.yml configuration file.
+type Profile struct {
+	QueryTweaks      []*QueryTweak      `yaml:"query_tweaks"`
+	KnownDifferences []*KnownDifference `yaml:"known_differences"`
+}
+
+// Profiles returns the names of the bundled profiles: the backends whose test configuration file has any
+// query tweaks or known differences.
+func Profiles() []string {
+	entries, err := promql.TestConfigs.ReadDir(".")
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, e := range entries {
+		name := strings.TrimSuffix(strings.TrimPrefix(e.Name(), profilePrefix), ".yml")
+		if p, err := LoadProfile(name); err == nil && (len(p.QueryTweaks) > 0 || len(p.KnownDifferences) > 0) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadProfile parses the bundled profile with the given name.
+func LoadProfile(name string) (*Profile, error) {
+	content, err := promql.TestConfigs.ReadFile(profilePrefix + name + ".yml")
+	if err != nil {
+		return nil, errors.Errorf("unknown profile %q, valid profiles: %s", name, strings.Join(Profiles(), ", "))
+	}
+	// The test configuration files also configure the targets, which are not part of the profile.
+	p := &Profile{}
+	if err := yaml.Unmarshal(content, p); err != nil {
+		return nil, errors.Wrapf(err, "parsing profile %q", name)
+	}
+	return p, nil
+}
+
+// ApplyProfile adds the query tweaks and known differences of the profile to the Config. The Config
+// overrides the profile: query tweaks with the same note and known differences with the same query
+// as one of the Config replace the ones of the profile.
+func (c *Config) ApplyProfile(p *Profile) {
+	notes := make(map[string]bool, len(c.QueryTweaks))
+	for _, t := range c.QueryTweaks {
+		notes[t.Note] = true
+	}
+	var tweaks []*QueryTweak
+	for _, t := range p.QueryTweaks {
+		if !notes[t.Note] {
+			tweaks = append(tweaks, t)
+		}
+	}
+	c.QueryTweaks = append(tweaks, c.QueryTweaks...)
+
+	queries := make(map[string]bool, len(c.KnownDifferences))
+	for _, kd := range c.KnownDifferences {
+		queries[kd.Query] = true
+	}
+	var kds []*KnownDifference
+	for _, kd := range p.KnownDifferences {
+		if !queries[kd.Query] {
+			kds = append(kds, kd)
+		}
+	}
+	c.KnownDifferences = append(kds, c.KnownDifferences...)
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+)
+
+const redacted = "<redacted>"
+
+// Secret is a string holding a credential. It is redacted when printed or marshaled,
+// so that it does not leak into the output or logs.
+type Secret string
+
+// String implements the fmt.Stringer interface.
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+// MarshalYAML implements the yaml.Marshaler interface.
+func (s Secret) MarshalYAML() (interface{}, error) {
+	return s.String(), nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// sensitiveHeaders are the HTTP headers whose values are credentials.
+var sensitiveHeaders = map[string]struct{}{
+	"Authorization":       {},
+	"Proxy-Authorization": {},
+	"Cookie":              {},
+	"Set-Cookie":          {},
+}
+
+// IsSensitiveHeader returns true if the value of the given HTTP header is a credential.
+func IsSensitiveHeader(name string) bool {
+	_, ok := sensitiveHeaders[http.CanonicalHeaderKey(name)]
+	return ok
+}
+
+// RedactHeader returns the value of the given HTTP header, or a placeholder if it is a credential.
+func RedactHeader(name, value string) string {
+	if value != "" && IsSensitiveHeader(name) {
+		return redacted
+	}
+	return value
+}
+
+// Redacted returns a copy of the target config with the passwords in the URLs and the values
+// of all sensitive headers redacted. Secrets are redacted when marshaled and do not need to be changed.
+func (tc TargetConfig) Redacted() TargetConfig {
+	tc.QueryURL = RedactURL(tc.QueryURL)
+	if tc.RemoteWriteURL != "" {
+		tc.RemoteWriteURL = RedactURL(tc.RemoteWriteURL)
+	}
+	if len(tc.Headers) > 0 {
+		headers := make(map[string]string, len(tc.Headers))
+		for k, v := range tc.Headers {
+			headers[k] = RedactHeader(k, v)
+		}
+		tc.Headers = headers
+	}
+	return tc
+}
+
+// RedactURL returns the URL with the password of its user info redacted.
+func RedactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Redacted()
+}
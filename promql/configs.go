@@ -0,0 +1,10 @@
+// Package promql bundles the example configuration files of the compliance tester, whose query tweaks
+// and known differences are used as the profiles of the backends.
+package promql
+
+import "embed"
+
+// TestConfigs holds the test-<backend>.yml configuration files.
+//
+//go:embed test-*.yml
+var TestConfigs embed.FS
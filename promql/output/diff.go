@@ -0,0 +1,127 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// A Run is the JSON output of a comparison run, with only the fields needed to compare it to another run.
+// The JSON output includes the passing test cases regardless of whether passing test cases are included
+// in the other outputs.
+type Run struct {
+	Results []*RunResult `json:"results"`
+}
+
+// A RunResult is the result of a single test case of a Run.
+type RunResult struct {
+	TestCase struct {
+		Query      string `json:"query"`
+		TimeWindow string `json:"timeWindow"`
+	} `json:"testCase"`
+	Diff              string          `json:"diff"`
+	UnexpectedFailure string          `json:"unexpectedFailure"`
+	UnexpectedSuccess bool            `json:"unexpectedSuccess"`
+	KnownDifference   json.RawMessage `json:"knownDifference"`
+}
+
+// Success returns whether the test case passed, like comparer.Result.Success.
+func (r *RunResult) Success() bool {
+	hasKnownDifference := len(r.KnownDifference) > 0 && string(r.KnownDifference) != "null"
+	return hasKnownDifference || (r.Diff == "" && !r.UnexpectedSuccess && r.UnexpectedFailure == "")
+}
+
+// key identifies the test case across runs: its query and the time window it was run in, if any.
+func (r *RunResult) key() string {
+	if r.TestCase.TimeWindow != "" {
+		return fmt.Sprintf("%s (time window: %s)", r.TestCase.Query, r.TestCase.TimeWindow)
+	}
+	return r.TestCase.Query
+}
+
+// ReadRun parses the output of a run in the JSON output format.
+func ReadRun(r io.Reader) (*Run, error) {
+	run := &Run{}
+	if err := json.NewDecoder(r).Decode(run); err != nil {
+		return nil, errors.Wrap(err, "decoding JSON output")
+	}
+	return run, nil
+}
+
+// A RunDiff lists the test cases whose outcome changed between two runs, and the test cases only found in
+// one of them, by query.
+type RunDiff struct {
+	Regressed []string
+	Fixed     []string
+	// Added and Removed map the test cases found in only one of the runs to whether they passed in it.
+	Added   map[string]bool
+	Removed map[string]bool
+}
+
+// DiffRuns compares the results of the old and the new run.
+func DiffRuns(oldRun, newRun *Run) *RunDiff {
+	oldResults := make(map[string]*RunResult, len(oldRun.Results))
+	for _, r := range oldRun.Results {
+		oldResults[r.key()] = r
+	}
+	d := &RunDiff{Added: map[string]bool{}, Removed: map[string]bool{}}
+	seen := make(map[string]bool, len(newRun.Results))
+	for _, r := range newRun.Results {
+		k := r.key()
+		seen[k] = true
+		old, ok := oldResults[k]
+		switch {
+		case !ok:
+			d.Added[k] = r.Success()
+		case old.Success() && !r.Success():
+			d.Regressed = append(d.Regressed, k)
+		case !old.Success() && r.Success():
+			d.Fixed = append(d.Fixed, k)
+		}
+	}
+	for k, r := range oldResults {
+		if !seen[k] {
+			d.Removed[k] = r.Success()
+		}
+	}
+	sort.Strings(d.Regressed)
+	sort.Strings(d.Fixed)
+	return d
+}
+
+// Write writes the report of the differences between the runs to w.
+func (d *RunDiff) Write(w io.Writer) {
+	writeList := func(title string, queries []string) {
+		fmt.Fprintf(w, "%s: %d\n", title, len(queries))
+		for _, q := range queries {
+			fmt.Fprintf(w, "  %s\n", q)
+		}
+	}
+	writeMap := func(title string, queries map[string]bool) {
+		fmt.Fprintf(w, "%s: %d\n", title, len(queries))
+		for _, q := range sortedKeys(queries) {
+			state := "FAILED"
+			if queries[q] {
+				state = "PASSED"
+			}
+			fmt.Fprintf(w, "  %s: %s\n", q, state)
+		}
+	}
+
+	writeList("REGRESSED (passed in the old run, failed in the new run)", d.Regressed)
+	writeList("FIXED (failed in the old run, passed in the new run)", d.Fixed)
+	writeMap("NEW (only in the new run)", d.Added)
+	writeMap("REMOVED (only in the old run)", d.Removed)
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,48 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/prometheus/compliance/promql/comparer"
+)
+
+func TestDiffRuns(t *testing.T) {
+	readRun := func(results []*comparer.Result, includePassing bool) *Run {
+		var buf bytes.Buffer
+		JSON(&buf, results, includePassing, testTweaks())
+		run, err := ReadRun(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return run
+	}
+
+	oldResults := testResults()
+	newResults := testResults()
+	// Regress the passing test case and fix the failing one.
+	newResults[0].Diff = "some diff"
+	newResults[1].Diff = ""
+	// The known difference keeps passing.
+	newResults[5].Diff = "another diff"
+	// Replace the unexpected success by a new passing test case.
+	newResults[4] = &comparer.Result{TestCase: &comparer.TestCase{Query: "demo_num_cpus"}}
+
+	exp := `REGRESSED (passed in the old run, failed in the new run): 1
+  demo_memory_usage_bytes
+FIXED (failed in the old run, passed in the new run): 1
+  rate(demo_cpu_usage_seconds_total[1m])
+NEW (only in the new run): 1
+  demo_num_cpus: PASSED
+REMOVED (only in the old run): 1
+  nonexistent_function(): FAILED
+`
+	// The JSON output includes the passing test cases even when the other outputs do not.
+	for _, includePassing := range []bool{false, true} {
+		var buf bytes.Buffer
+		DiffRuns(readRun(oldResults, includePassing), readRun(newResults, includePassing)).Write(&buf)
+		if buf.String() != exp {
+			t.Errorf("unexpected report with includePassing=%t:\n--- expected\n%s\n--- got\n%s", includePassing, exp, buf.String())
+		}
+	}
+}
@@ -2,8 +2,8 @@ package output
 
 import (
 	"html/template"
+	"io"
 	"log"
-	"os"
 	"path"
 
 	"github.com/pkg/errors"
@@ -13,7 +13,7 @@ import (
 
 var funcMap = map[string]interface{}{
 	"include": func(includePassing bool, result *comparer.Result) bool {
-		return includePassing || !result.Success()
+		return includePassing || !result.Success() || result.KnownDifference != nil
 	},
 	"numResults": func(results []*comparer.Result) int {
 		return len(results)
@@ -48,8 +48,8 @@ func HTML(tplFile string) (Outputter, error) {
 		return nil, errors.Wrapf(err, "parsing template file %q", tplFile)
 	}
 
-	return func(results []*comparer.Result, includePassing bool, tweaks []*config.QueryTweak) {
-		err := t.Execute(os.Stdout, struct {
+	return func(w io.Writer, results []*comparer.Result, includePassing bool, tweaks []*config.QueryTweak) {
+		err := t.Execute(w, struct {
 			Results        []*comparer.Result
 			IncludePassing bool
 		}{
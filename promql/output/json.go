@@ -3,21 +3,64 @@ package output
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"sync"
 
 	"github.com/prometheus/compliance/promql/comparer"
 	"github.com/prometheus/compliance/promql/config"
 )
 
 // JSON produces JSON-based output for a number of query results.
-func JSON(results []*comparer.Result, includePassing bool, tweaks []*config.QueryTweak) {
-	buf, err := json.Marshal(map[string]interface{}{
-		"totalResults":   len(results), // Needed because we may exclude passing results.
-		"results":        results,
-		"includePassing": includePassing,
-		"queryTweaks":    tweaks,
-	})
+func JSON(w io.Writer, results []*comparer.Result, includePassing bool, tweaks []*config.QueryTweak) {
+	outputAll(NewJSON(w, includePassing), results, tweaks)
+}
+
+// JSONStream produces the same JSON document as JSON, but writes every query
+// result into the "results" array as soon as it is emitted.
+type JSONStream struct {
+	mtx            sync.Mutex
+	w              io.Writer
+	includePassing bool
+
+	total int
+}
+
+// NewJSON returns a new JSONStream writing to w.
+func NewJSON(w io.Writer, includePassing bool) *JSONStream {
+	return &JSONStream{w: w, includePassing: includePassing}
+}
+
+// Start implements StreamingOutputter.
+func (o *JSONStream) Start(tweaks []*config.QueryTweak) {
+	// The keys are written in the order in which encoding/json sorts map keys.
+	fmt.Fprintf(o.w, `{"includePassing":%s,"queryTweaks":%s,"results":[`, mustMarshal(o.includePassing), mustMarshal(tweaks))
+}
+
+// Emit implements StreamingOutputter.
+func (o *JSONStream) Emit(res *comparer.Result) {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	if o.total > 0 {
+		fmt.Fprint(o.w, ",")
+	}
+	o.total++
+	fmt.Fprint(o.w, string(mustMarshal(res)))
+}
+
+// Finish implements StreamingOutputter.
+func (o *JSONStream) Finish() {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	// totalResults is needed because we may exclude passing results.
+	fmt.Fprintf(o.w, `],"totalResults":%d}`, o.total)
+}
+
+func mustMarshal(v interface{}) []byte {
+	buf, err := json.Marshal(v)
 	if err != nil {
 		panic(err)
 	}
-	fmt.Print(string(buf))
+	return buf
 }
@@ -0,0 +1,49 @@
+package output
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/prometheus/compliance/promql/comparer"
+	"github.com/prometheus/compliance/promql/config"
+)
+
+// JSONL produces JSON-lines output, writing one JSON object per query result
+// as soon as the result is emitted. Unlike JSON, it does not need to hold all
+// results in memory, which allows consuming the results of very large runs as
+// they happen.
+type JSONL struct {
+	mtx            sync.Mutex
+	enc            *json.Encoder
+	includePassing bool
+}
+
+// NewJSONL returns a new JSONL outputter writing to w.
+func NewJSONL(w io.Writer, includePassing bool) *JSONL {
+	return &JSONL{
+		enc:            json.NewEncoder(w),
+		includePassing: includePassing,
+	}
+}
+
+// Start implements StreamingOutputter. JSON-lines output has no header.
+func (o *JSONL) Start(_ []*config.QueryTweak) {}
+
+// Emit writes a single query result as one line of JSON. Passing results are
+// skipped unless passing results should be included, while known differences
+// are always written. It is safe to call Emit concurrently.
+func (o *JSONL) Emit(result *comparer.Result) {
+	if result.Success() && result.KnownDifference == nil && !o.includePassing {
+		return
+	}
+
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	if err := o.enc.Encode(result); err != nil {
+		panic(err)
+	}
+}
+
+// Finish implements StreamingOutputter. JSON-lines output has no footer.
+func (o *JSONL) Finish() {}
@@ -0,0 +1,100 @@
+package output
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/compliance/promql/comparer"
+	"github.com/prometheus/compliance/promql/config"
+)
+
+var update = flag.Bool("update", false, "Update the golden files in testdata/ instead of comparing against them.")
+
+func testResults() []*comparer.Result {
+	start := time.Unix(1600000000, 0).UTC()
+	end := start.Add(10 * time.Minute)
+	tc := func(query string) *comparer.TestCase {
+		return &comparer.TestCase{Query: query, Start: start, End: end, Resolution: 10 * time.Second}
+	}
+	return []*comparer.Result{
+		{TestCase: tc("demo_memory_usage_bytes")},
+		{
+			TestCase:        tc("rate(demo_cpu_usage_seconds_total[1m])"),
+			Diff:            "  model.Matrix{\n- \t&{Metric: s\"{instance=\\\"a\\\"}\"},\n  }\n",
+			ReferenceResult: &comparer.TargetResult{Value: model.Matrix{{Metric: model.Metric{"instance": "a"}}}, StatusCode: 200, Latency: 15 * time.Millisecond},
+			TestResult:      &comparer.TargetResult{Value: model.Matrix{}, StatusCode: 200, Latency: 20 * time.Millisecond},
+		},
+		{TestCase: tc("holt_winters(demo_disk_usage_bytes[10m], 0.5, 0.5)"), UnexpectedFailure: "server_error: server error: 501", Unsupported: true},
+		{
+			TestCase:          tc("demo_num_cpus{"),
+			UnexpectedFailure: "bad_data: invalid parameter \"query\"",
+			RefHTTPMetadata:   &comparer.HTTPMetadata{StatusCode: 400},
+			TestHTTPMetadata:  &comparer.HTTPMetadata{StatusCode: 422},
+			Warnings:          []string{"HTTP status code differs (reference: 400, test: 422)"},
+		},
+		{TestCase: tc("nonexistent_function()"), UnexpectedSuccess: true},
+		{
+			TestCase:        tc("demo_batch_last_success_timestamp_seconds"),
+			Diff:            "  model.Matrix{\n- \t&{Metric: s\"{instance=\\\"a\\\"}\"},\n  }\n",
+			KnownDifference: &config.KnownDifference{Query: "demo_batch_.*", Reason: "Batch metrics are not ingested."},
+		},
+	}
+}
+
+func testTweaks() []*config.QueryTweak {
+	return []*config.QueryTweak{
+		{Note: "Some tweak.", TruncateTimestampsToMS: 1000},
+	}
+}
+
+func TestOutputters(t *testing.T) {
+	html, err := HTML("example-output.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outputters := map[string]Outputter{
+		"text": Text,
+		"html": html,
+		"json": JSON,
+		"tsv":  TSV,
+		"jsonl": func(w io.Writer, results []*comparer.Result, includePassing bool, tweaks []*config.QueryTweak) {
+			outputAll(NewJSONL(w, includePassing), results, tweaks)
+		},
+	}
+
+	for name, outp := range outputters {
+		for _, includePassing := range []bool{false, true} {
+			goldenFile := filepath.Join("testdata", name+".golden")
+			if includePassing {
+				goldenFile = filepath.Join("testdata", name+"-passing.golden")
+			}
+
+			t.Run(filepath.Base(goldenFile), func(t *testing.T) {
+				var buf bytes.Buffer
+				outp(&buf, testResults(), includePassing, testTweaks())
+
+				if *update {
+					if err := os.WriteFile(goldenFile, buf.Bytes(), 0o644); err != nil {
+						t.Fatal(err)
+					}
+					return
+				}
+
+				exp, err := os.ReadFile(goldenFile)
+				if err != nil {
+					t.Fatalf("reading golden file (run with -update to create it): %v", err)
+				}
+				if !bytes.Equal(exp, buf.Bytes()) {
+					t.Errorf("output does not match %s (run with -update to regenerate):\n--- expected\n%s\n--- got\n%s", goldenFile, exp, buf.Bytes())
+				}
+			})
+		}
+	}
+}
@@ -1,9 +1,56 @@
 package output
 
 import (
+	"io"
+
 	"github.com/prometheus/compliance/promql/comparer"
 	"github.com/prometheus/compliance/promql/config"
 )
 
-// An Outputter outputs a number of test results.
-type Outputter func(results []*comparer.Result, includePassing bool, tweaks []*config.QueryTweak)
+// An Outputter writes a number of test results to w.
+type Outputter func(w io.Writer, results []*comparer.Result, includePassing bool, tweaks []*config.QueryTweak)
+
+// A StreamingOutputter writes test results one at a time as they complete,
+// instead of waiting for the full set of results.
+type StreamingOutputter interface {
+	// Start is called once before any result is emitted.
+	Start(tweaks []*config.QueryTweak)
+	// Emit outputs a single result. It is safe to call Emit concurrently.
+	Emit(result *comparer.Result)
+	// Finish is called once after all results have been emitted.
+	Finish()
+}
+
+// Multi returns a StreamingOutputter that writes every result through all the given ones.
+func Multi(outputters ...StreamingOutputter) StreamingOutputter {
+	return multi(outputters)
+}
+
+type multi []StreamingOutputter
+
+func (m multi) Start(tweaks []*config.QueryTweak) {
+	for _, o := range m {
+		o.Start(tweaks)
+	}
+}
+
+func (m multi) Emit(result *comparer.Result) {
+	for _, o := range m {
+		o.Emit(result)
+	}
+}
+
+func (m multi) Finish() {
+	for _, o := range m {
+		o.Finish()
+	}
+}
+
+// outputAll writes a complete set of results through a StreamingOutputter.
+func outputAll(o StreamingOutputter, results []*comparer.Result, tweaks []*config.QueryTweak) {
+	o.Start(tweaks)
+	for _, res := range results {
+		o.Emit(res)
+	}
+	o.Finish()
+}
@@ -2,59 +2,136 @@ package output
 
 import (
 	"fmt"
+	"io"
 	"strings"
+	"sync"
 
 	"github.com/prometheus/compliance/promql/comparer"
 	"github.com/prometheus/compliance/promql/config"
 )
 
 // Text produces text-based output for a number of query results.
-func Text(results []*comparer.Result, includePassing bool, tweaks []*config.QueryTweak) {
-	successes := 0
-	unsupported := 0
-	for _, res := range results {
-		if res.Success() {
-			successes++
-			if !includePassing {
-				continue
-			}
-		}
-		if res.Unsupported {
-			unsupported++
+func Text(w io.Writer, results []*comparer.Result, includePassing bool, tweaks []*config.QueryTweak) {
+	outputAll(NewText(w, includePassing), results, tweaks)
+}
+
+// TextStream produces text-based output for query results as they are emitted.
+type TextStream struct {
+	mtx            sync.Mutex
+	w              io.Writer
+	includePassing bool
+	tweaks         []*config.QueryTweak
+
+	total, successes, unsupported, bothEmpty int
+	knownDifferences                         []*comparer.Result
+}
+
+// NewText returns a new TextStream writing to w.
+func NewText(w io.Writer, includePassing bool) *TextStream {
+	return &TextStream{w: w, includePassing: includePassing}
+}
+
+// Start implements StreamingOutputter.
+func (o *TextStream) Start(tweaks []*config.QueryTweak) {
+	o.tweaks = tweaks
+}
+
+// Emit implements StreamingOutputter.
+func (o *TextStream) Emit(res *comparer.Result) {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	w := o.w
+	o.total++
+	if res.BothEmpty {
+		o.bothEmpty++
+	}
+	if res.KnownDifference != nil {
+		// Known differences are listed in their own section at the end.
+		o.successes++
+		o.knownDifferences = append(o.knownDifferences, res)
+		return
+	}
+	if res.Success() {
+		o.successes++
+		if !o.includePassing {
+			return
 		}
+	}
+	if res.Unsupported {
+		o.unsupported++
+	}
 
-		fmt.Println(strings.Repeat("-", 80))
-		fmt.Printf("QUERY: %v\n", res.TestCase.Query)
-		fmt.Printf("START: %v, STOP: %v, STEP: %v\n", res.TestCase.Start, res.TestCase.End, res.TestCase.Resolution)
-		fmt.Printf("RESULT: ")
-		if res.Success() {
-			fmt.Println("PASSED")
-		} else if res.Unsupported {
-			fmt.Println("UNSUPPORTED: ")
-			fmt.Printf("Query is unsupported: %v\n", res.UnexpectedFailure)
-		} else {
-			fmt.Printf("FAILED: ")
-			if res.UnexpectedFailure != "" {
-				fmt.Printf("Query failed unexpectedly: %v\n", res.UnexpectedFailure)
-			}
-			if res.UnexpectedSuccess {
-				fmt.Println("Query succeeded, but should have failed.")
-			}
-			if res.Diff != "" {
-				fmt.Println("Query returned different results:")
-				fmt.Println(res.Diff)
-			}
+	fmt.Fprintln(w, strings.Repeat("-", 80))
+	fmt.Fprintf(w, "QUERY: %v\n", res.TestCase.Query)
+	if res.TestCase.Category != "" {
+		fmt.Fprintf(w, "CATEGORY: %v (functions: %v)\n", res.TestCase.Category, strings.Join(res.TestCase.Functions, ", "))
+	}
+	if res.TestCase.TimeWindow != "" {
+		fmt.Fprintf(w, "TIME WINDOW: %v\n", res.TestCase.TimeWindow)
+	}
+	if res.TestCase.TimeZone != "" {
+		fmt.Fprintf(w, "TIME ZONE: %v (expected %s() computed from the reference results for %q)\n", res.TestCase.TimeZone, res.TestCase.CalendarFunc, res.TestCase.CalendarArg)
+	}
+	fmt.Fprintf(w, "START: %v, STOP: %v, STEP: %v\n", res.TestCase.Start, res.TestCase.End, res.TestCase.Resolution)
+	fmt.Fprintf(w, "RESULT: ")
+	if res.Success() && res.BothEmpty {
+		fmt.Fprintln(w, "PASSED (both targets returned an empty result)")
+	} else if res.Success() {
+		fmt.Fprintln(w, "PASSED")
+	} else if res.Unsupported {
+		fmt.Fprintln(w, "UNSUPPORTED: ")
+		fmt.Fprintf(w, "Query is unsupported: %v\n", res.UnexpectedFailure)
+	} else {
+		fmt.Fprintf(w, "FAILED: ")
+		if res.UnexpectedFailure != "" {
+			fmt.Fprintf(w, "Query failed unexpectedly: %v\n", res.UnexpectedFailure)
+		}
+		if res.UnexpectedSuccess {
+			fmt.Fprintln(w, "Query succeeded, but should have failed.")
+		}
+		if res.Diff != "" {
+			fmt.Fprintln(w, "Query returned different results:")
+			fmt.Fprintln(w, res.Diff)
+		}
+	}
+	for _, c := range res.Chunks {
+		status := "PASSED"
+		if !c.Success() {
+			status = "FAILED"
 		}
+		fmt.Fprintf(w, "CHUNK: START: %v, STOP: %v: %s\n", c.Start, c.End, status)
+	}
+	for _, warning := range res.Warnings {
+		fmt.Fprintf(w, "WARNING: %v\n", warning)
 	}
+}
+
+// Finish implements StreamingOutputter.
+func (o *TextStream) Finish() {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
 
-	fmt.Println(strings.Repeat("=", 80))
-	fmt.Println("General query tweaks:")
-	if len(tweaks) == 0 {
-		fmt.Println("None.")
+	w := o.w
+	if len(o.knownDifferences) > 0 {
+		fmt.Fprintln(w, strings.Repeat("=", 80))
+		fmt.Fprintln(w, "Known differences (not counted as failures):")
+		for _, res := range o.knownDifferences {
+			fmt.Fprintf(w, "* %v: %v\n", res.TestCase.Query, res.KnownDifference.Reason)
+		}
+	}
+	fmt.Fprintln(w, strings.Repeat("=", 80))
+	fmt.Fprintln(w, "General query tweaks:")
+	if len(o.tweaks) == 0 {
+		fmt.Fprintln(w, "None.")
+	}
+	for _, t := range o.tweaks {
+		fmt.Fprintln(w, "* ", t.Note)
 	}
-	for _, t := range tweaks {
-		fmt.Println("* ", t.Note)
+	fmt.Fprintln(w, strings.Repeat("=", 80))
+	fmt.Fprintf(w, "Total: %d / %d (%.2f%%) passed, %d unsupported\n", o.successes, o.total, 100*float64(o.successes)/float64(o.total), o.unsupported)
+	if o.bothEmpty > 0 {
+		// Agreeing on an empty result may mean that neither target has the queried data.
+		fmt.Fprintf(w, "%d test cases returned an empty result on both targets\n", o.bothEmpty)
 	}
-	fmt.Println(strings.Repeat("=", 80))
-	fmt.Printf("Total: %d / %d (%.2f%%) passed, %d unsupported\n", successes, len(results), 100*float64(successes)/float64(len(results)), unsupported)
 }
@@ -2,39 +2,79 @@ package output
 
 import (
 	"fmt"
+	"io"
+	"sync"
 
 	"github.com/prometheus/compliance/promql/comparer"
 	"github.com/prometheus/compliance/promql/config"
 )
 
 // TSV produces tab separated values output for a number of query results.
-func TSV(results []*comparer.Result, passing bool, tweaks []*config.QueryTweak) {
-	successes := 0
-	unsupported := 0
-
-	fmt.Println("QUERY\tSTART\tSTOP\tSTEP\tRESULT")
-
-	for _, res := range results {
-		if res.Success() {
-			successes++
-		}
-		if res.Unsupported {
-			unsupported++
-		}
-
-		fmt.Printf("%v\t%v\t%v\t%v\t", res.TestCase.Query, res.TestCase.Start, res.TestCase.End, res.TestCase.Resolution)
-		if res.Success() {
-			fmt.Println("PASSED")
-		} else if res.Unsupported {
-			fmt.Println("UNSUPPORTED")
-		} else {
-			fmt.Println("FAILED")
-		}
+func TSV(w io.Writer, results []*comparer.Result, passing bool, tweaks []*config.QueryTweak) {
+	outputAll(NewTSV(w), results, tweaks)
+}
+
+// TSVStream produces tab separated values output for query results as they are emitted.
+type TSVStream struct {
+	mtx sync.Mutex
+	w   io.Writer
+
+	total, successes, unsupported, bothEmpty int
+}
+
+// NewTSV returns a new TSVStream writing to w.
+func NewTSV(w io.Writer) *TSVStream {
+	return &TSVStream{w: w}
+}
+
+// Start implements StreamingOutputter.
+func (o *TSVStream) Start(_ []*config.QueryTweak) {
+	fmt.Fprintln(o.w, "QUERY\tSTART\tSTOP\tSTEP\tRESULT")
+}
+
+// Emit implements StreamingOutputter.
+func (o *TSVStream) Emit(res *comparer.Result) {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	w := o.w
+	o.total++
+	if res.Success() {
+		o.successes++
+	}
+	if res.Unsupported {
+		o.unsupported++
+	}
+	if res.BothEmpty {
+		o.bothEmpty++
+	}
+
+	fmt.Fprintf(w, "%v\t%v\t%v\t%v\t", res.TestCase.Query, res.TestCase.Start, res.TestCase.End, res.TestCase.Resolution)
+	if res.KnownDifference != nil {
+		fmt.Fprintln(w, "KNOWN_DIFFERENCE")
+	} else if res.Success() {
+		fmt.Fprintln(w, "PASSED")
+	} else if res.Unsupported {
+		fmt.Fprintln(w, "UNSUPPORTED")
+	} else {
+		fmt.Fprintln(w, "FAILED")
+	}
+}
+
+// Finish implements StreamingOutputter.
+func (o *TSVStream) Finish() {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	w := o.w
+	totalTestCases := o.total
+	totalFailed := totalTestCases - o.successes - o.unsupported
+	fmt.Fprintf(w, "\n\t\tPASSED\t%v\t%.4f\n", o.successes, float64(o.successes)/float64(totalTestCases))
+	fmt.Fprintf(w, "\t\tFAILED\t%v\t%.4f\n", totalFailed, float64(totalFailed)/float64(totalTestCases))
+	fmt.Fprintf(w, "\t\tUNSUPPORTED\t%v\t%.4f\n", o.unsupported, float64(o.unsupported)/float64(totalTestCases))
+	fmt.Fprintf(w, "\t\tTOTAL\t%v\t%.4f\n", totalTestCases, float64(1))
+	if o.bothEmpty > 0 {
+		// Not a separate outcome: these test cases are also counted in the rows above.
+		fmt.Fprintf(w, "\t\tBOTH_EMPTY\t%v\t%.4f\n", o.bothEmpty, float64(o.bothEmpty)/float64(totalTestCases))
 	}
-	totalTestCases := len(results)
-	totalFailed := totalTestCases - successes - unsupported
-	fmt.Printf("\n\t\tPASSED\t%v\t%.4f\n", successes, float64(successes)/float64(totalTestCases))
-	fmt.Printf("\t\tFAILED\t%v\t%.4f\n", totalFailed, float64(totalFailed)/float64(totalTestCases))
-	fmt.Printf("\t\tUNSUPPORTED\t%v\t%.4f\n", unsupported, float64(unsupported)/float64(totalTestCases))
-	fmt.Printf("\t\tTOTAL\t%v\t%.4f\n", totalTestCases, float64(1))
 }
@@ -0,0 +1,359 @@
+// Package seed generates a synthetic data set with the series queried by the test cases and pushes it
+// to targets via remote write, so that the test cases can be run against targets without any data.
+package seed
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/prompb"
+
+	"github.com/prometheus/compliance/promql/comparer"
+	pqconfig "github.com/prometheus/compliance/promql/config"
+)
+
+const (
+	// Interval is the interval between the samples of every series.
+	Interval = 15 * time.Second
+	// Lookback is how far before the start of the query time range the data is generated, to cover
+	// the longest range selector and offset of the test cases plus the lookback delta.
+	Lookback = 90 * time.Minute
+
+	// stepsPerRequest is the maximum number of samples per series in a single remote write request.
+	stepsPerRequest = 40
+
+	// pushTimeout is the timeout of a single remote write request, and pushTries how often it is tried.
+	pushTimeout = 30 * time.Second
+	pushTries   = 3
+	userAgent   = "promql-compliance-tester"
+
+	defaultProbeQuery  = "demo_memory_usage_bytes"
+	defaultWaitTimeout = 5 * time.Minute
+)
+
+var (
+	instances = []string{"demo.promlabs.com:10000", "demo.promlabs.com:10001", "demo.promlabs.com:10002"}
+	buckets   = []string{"0.0001", "0.00015", "0.0002", "0.00025", "0.0003", "+Inf"}
+)
+
+// Series returns the synthetic series for the query time range from start to end, with samples from Lookback
+// before start to end at Interval. The values are pseudo-random, but the same for every call with the same arguments.
+func Series(queryStart, end time.Time) []prompb.TimeSeries {
+	var (
+		start  = queryStart.Add(-Lookback)
+		rng    = rand.New(rand.NewSource(start.Unix()))
+		steps  = int(end.Sub(start)/Interval) + 1
+		series []prompb.TimeSeries
+	)
+
+	add := func(value func(step int, ts time.Time) (float64, bool), lbls ...string) {
+		s := prompb.TimeSeries{}
+		for i := 0; i < len(lbls); i += 2 {
+			s.Labels = append(s.Labels, prompb.Label{Name: lbls[i], Value: lbls[i+1]})
+		}
+		sort.Slice(s.Labels, func(i, j int) bool { return s.Labels[i].Name < s.Labels[j].Name })
+		for step := 0; step < steps; step++ {
+			ts := start.Add(time.Duration(step) * Interval)
+			if v, ok := value(step, ts); ok {
+				s.Samples = append(s.Samples, prompb.Sample{Timestamp: timestamp.FromTime(ts), Value: v})
+			}
+		}
+		series = append(series, s)
+	}
+
+	for i, instance := range instances {
+		cpus := float64(4 + 2*i)
+		add(func(int, time.Time) (float64, bool) { return cpus, true },
+			"__name__", "demo_num_cpus", "instance", instance, "job", "demo")
+
+		for _, typ := range []string{"buffers", "cached", "free", "used"} {
+			v := 1e9 * (1 + rng.Float64())
+			add(func(int, time.Time) (float64, bool) {
+				v += 1e7 * (rng.Float64() - 0.5)
+				return math.Round(v), true
+			}, "__name__", "demo_memory_usage_bytes", "instance", instance, "job", "demo", "type", typ)
+		}
+
+		disk := 1e10 * (1 + rng.Float64())
+		add(func(int, time.Time) (float64, bool) {
+			disk += 1e5 * rng.Float64()
+			return math.Round(disk), true
+		}, "__name__", "demo_disk_usage_bytes", "instance", instance, "job", "demo")
+
+		for _, mode := range []string{"idle", "system", "user"} {
+			var cpu float64
+			reset := i == 0 && mode == "user"
+			add(func(step int, _ time.Time) (float64, bool) {
+				if reset && step == steps/2 {
+					// A counter reset in the middle of the data.
+					cpu = 0
+				}
+				cpu += cpus * Interval.Seconds() * rng.Float64() / 3
+				return cpu, true
+			}, "__name__", "demo_cpu_usage_seconds_total", "instance", instance, "job", "demo", "mode", mode)
+		}
+
+		add(func(_ int, ts time.Time) (float64, bool) {
+			return float64(ts.Truncate(5 * time.Minute).Unix()), true
+		}, "__name__", "demo_batch_last_success_timestamp_seconds", "instance", instance, "job", "demo")
+
+		// Only present in every other 5m period.
+		add(func(_ int, ts time.Time) (float64, bool) {
+			return 1, ts.Unix()/300%2 == 0
+		}, "__name__", "demo_intermittent_metric", "instance", instance, "job", "demo")
+
+		addBoundaryCounters(add, queryStart, end, "instance", instance, "job", "demo")
+
+		for _, method := range []string{"GET", "POST"} {
+			for _, path := range []string{"/api/bar", "/api/foo"} {
+				addHistogram(add, rng, steps, "instance", instance, "job", "demo", "method", method, "path", path, "status", "200")
+			}
+		}
+	}
+	return series
+}
+
+// addBoundaryCounters adds counters with resets and short lifetimes right at the edges of the query time
+// range, where the extrapolation of rate() and increase() usually diverges.
+func addBoundaryCounters(add func(func(int, time.Time) (float64, bool), ...string), queryStart, end time.Time, lbls ...string) {
+	for _, c := range []struct {
+		name    string
+		present func(ts time.Time) bool
+		reset   func(ts time.Time) bool
+	}{
+		{
+			name:    "reset_at_start",
+			present: func(time.Time) bool { return true },
+			reset:   func(ts time.Time) bool { return ts.Equal(queryStart) },
+		},
+		{
+			name:    "reset_at_end",
+			present: func(time.Time) bool { return true },
+			// The last sample, as end is not necessarily aligned to Interval.
+			reset: func(ts time.Time) bool { return ts.After(end.Add(-Interval)) },
+		},
+		{
+			name: "short_at_start",
+			present: func(ts time.Time) bool {
+				return !ts.Before(queryStart.Add(-30*time.Second)) && !ts.After(queryStart.Add(time.Minute))
+			},
+		},
+		{
+			name:    "short_at_end",
+			present: func(ts time.Time) bool { return !ts.Before(end.Add(-time.Minute)) },
+		},
+		{
+			name:    "starts_at_start",
+			present: func(ts time.Time) bool { return !ts.Before(queryStart) },
+		},
+	} {
+		c := c
+		var v float64
+		add(func(_ int, ts time.Time) (float64, bool) {
+			if !c.present(ts) {
+				return 0, false
+			}
+			if c.reset != nil && c.reset(ts) {
+				v = 0
+			}
+			v += 3
+			return v, true
+		}, append([]string{"__name__", "demo_boundary_counter_total", "case", c.name}, lbls...)...)
+	}
+}
+
+// addHistogram adds the series of a classic histogram with the given labels.
+func addHistogram(add func(func(int, time.Time) (float64, bool), ...string), rng *rand.Rand, steps int, lbls ...string) {
+	// Pre-compute the cumulative counts, as all the series of the histogram have to be consistent.
+	var (
+		counts = make([][]float64, len(buckets))
+		sums   = make([]float64, steps)
+		prev   = make([]float64, len(buckets))
+		sum    float64
+	)
+	for b := range buckets {
+		counts[b] = make([]float64, steps)
+	}
+	for step := 0; step < steps; step++ {
+		var cumulative float64
+		for b := range buckets {
+			n := float64(rng.Intn(20))
+			if b == len(buckets)-1 {
+				n = float64(rng.Intn(2))
+			}
+			cumulative += n
+			prev[b] += cumulative
+			counts[b][step] = prev[b]
+		}
+		sum += cumulative * 0.0002
+		sums[step] = sum
+	}
+
+	for b, le := range buckets {
+		b := b
+		add(func(step int, _ time.Time) (float64, bool) { return counts[b][step], true },
+			append([]string{"__name__", "demo_api_request_duration_seconds_bucket", "le", le}, lbls...)...)
+	}
+	add(func(step int, _ time.Time) (float64, bool) { return counts[len(buckets)-1][step], true },
+		append([]string{"__name__", "demo_api_request_duration_seconds_count"}, lbls...)...)
+	add(func(step int, _ time.Time) (float64, bool) { return sums[step], true },
+		append([]string{"__name__", "demo_api_request_duration_seconds_sum"}, lbls...)...)
+}
+
+// Push remote writes the series to the target. The samples are sent in chronological order, since
+// targets usually reject samples older than the ones they already have.
+func Push(ctx context.Context, tc pqconfig.TargetConfig, series []prompb.TimeSeries) error {
+	if _, err := url.Parse(tc.RemoteWriteURL); err != nil {
+		return errors.Wrapf(err, "parsing remote write URL %q", pqconfig.RedactURL(tc.RemoteWriteURL))
+	}
+	client := &http.Client{Timeout: pushTimeout}
+
+	minT, maxT := int64(math.MaxInt64), int64(math.MinInt64)
+	for _, s := range series {
+		if len(s.Samples) > 0 {
+			if t := s.Samples[0].Timestamp; t < minT {
+				minT = t
+			}
+			if t := s.Samples[len(s.Samples)-1].Timestamp; t > maxT {
+				maxT = t
+			}
+		}
+	}
+
+	window := int64(stepsPerRequest * Interval / time.Millisecond)
+	for from := minT; from <= maxT; from += window {
+		var req prompb.WriteRequest
+		for _, s := range series {
+			i := sort.Search(len(s.Samples), func(i int) bool { return s.Samples[i].Timestamp >= from })
+			j := sort.Search(len(s.Samples), func(i int) bool { return s.Samples[i].Timestamp >= from+window })
+			if i < j {
+				req.Timeseries = append(req.Timeseries, prompb.TimeSeries{Labels: s.Labels, Samples: s.Samples[i:j]})
+			}
+		}
+		if len(req.Timeseries) == 0 {
+			continue
+		}
+
+		data, err := proto.Marshal(&req)
+		if err != nil {
+			return errors.Wrap(err, "marshaling write request")
+		}
+		if err := store(ctx, client, tc, snappy.Encode(nil, data)); err != nil {
+			return errors.Wrapf(err, "remote writing to %s", pqconfig.RedactURL(tc.RemoteWriteURL))
+		}
+	}
+	return nil
+}
+
+// store sends a snappy encoded write request to the target, retrying on server errors and rate limiting.
+func store(ctx context.Context, client *http.Client, tc pqconfig.TargetConfig, body []byte) error {
+	var err error
+	for try := 0; try < pushTries; try++ {
+		if try > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Second):
+			}
+		}
+		var retry bool
+		retry, err = storeOnce(ctx, client, tc, body)
+		if err == nil || !retry {
+			return err
+		}
+	}
+	return err
+}
+
+// storeOnce sends a single write request and returns whether it is worth retrying if it failed.
+func storeOnce(ctx context.Context, client *http.Client, tc pqconfig.TargetConfig, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tc.RemoteWriteURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if tc.BasicAuthUser != "" {
+		req.SetBasicAuth(tc.BasicAuthUser, string(tc.BasicAuthPass))
+	}
+	if tc.Tenant != "" {
+		req.Header.Set(pqconfig.TenantHeader, tc.Tenant)
+	}
+	for key, value := range tc.Headers {
+		if strings.ToLower(key) == "host" {
+			req.Host = value
+		} else {
+			req.Header.Set(key, value)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	retry := resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, errors.Errorf("server returned HTTP status %s: %s", resp.Status, bytes.TrimSpace(msg))
+}
+
+// WaitForData runs the probe query at the given time until it returns data or the timeout is exceeded.
+// The defaults are used for an empty probe query or a zero timeout.
+func WaitForData(ctx context.Context, api comparer.PromAPI, probeQuery string, ts time.Time, timeout time.Duration) error {
+	if probeQuery == "" {
+		probeQuery = defaultProbeQuery
+	}
+	if timeout == 0 {
+		timeout = defaultWaitTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var lastErr error
+	for {
+		res, _, err := api.Query(ctx, probeQuery, ts)
+		if err == nil && isEmpty(res) {
+			err = fmt.Errorf("no data for %q at %v", probeQuery, ts)
+		}
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(lastErr, "waiting for the seed data after %v", timeout)
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func isEmpty(v model.Value) bool {
+	switch v := v.(type) {
+	case model.Vector:
+		return len(v) == 0
+	case model.Matrix:
+		return len(v) == 0
+	}
+	return v == nil
+}
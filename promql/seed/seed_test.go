@@ -0,0 +1,148 @@
+package seed
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/prompb"
+
+	pqconfig "github.com/prometheus/compliance/promql/config"
+)
+
+func TestPush(t *testing.T) {
+	var (
+		mtx      sync.Mutex
+		requests []prompb.WriteRequest
+		failures = 1
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		// The first request is retried after a server error.
+		if failures > 0 {
+			failures--
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		if enc := r.Header.Get("Content-Encoding"); enc != "snappy" {
+			t.Errorf("unexpected Content-Encoding %q", enc)
+		}
+		if user, pass, _ := r.BasicAuth(); user != "user" || pass != "pass" {
+			t.Errorf("unexpected basic auth %q:%q", user, pass)
+		}
+		if tenant := r.Header.Get(pqconfig.TenantHeader); tenant != "tenant" {
+			t.Errorf("unexpected tenant %q", tenant)
+		}
+		compressed, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		data, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			t.Error(err)
+		}
+		var req prompb.WriteRequest
+		if err := proto.Unmarshal(data, &req); err != nil {
+			t.Error(err)
+		}
+		requests = append(requests, req)
+	}))
+	defer srv.Close()
+
+	start := time.Unix(1700000000, 0).UTC()
+	end := start.Add(time.Hour)
+	series := Series(start, end)
+	tc := pqconfig.TargetConfig{RemoteWriteURL: srv.URL, BasicAuthUser: "user", BasicAuthPass: "pass", Tenant: "tenant"}
+	if err := Push(context.Background(), tc, series); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		minT, maxT = timestamp.FromTime(start.Add(-Lookback)), timestamp.FromTime(end)
+		interval   = Interval.Milliseconds()
+		names      = map[string]bool{}
+		samples    = map[string][]prompb.Sample{}
+		lastT      int64
+		total      int
+	)
+	for _, req := range requests {
+		reqMinT := int64(-1)
+		for _, s := range req.Timeseries {
+			var key string
+			for _, l := range s.Labels {
+				key += l.String()
+				if l.Name == "__name__" {
+					names[l.Value] = true
+				}
+			}
+			for _, smpl := range s.Samples {
+				if smpl.Timestamp < minT || smpl.Timestamp > maxT || (smpl.Timestamp-minT)%interval != 0 {
+					t.Errorf("sample of %s at %d not in [%d, %d] at %d", key, smpl.Timestamp, minT, maxT, interval)
+				}
+				if reqMinT < 0 || smpl.Timestamp < reqMinT {
+					reqMinT = smpl.Timestamp
+				}
+				total++
+			}
+			samples[key] = append(samples[key], s.Samples...)
+		}
+		// The samples of every request are newer than the ones of the previous requests.
+		if reqMinT <= lastT && lastT != 0 {
+			t.Errorf("request with samples from %d sent after samples up to %d", reqMinT, lastT)
+		}
+		for _, s := range req.Timeseries {
+			if ts := s.Samples[len(s.Samples)-1].Timestamp; ts > lastT {
+				lastT = ts
+			}
+		}
+	}
+
+	if len(samples) != len(series) {
+		t.Errorf("expected %d series, got %d", len(series), len(samples))
+	}
+	var expTotal int
+	for _, s := range series {
+		expTotal += len(s.Samples)
+	}
+	if total != expTotal {
+		t.Errorf("expected %d samples, got %d", expTotal, total)
+	}
+	for _, name := range []string{"demo_num_cpus", "demo_memory_usage_bytes", "demo_cpu_usage_seconds_total", "demo_boundary_counter_total", "demo_api_request_duration_seconds_bucket"} {
+		if !names[name] {
+			t.Errorf("no series named %q", name)
+		}
+	}
+	for key, s := range samples {
+		for i := 1; i < len(s); i++ {
+			if s[i].Timestamp <= s[i-1].Timestamp {
+				t.Errorf("samples of %s out of order: %d after %d", key, s[i].Timestamp, s[i-1].Timestamp)
+				break
+			}
+		}
+	}
+}
+
+func TestPushNoRetryOnClientError(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, "out of order sample", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	start := time.Unix(1700000000, 0).UTC()
+	if err := Push(context.Background(), pqconfig.TargetConfig{RemoteWriteURL: srv.URL}, Series(start, start)); err == nil {
+		t.Fatal("expected an error")
+	}
+	if requests != 1 {
+		t.Errorf("expected 1 request, got %d", requests)
+	}
+}
@@ -0,0 +1,134 @@
+package testcases
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// functionFamilies maps functions to the family they are grouped in. Functions ending in "_over_time"
+// and starting with "histogram_" are grouped by their suffix and prefix instead.
+var functionFamilies = map[string]string{
+	"rate":           "counter",
+	"irate":          "counter",
+	"increase":       "counter",
+	"resets":         "counter",
+	"delta":          "gauge",
+	"idelta":         "gauge",
+	"deriv":          "gauge",
+	"predict_linear": "gauge",
+	"changes":        "gauge",
+
+	"holt_winters":                 "gauge",
+	"double_exponential_smoothing": "gauge",
+
+	"abs":       "math",
+	"ceil":      "math",
+	"floor":     "math",
+	"round":     "math",
+	"clamp":     "math",
+	"clamp_min": "math",
+	"clamp_max": "math",
+	"exp":       "math",
+	"ln":        "math",
+	"log2":      "math",
+	"log10":     "math",
+	"sqrt":      "math",
+	"sgn":       "math",
+	"deg":       "math",
+	"rad":       "math",
+	"pi":        "math",
+	"sin":       "math",
+	"sinh":      "math",
+	"asin":      "math",
+	"asinh":     "math",
+	"cos":       "math",
+	"cosh":      "math",
+	"acos":      "math",
+	"acosh":     "math",
+	"tan":       "math",
+	"tanh":      "math",
+	"atan":      "math",
+	"atanh":     "math",
+
+	"time":          "time",
+	"timestamp":     "time",
+	"day_of_month":  "time",
+	"day_of_week":   "time",
+	"day_of_year":   "time",
+	"days_in_month": "time",
+	"hour":          "time",
+	"minute":        "time",
+	"month":         "time",
+	"year":          "time",
+
+	"label_replace": "label",
+	"label_join":    "label",
+
+	"sort":               "sort",
+	"sort_desc":          "sort",
+	"sort_by_label":      "sort",
+	"sort_by_label_desc": "sort",
+
+	"absent": "absent",
+	"vector": "type_conversion",
+	"scalar": "type_conversion",
+}
+
+// functionFamily returns the family of the function, or "other" for functions without a family.
+func functionFamily(name string) string {
+	switch {
+	case strings.HasSuffix(name, "_over_time"):
+		return "over_time"
+	case strings.HasPrefix(name, "histogram_"):
+		return "histogram"
+	}
+	if f, ok := functionFamilies[name]; ok {
+		return f
+	}
+	return "other"
+}
+
+// queryCategory returns the category of the outermost operation of the query, i.e. the function family
+// of the outermost function call, "aggregation", "binary_operator", "subquery", "selector" or "literal",
+// and the sorted names of all functions and aggregations called in the query, so that results can be
+// grouped without parsing their queries. It returns an empty category if the query does not parse.
+func queryCategory(query string) (category string, functions []string) {
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		return "", nil
+	}
+
+	seen := map[string]struct{}{}
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		var name, c string
+		switch n := node.(type) {
+		case *parser.Call:
+			name, c = n.Func.Name, functionFamily(n.Func.Name)
+		case *parser.AggregateExpr:
+			name, c = n.Op.String(), "aggregation"
+		case *parser.BinaryExpr:
+			c = "binary_operator"
+		case *parser.SubqueryExpr:
+			c = "subquery"
+		case *parser.VectorSelector, *parser.MatrixSelector:
+			c = "selector"
+		case *parser.NumberLiteral, *parser.StringLiteral:
+			c = "literal"
+		}
+		if category == "" {
+			category = c
+		}
+		if name != "" {
+			seen[name] = struct{}{}
+		}
+		return nil
+	})
+
+	for f := range seen {
+		functions = append(functions, f)
+	}
+	sort.Strings(functions)
+	return category, functions
+}
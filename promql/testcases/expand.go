@@ -34,18 +34,21 @@ package testcases
 import (
 	"bytes"
 	"fmt"
+	"regexp"
+	"strconv"
 	"text/template"
 	"time"
 
 	"github.com/prometheus/compliance/promql/comparer"
 	"github.com/prometheus/compliance/promql/config"
+	"github.com/prometheus/prometheus/promql/parser"
 )
 
 var testVariantArgs = map[string][]string{
 	"range":            {"1s", "15s", "1m", "5m", "15m", "1h"},
 	"offset":           {"1m", "5m", "10m"},
 	"simpleAggrOp":     {"sum", "avg", "max", "min", "count", "stddev", "stdvar"},
-	"simpleTimeAggrOp": {"sum", "avg", "max", "min", "count", "stddev", "stdvar", "absent", "last"},
+	"simpleTimeAggrOp": {"sum", "avg", "max", "min", "count", "stddev", "stdvar", "absent", "last", "present"},
 	"topBottomOp":      {"topk", "bottomk"},
 	"quantile": {
 		"-0.5",
@@ -68,6 +71,36 @@ var testVariantArgs = map[string][]string{
 	"dateFunc":             {"day_of_month", "day_of_week", "days_in_month", "hour", "minute", "month", "year"},
 	"smoothingFactor":      {"0.1", "0.5", "0.8"},
 	"trendFactor":          {"0.1", "0.5", "0.8"},
+	// Unix epoch, a leap day of a leap century, the last second of a year, the last second of a
+	// leap day and the last second of February of a non-leap century.
+	"calendarTimestamp": {"0", "951825600", "1704067199", "1709251199", "4107542399"},
+	"setOp":             {"and", "or", "unless"},
+	// Native histogram accessor functions without the "histogram_" prefix.
+	"histogramAccessorFunc":   {"count", "sum", "avg", "stddev", "stdvar"},
+	"histogramFractionBounds": {"0, 0.1", "-Inf, 0.25", "0.1, +Inf", "0.5, 0.1"},
+	// Special, negative and halfway values for the math functions.
+	"edgeValue":      {"NaN", "Inf", "-Inf", "-7.5", "-2.5", "0", "0.5", "2.5"},
+	"roundToNearest": {"0.1", "0.25", "3", "-2", "0", "NaN"},
+	// Windows of the matrix selectors whose samples are compared directly.
+	"matrixRange": {"30s", "1m", "5m", "1h"},
+}
+
+var (
+	atStartRegexp = regexp.MustCompile(`@\s*start\(\s*\)`)
+	atEndRegexp   = regexp.MustCompile(`@\s*end\(\s*\)`)
+)
+
+// equivalentQuery returns the query with all "@ start()" and "@ end()" modifiers replaced by explicit
+// timestamps, or an empty string if the query contains no such modifiers.
+func equivalentQuery(query string, start, end time.Time) string {
+	if !atStartRegexp.MatchString(query) && !atEndRegexp.MatchString(query) {
+		return ""
+	}
+	unix := func(t time.Time) string {
+		return "@ " + strconv.FormatFloat(float64(t.UnixMilli())/1000, 'f', -1, 64)
+	}
+	query = atStartRegexp.ReplaceAllLiteralString(query, unix(start))
+	return atEndRegexp.ReplaceAllLiteralString(query, unix(end))
 }
 
 // tprintf replaces template arguments in a string with their instantiations from the provided map.
@@ -128,16 +161,50 @@ func applyQueryTweaks(tc *comparer.TestCase, tweaks []*config.QueryTweak) *compa
 			resTC.Start = resTC.Start.Add(d)
 			resTC.End = resTC.End.Add(d)
 		}
+		if t.TimeZone != "" {
+			if fn, arg, ok := calendarCall(resTC.Query); ok {
+				resTC.TimeZone, resTC.CalendarFunc, resTC.CalendarArg = t.TimeZone, fn, arg
+			}
+		}
 	}
 	return &resTC
 }
 
+// calendarCall returns the calendar function and its argument if the query calls a calendar function
+// at the top level. Calendar functions without an argument are called on vector(time()).
+func calendarCall(query string) (fn, arg string, ok bool) {
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		return "", "", false
+	}
+	for {
+		paren, isParen := expr.(*parser.ParenExpr)
+		if !isParen {
+			break
+		}
+		expr = paren.Expr
+	}
+	call, isCall := expr.(*parser.Call)
+	if !isCall || !comparer.IsCalendarFunc(call.Func.Name) {
+		return "", "", false
+	}
+	if len(call.Args) == 0 {
+		return call.Func.Name, "vector(time())", true
+	}
+	return call.Func.Name, call.Args[0].String(), true
+}
+
 // ExpandTestCases returns the fully expanded test cases for a given set of templates test cases.
 func ExpandTestCases(cases []*config.TestCase, tweaks []*config.QueryTweak, start, end time.Time, resolution time.Duration) []*comparer.TestCase {
 	tcs := make([]*comparer.TestCase, 0)
 	for _, q := range cases {
 		vs := getVariants(q.Query, q.VariantArgs, make(map[string]string))
-		for _, v := range vs {
+		var nativeVs []string
+		if q.NativeHistogramQuery != "" {
+			// The variants are generated in the same order, hence match the ones of the query.
+			nativeVs = getVariants(q.NativeHistogramQuery, q.VariantArgs, make(map[string]string))
+		}
+		for i, v := range vs {
 			tc := &comparer.TestCase{
 				Query:          v,
 				SkipComparison: q.SkipComparison,
@@ -146,8 +213,18 @@ func ExpandTestCases(cases []*config.TestCase, tweaks []*config.QueryTweak, star
 				End:            end,
 				Resolution:     resolution,
 			}
+			tc.Category, tc.Functions = queryCategory(v)
 
-			tcs = append(tcs, applyQueryTweaks(tc, tweaks))
+			tc = applyQueryTweaks(tc, tweaks)
+			if tc.TimeZone == "" {
+				// The reference results of the equivalent query are not converted to the time zone.
+				tc.EquivalentQuery = equivalentQuery(tc.Query, tc.Start, tc.End)
+			}
+			if nativeVs != nil {
+				tc.NativeHistogramQuery = nativeVs[i]
+				tc.NativeHistogramTolerance = q.NativeHistogramTolerance
+			}
+			tcs = append(tcs, tc)
 		}
 	}
 	return tcs
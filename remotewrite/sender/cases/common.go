@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -22,8 +23,24 @@ type Test struct {
 
 	// Optional "middleware" to intercept the write requests.
 	Writes func(http.Handler) http.Handler
+
+	// Optional feature whose support is checked by this test, for the
+	// feature support matrix.
+	Feature Feature
 }
 
+// Feature is a remote write feature that a sender may or may not support.
+type Feature string
+
+const (
+	FeatureExemplars  Feature = "exemplars"
+	FeatureHistograms Feature = "histograms"
+	FeatureSummaries  Feature = "summaries"
+	FeatureStaleness  Feature = "staleness markers"
+	FeatureUTF8Names  Feature = "UTF-8 names"
+	FeatureHTTP2      Feature = "HTTP/2"
+)
+
 func metricHandler(c prometheus.Collector) http.Handler {
 	r := prometheus.NewPedanticRegistry()
 	r.MustRegister(c)
@@ -46,8 +63,10 @@ type Appendable struct {
 }
 
 type Batch struct {
-	appender *Appendable
-	samples  []sample
+	appender  *Appendable
+	samples   []sample
+	exemplars []exemplarSample
+	received  time.Time
 }
 
 type sample struct {
@@ -56,6 +75,11 @@ type sample struct {
 	v float64
 }
 
+type exemplarSample struct {
+	l labels.Labels
+	e exemplar.Exemplar
+}
+
 func (m *Appendable) Appender(_ context.Context) storage.Appender {
 	b := &Batch{
 		appender: m,
@@ -69,6 +93,7 @@ func (m *Batch) Append(_ storage.SeriesRef, l labels.Labels, t int64, v float64)
 }
 
 func (m *Batch) Commit() error {
+	m.received = time.Now()
 	m.appender.Mutex.Lock()
 	defer m.appender.Mutex.Unlock()
 	m.appender.Batches = append(m.appender.Batches, *m)
@@ -79,8 +104,8 @@ func (*Batch) Rollback() error {
 	return nil
 }
 
-func (*Batch) AppendExemplar(_ storage.SeriesRef, l labels.Labels, e exemplar.Exemplar) (storage.SeriesRef, error) {
-	// TODO(bwplotka): Implement for v2.
+func (m *Batch) AppendExemplar(_ storage.SeriesRef, l labels.Labels, e exemplar.Exemplar) (storage.SeriesRef, error) {
+	m.exemplars = append(m.exemplars, exemplarSample{l, e})
 	return 0, nil
 }
 
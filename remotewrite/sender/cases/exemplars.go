@@ -0,0 +1,48 @@
+package cases
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/stretchr/testify/require"
+)
+
+// ExemplarsTest exposes a counter with an exemplar in the OpenMetrics format
+// and checks that the exemplar is sent along with the right series.
+func ExemplarsTest() Test {
+	ts := time.Now().Truncate(time.Millisecond)
+	contents := fmt.Sprintf(`# TYPE requests counter
+# HELP requests Total number of requests.
+requests_total 3 # {trace_id="4bf92f3577b34da6a3ce929d0e0e4736"} 1.5 %.3f
+# EOF
+`, float64(ts.UnixMilli())/1000)
+
+	return Test{
+		Name:    "Exemplars",
+		Feature: FeatureExemplars,
+		Metrics: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Exemplars are only part of the OpenMetrics format.
+			w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+			if _, err := w.Write([]byte(contents)); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+		}),
+		Expected: func(t *testing.T, bs []Batch) {
+			found := false
+			forAllExemplars(bs, func(e exemplarSample) {
+				if !labelsContain(e.l, labels.FromStrings("__name__", "requests_total")) {
+					return
+				}
+				require.Equal(t, labels.FromStrings("trace_id", "4bf92f3577b34da6a3ce929d0e0e4736"), e.e.Labels)
+				require.Equal(t, 1.5, e.e.Value)
+				require.Equal(t, timestamp.FromTime(ts), e.e.Ts)
+				found = true
+			})
+			require.True(t, found, `found no exemplar for {__name__="requests_total"}`)
+		},
+	}
+}
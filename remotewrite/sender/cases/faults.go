@@ -0,0 +1,128 @@
+package cases
+
+import (
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/require"
+)
+
+// Faults configures the network faults injected between the sender and the
+// receiver by Faults.Writes. Faulty requests never reach the receiver, so the
+// sender can retry them without causing duplicates.
+type Faults struct {
+	// ErrorRate is the fraction of requests rejected with 503.
+	ErrorRate float64
+	// ResetRate is the fraction of requests whose connection is reset
+	// without a response.
+	ResetRate float64
+	// MaxLatency is the upper bound of the random latency added to every
+	// request.
+	MaxLatency time.Duration
+	// Seed seeds the random faults, to make runs reproducible.
+	Seed int64
+}
+
+// DefaultFaults are the faults injected by FlakyNetworkTest.
+var DefaultFaults = Faults{
+	ErrorRate:  0.2,
+	ResetRate:  0.1,
+	MaxLatency: 200 * time.Millisecond,
+	Seed:       1,
+}
+
+// Writes returns a middleware that delays every remote write request and
+// fails some of them with a 503 or a connection reset, at the configured
+// rates, before they reach next.
+func (f Faults) Writes(next http.Handler) http.Handler {
+	var (
+		mtx sync.Mutex
+		rnd = rand.New(rand.NewSource(f.Seed))
+	)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		latency := time.Duration(rnd.Int63n(int64(f.MaxLatency) + 1))
+		fault := rnd.Float64()
+		mtx.Unlock()
+
+		time.Sleep(latency)
+		switch {
+		case fault < f.ErrorRate:
+			http.Error(w, "service unavailable", http.StatusServiceUnavailable)
+		case fault < f.ErrorRate+f.ResetRate:
+			resetConnection(w)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// resetConnection closes the connection of the request with a TCP RST
+// instead of sending a response. If the connection can't be hijacked, a 503
+// is sent instead.
+func resetConnection(w http.ResponseWriter) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	conn, _, err := hj.Hijack()
+	if err != nil {
+		http.Error(w, "service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		// Discard unsent data and send a RST on close.
+		_ = tcp.SetLinger(0)
+	}
+	conn.Close()
+}
+
+// FlakyNetworkTest exposes a gauge counting the scrapes and injects the
+// DefaultFaults into the remote write requests. It checks that the sender
+// eventually delivers the sample of every scrape exactly once: the received
+// values must be 1, 2, ... up to the last delivered scrape, without gaps or
+// repetitions. The samples of the last scrapes may still be queued when the
+// sender is stopped.
+func FlakyNetworkTest() Test {
+	var (
+		mtx     sync.Mutex
+		scrapes int
+	)
+
+	return Test{
+		Name: "FlakyNetwork",
+		Metrics: metricHandler(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "scrapes",
+		}, func() float64 {
+			mtx.Lock()
+			defer mtx.Unlock()
+			scrapes++
+			return float64(scrapes)
+		})),
+		Writes: DefaultFaults.Writes,
+		Expected: func(t *testing.T, bs []Batch) {
+			var values []float64
+			forAllSamples(bs, func(s sample) {
+				if labelsContain(s.l, labels.FromStrings("__name__", "scrapes")) {
+					values = append(values, s.v)
+				}
+			})
+			require.NotEmpty(t, values, `found zero samples for {__name__="scrapes"}`)
+
+			sort.Float64s(values)
+			for i, v := range values {
+				require.NotEqual(t, float64(i), v, `sample of scrape %v received more than once`, v)
+				require.Equal(t, float64(i+1), v, `sample of scrape %d lost`, i+1)
+			}
+		},
+	}
+}
@@ -54,6 +54,15 @@ func forAllSamples(bs []Batch, f func(s sample)) {
 	}
 }
 
+// forAllExemplars calls f on all exemplars in bs.
+func forAllExemplars(bs []Batch, f func(e exemplarSample)) {
+	for _, b := range bs {
+		for _, e := range b.exemplars {
+			f(e)
+		}
+	}
+}
+
 // labelsContain returns true if inner is a subset of outer.
 func labelsContain(outer, inner labels.Labels) bool {
 	i, j := 0, 0
@@ -20,6 +20,7 @@ func HistogramTest() Test {
 
 	return Test{
 		Name:    "Histogram",
+		Feature: FeatureHistograms,
 		Metrics: metricHandler(hist),
 		Expected: func(t *testing.T, bs []Batch) {
 			le1 := countMetricWithValue(t, bs, labels.FromStrings("__name__", "histogram_bucket", "le", "1"), 1.0)
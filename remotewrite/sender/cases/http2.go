@@ -0,0 +1,68 @@
+package cases
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/require"
+)
+
+// HTTP2Test exports a single counter and checks that the remote write
+// requests are sent over HTTP/2, and that their bodies can be read in full
+// and match their Content-Length, if set. Senders mishandling the flow
+// control of HTTP/2 streams fail to deliver their bodies. It only passes when
+// the requests are received over TLS with HTTP/2 enabled, as in
+// TestRemoteWriteHTTP2.
+func HTTP2Test() Test {
+	var (
+		mtx      sync.Mutex
+		requests int
+		errs     []error
+	)
+
+	return Test{
+		Name: "HTTP2",
+		Metrics: metricHandler(prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "http2_counter",
+		})),
+		Writes: func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				mtx.Lock()
+				requests++
+				if r.ProtoMajor != 2 {
+					errs = append(errs, fmt.Errorf("request sent over %s instead of HTTP/2", r.Proto))
+				}
+				if err != nil {
+					errs = append(errs, fmt.Errorf("reading body: %w", err))
+				} else if r.ContentLength >= 0 && int64(len(body)) != r.ContentLength {
+					errs = append(errs, fmt.Errorf("body of %d bytes, but Content-Length is %d", len(body), r.ContentLength))
+				}
+				mtx.Unlock()
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+
+				r.Body = io.NopCloser(bytes.NewReader(body))
+				next.ServeHTTP(w, r)
+			})
+		},
+		Expected: func(t *testing.T, bs []Batch) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			require.NotZero(t, requests, "no remote write requests received")
+			require.Empty(t, errs)
+
+			found := countMetricWithValue(t, bs, labels.FromStrings("__name__", "http2_counter_total"), 0)
+			require.True(t, found > 0, `found zero samples for {__name__="http2_counter_total"}`)
+		},
+		Feature: FeatureHTTP2,
+	}
+}
@@ -0,0 +1,35 @@
+package cases
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+// LatencyMetrics exposes a single gauge whose value is the time of the
+// scrape in milliseconds, to measure how long a sample takes to get from
+// the scrape target to the receiver.
+func LatencyMetrics() http.Handler {
+	return metricHandler(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "scrape_time_ms",
+	}, func() float64 {
+		return float64(time.Now().UnixMilli())
+	}))
+}
+
+// ScrapeToWriteLatencies returns, for every sample exposed by LatencyMetrics,
+// the time between it being scraped and it being received via remote write.
+func ScrapeToWriteLatencies(bs []Batch) []time.Duration {
+	var latencies []time.Duration
+	ls := labels.FromStrings("__name__", "scrape_time_ms")
+	for _, b := range bs {
+		for _, s := range b.samples {
+			if labelsContain(s.l, ls) {
+				latencies = append(latencies, b.received.Sub(time.UnixMilli(int64(s.v))))
+			}
+		}
+	}
+	return latencies
+}
@@ -0,0 +1,86 @@
+package cases
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/require"
+)
+
+// OpenMetricsSuffixesTest exposes a counter with a created timestamp in the
+// OpenMetrics format and checks that the sample of foo_total is sent with the
+// _total suffix. If the sender sends foo_created as a series, its value must
+// be the created timestamp as exposed.
+func OpenMetricsSuffixesTest() Test {
+	return Test{
+		Name: "OpenMetricsSuffixes",
+		Metrics: rawMetricsHandler("application/openmetrics-text; version=1.0.0; charset=utf-8", `# TYPE foo counter
+# HELP foo Total number of foos.
+foo_total 1.0
+foo_created 1.6e+09
+# EOF
+`),
+		Expected: func(t *testing.T, bs []Batch) {
+			totals := countMetricWithValue(t, bs, labels.FromStrings("__name__", "foo_total"), 1.0)
+			require.True(t, totals > 0, `found zero samples for {__name__="foo_total"}`)
+
+			created := countMetricWithValue(t, bs, labels.FromStrings("__name__", "foo_created"), 1.6e+09)
+			t.Logf("found %d samples for {__name__=\"foo_created\"}", created)
+		},
+	}
+}
+
+// OpenMetricsCounterNamingTest exposes a counter in the OpenMetrics format,
+// terminated by "# EOF", and checks that its sample is sent either as
+// bar_total, as exposed, or normalized to the family name bar. Senders SHOULD
+// keep the _total suffix, so the choice of the sender is logged.
+func OpenMetricsCounterNamingTest() Test {
+	return Test{
+		Name: "OpenMetricsCounterNaming",
+		Metrics: rawMetricsHandler("application/openmetrics-text; version=1.0.0; charset=utf-8", `# TYPE bar counter
+# HELP bar Total number of bars.
+bar_total 5.0
+# EOF
+`),
+		Expected: func(t *testing.T, bs []Batch) {
+			totals := countMetricWithValue(t, bs, labels.FromStrings("__name__", "bar_total"), 5.0)
+			normalized := countMetricWithValue(t, bs, labels.FromStrings("__name__", "bar"), 5.0)
+			require.True(t, totals+normalized > 0, `found zero samples for {__name__="bar_total"} or {__name__="bar"}`)
+			require.False(t, totals > 0 && normalized > 0, `found samples for both {__name__="bar_total"} and {__name__="bar"}`)
+
+			if normalized > 0 {
+				t.Logf("sender normalizes the counter name to the family name bar, it SHOULD keep bar_total as exposed")
+			} else {
+				t.Logf("sender keeps the counter name bar_total as exposed")
+			}
+		},
+	}
+}
+
+// UTF8MetricNameTest exposes a metric with a name that is only valid with
+// UTF-8 names, using the quoted syntax, and checks that the metric name is
+// sent verbatim.
+func UTF8MetricNameTest() Test {
+	return Test{
+		Name:    "UTF8MetricName",
+		Feature: FeatureUTF8Names,
+		Metrics: rawMetricsHandler("text/plain; version=0.0.4; charset=utf-8; escaping=allow-utf-8", `# TYPE "my.app.requests" counter
+{"my.app.requests", "http.method"="GET"} 2
+`),
+		Expected: func(t *testing.T, bs []Batch) {
+			count := countMetricWithValue(t, bs, labels.FromStrings("__name__", "my.app.requests", "http.method", "GET"), 2.0)
+			require.True(t, count > 0, `found zero samples for {"my.app.requests", "http.method"="GET"}`)
+		},
+	}
+}
+
+// rawMetricsHandler serves the given exposition as is with the given content type.
+func rawMetricsHandler(contentType, contents string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		if _, err := w.Write([]byte(contents)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
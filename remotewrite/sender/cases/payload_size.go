@@ -0,0 +1,117 @@
+package cases
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+// payloadSize is the size of the body of a single remote write request.
+type payloadSize struct {
+	encoding            string
+	compressed, decoded int
+}
+
+// PayloadSizeTest exports a few series and logs the size of every remote
+// write request on the wire and once decoded, and the totals over all
+// requests. The spec only recommends keeping payloads small, and snappy can
+// expand small or incompressible batches, so the sizes are not asserted.
+func PayloadSizeTest() Test {
+	var (
+		mtx   sync.Mutex
+		sizes []payloadSize
+	)
+
+	gauges := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "payload_size",
+	}, []string{"series"})
+	for i := 0; i < 10; i++ {
+		gauges.WithLabelValues(fmt.Sprintf("%d", i)).Set(float64(i))
+	}
+
+	return Test{
+		Name:    "PayloadSize",
+		Metrics: metricHandler(gauges),
+		Writes: func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				size := payloadSize{encoding: r.Header.Get("Content-Encoding"), compressed: len(body), decoded: len(body)}
+				if size.encoding == "snappy" {
+					if decoded, err := snappy.Decode(nil, body); err == nil {
+						size.decoded = len(decoded)
+					}
+				}
+				mtx.Lock()
+				sizes = append(sizes, size)
+				mtx.Unlock()
+
+				r.Body = io.NopCloser(bytes.NewReader(body))
+				next.ServeHTTP(w, r)
+			})
+		},
+		Expected: func(t *testing.T, bs []Batch) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			require.NotEmpty(t, sizes, "no remote write requests received")
+			for i, s := range sizes {
+				t.Logf("request %d: Content-Encoding %q, %d bytes on the wire, %d bytes decoded", i, s.encoding, s.compressed, s.decoded)
+			}
+			newPayloadStats(sizes, bs).log(t)
+		},
+	}
+}
+
+// payloadStats are the total sizes of the requests on the wire and decoded,
+// and the number of received samples.
+type payloadStats struct {
+	requests, compressed, decoded, samples int
+}
+
+func newPayloadStats(sizes []payloadSize, bs []Batch) payloadStats {
+	stats := payloadStats{requests: len(sizes)}
+	for _, s := range sizes {
+		stats.compressed += s.compressed
+		stats.decoded += s.decoded
+	}
+	for _, b := range bs {
+		stats.samples += len(b.samples)
+	}
+	return stats
+}
+
+// compressionRatio is the ratio of decoded to compressed bytes.
+func (s payloadStats) compressionRatio() float64 {
+	if s.compressed == 0 {
+		return 0
+	}
+	return float64(s.decoded) / float64(s.compressed)
+}
+
+// bytesPerSample is the number of bytes on the wire per received sample.
+func (s payloadStats) bytesPerSample() float64 {
+	if s.samples == 0 {
+		return math.Inf(1)
+	}
+	return float64(s.compressed) / float64(s.samples)
+}
+
+// log logs the total size of the requests on the wire and decoded, the
+// compression ratio and the number of bytes on the wire per received sample.
+func (s payloadStats) log(t *testing.T) {
+	t.Helper()
+	t.Logf("%d requests, %d bytes on the wire, %d bytes decoded", s.requests, s.compressed, s.decoded)
+	t.Logf("compression ratio: %.2f", s.compressionRatio())
+	t.Logf("%.2f bytes on the wire per sample (%d samples)", s.bytesPerSample(), s.samples)
+}
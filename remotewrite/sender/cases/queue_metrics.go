@@ -0,0 +1,61 @@
+package cases
+
+import (
+	"math"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	samplesInMetric      = "prometheus_remote_storage_samples_in_total"
+	samplesOutMetric     = "prometheus_remote_storage_samples_total"
+	samplesPendingMetric = "prometheus_remote_storage_samples_pending"
+	samplesFailedMetric  = "prometheus_remote_storage_samples_failed_total"
+	samplesDroppedMetric = "prometheus_remote_storage_samples_dropped_total"
+)
+
+// ValidateQueueMetrics checks that the remote write queue metrics scraped from
+// the sender itself exist and are consistent after a successful run: every
+// sample that went in was either sent, failed, dropped or is still pending.
+// The metrics are not updated atomically, so a small difference is tolerated.
+func ValidateQueueMetrics(t *testing.T, mfs map[string]*dto.MetricFamily) {
+	for _, name := range []string{samplesInMetric, samplesOutMetric, samplesPendingMetric} {
+		require.Contains(t, mfs, name, "sender does not expose %s", name)
+	}
+
+	in := sumMetricFamily(mfs[samplesInMetric])
+	out := sumMetricFamily(mfs[samplesOutMetric])
+	pending := sumMetricFamily(mfs[samplesPendingMetric])
+	failed := sumMetricFamily(mfs[samplesFailedMetric])
+	dropped := sumMetricFamily(mfs[samplesDroppedMetric])
+	t.Logf("samples in: %v, out: %v, pending: %v, failed: %v, dropped: %v", in, out, pending, failed, dropped)
+
+	require.Greater(t, in, 0.0, "no samples went in to the queue")
+	require.Greater(t, out, 0.0, "no samples were sent")
+	require.Zero(t, failed, "samples failed although the receiver accepted all requests")
+	require.LessOrEqual(t, out+failed+dropped, in, "more samples left the queue than went in")
+	require.LessOrEqual(t, math.Abs(in-out-failed-dropped-pending), in/10,
+		"samples in does not match samples out, failed, dropped and pending")
+}
+
+// sumMetricFamily sums the values of all the counters and gauges of the
+// family, 0 for a nil family.
+func sumMetricFamily(mf *dto.MetricFamily) float64 {
+	if mf == nil {
+		return 0
+	}
+	var sum float64
+	for _, m := range mf.GetMetric() {
+		switch {
+		case m.Counter != nil:
+			sum += m.GetCounter().GetValue()
+		case m.Gauge != nil:
+			sum += m.GetGauge().GetValue()
+		case m.Untyped != nil:
+			sum += m.GetUntyped().GetValue()
+		}
+	}
+	return sum
+}
@@ -60,12 +60,69 @@ func Retries500Test() Test {
 	}
 }
 
-// Retries400Test rejects the first remote write and checks it doesn't get resent.
+// RetriesNoDuplicatesTest rejects the first remote write with 503 and checks
+// that all of its samples are received exactly once after the retry, and that
+// no sample is received twice overall.
+func RetriesNoDuplicatesTest() Test {
+	var (
+		mtx      sync.Mutex
+		accept   bool
+		rejected []sample
+	)
+
+	return Test{
+		Name: "RetriesNoDuplicates",
+		Metrics: metricHandler(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "now",
+		}, func() float64 {
+			return float64(time.Now().Unix() * 1000)
+		})),
+		Writes: func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mtx.Lock()
+				defer mtx.Unlock()
+
+				if accept {
+					next.ServeHTTP(w, r)
+					return
+				}
+
+				var ok bool
+				rejected, ok = decodeSamples(w, r)
+				if !ok {
+					return
+				}
+				accept = true
+				http.Error(w, "service unavailable", http.StatusServiceUnavailable)
+			})
+		},
+		Expected: func(t *testing.T, bs []Batch) {
+			require.NotEmpty(t, rejected, `no samples in the rejected batch`)
+
+			type key struct {
+				series string
+				t      int64
+			}
+			counts := map[key]int{}
+			forAllSamples(bs, func(s sample) {
+				k := key{series: s.l.String(), t: s.t}
+				counts[k]++
+				require.Equal(t, 1, counts[k], `sample %s@%d received more than once`, s.l, s.t)
+			})
+			for _, r := range rejected {
+				require.Equal(t, 1, counts[key{series: r.l.String(), t: r.t}], `sample %s@%d from the rejected batch was not retried`, r.l, r.t)
+			}
+		},
+	}
+}
+
+// Retries400Test rejects the first remote write and checks that none of its
+// samples get resent, while later samples are still sent.
 func Retries400Test() Test {
 	var (
-		mtx    sync.Mutex
-		accept bool
-		ts     int64
+		mtx      sync.Mutex
+		accept   bool
+		rejected []sample
 	)
 
 	return Test{
@@ -85,42 +142,65 @@ func Retries400Test() Test {
 					return
 				}
 
-				// We're going to pick a timestamp from this batch, and then make sure
-				// it gets resent.  First we need to decode this batch.
-				ts = getFirstTimestamp(w, r)
+				// Record the whole batch to make sure none of it gets resent.
+				var ok bool
+				rejected, ok = decodeSamples(w, r)
+				if !ok {
+					return
+				}
 				accept = true
 				http.Error(w, "bad request", http.StatusBadRequest)
 			})
 
 		},
 		Expected: func(t *testing.T, bs []Batch) {
-			found := false
+			require.NotEmpty(t, rejected, `no samples in the rejected batch`)
+
+			received := false
 			forAllSamples(bs, func(s sample) {
-				if labelsContain(s.l, labels.FromStrings("__name__", "now")) && s.t == ts {
-					found = true
+				for _, r := range rejected {
+					require.False(t, labels.Equal(s.l, r.l) && s.t == r.t, `found sample %s@%d that should not have been retried`, s.l, s.t)
+				}
+				if labelsContain(s.l, labels.FromStrings("__name__", "now")) {
+					received = true
 				}
 			})
-			require.False(t, found, `found sample that should not have been retried`)
+			require.True(t, received, `no samples received after the rejected batch`)
 		},
 	}
 }
 
 func getFirstTimestamp(w http.ResponseWriter, r *http.Request) int64 {
+	samples, ok := decodeSamples(w, r)
+	if !ok {
+		return -1
+	}
+
+	// Find a sample for "now{}" and record its timestamp.
+	var ts int64 = -1
+	for _, s := range samples {
+		if labelsContain(s.l, labels.FromStrings("__name__", "now")) {
+			ts = s.t
+		}
+	}
+	return ts
+}
+
+// decodeSamples decodes the samples of the remote write request. If the
+// request can't be decoded, the error is written to w and false is returned.
+func decodeSamples(w http.ResponseWriter, r *http.Request) ([]sample, bool) {
 	ap := Appendable{}
 	h := remote.NewWriteHandler(log.NewNopLogger(), nil, &ap, []config.RemoteWriteProtoMsg{config.RemoteWriteProtoMsgV1})
 	rec := httptest.NewRecorder()
 	h.ServeHTTP(rec, r)
 	if rec.Code/100 != 2 {
 		http.Error(w, "", rec.Code)
-		return -1
+		return nil, false
 	}
 
-	// Find a sample for "now{}" and record its timestamp.
-	var ts int64 = -1
+	var samples []sample
 	forAllSamples(ap.Batches, func(s sample) {
-		if labelsContain(s.l, labels.FromStrings("__name__", "now")) {
-			ts = s.t
-		}
+		samples = append(samples, s)
 	})
-	return ts
+	return samples, true
 }
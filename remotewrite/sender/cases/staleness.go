@@ -26,7 +26,8 @@ func StalenessTest() Test {
 	reg.MustRegister(gauge)
 
 	return Test{
-		Name: "Staleness",
+		Name:    "Staleness",
+		Feature: FeatureStaleness,
 		Metrics: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			handler.ServeHTTP(w, r)
 
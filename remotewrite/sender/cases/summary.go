@@ -22,6 +22,7 @@ func SummaryTest() Test {
 
 	return Test{
 		Name:    "Summary",
+		Feature: FeatureSummaries,
 		Metrics: metricHandler(summary),
 		Expected: func(t *testing.T, bs []Batch) {
 			p50 := countMetricWithValue(t, bs, labels.FromStrings("__name__", "summary", "quantile", "0.5"), 2.0)
@@ -0,0 +1,117 @@
+package cases
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/model/labels"
+	writev2 "github.com/prometheus/prometheus/prompb/io/prometheus/write/v2"
+	"github.com/stretchr/testify/require"
+)
+
+// MetadataSymbolsTest exposes a few gauges in the OpenMetrics format, several
+// of which share the same help text and unit, and checks the symbol references
+// of the metadata of every Remote Write 2.0 request: the help and unit refs
+// must be in range of the symbol table, and identical help and unit strings
+// must reuse the same symbol. Remote Write 1.0 requests are not checked.
+func MetadataSymbolsTest() Test {
+	var (
+		mtx  sync.Mutex
+		errs []error
+	)
+
+	return Test{
+		Name: "MetadataSymbols",
+		Metrics: rawMetricsHandler("application/openmetrics-text; version=1.0.0; charset=utf-8", `# TYPE disk_read_bytes gauge
+# UNIT disk_read_bytes bytes
+# HELP disk_read_bytes Bytes transferred by the disk.
+disk_read_bytes 1.0
+# TYPE disk_written_bytes gauge
+# UNIT disk_written_bytes bytes
+# HELP disk_written_bytes Bytes transferred by the disk.
+disk_written_bytes 2.0
+# TYPE disk_temperature_celsius gauge
+# UNIT disk_temperature_celsius celsius
+# HELP disk_temperature_celsius Temperature of the disk.
+disk_temperature_celsius 40.0
+# EOF
+`),
+		Writes: func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				if err := checkMetadataSymbols(r, body); err != nil {
+					mtx.Lock()
+					errs = append(errs, err)
+					mtx.Unlock()
+				}
+
+				r.Body = io.NopCloser(bytes.NewReader(body))
+				next.ServeHTTP(w, r)
+			})
+		},
+		Expected: func(t *testing.T, bs []Batch) {
+			for _, name := range []string{"disk_read_bytes", "disk_written_bytes", "disk_temperature_celsius"} {
+				n := countMetricWithValueFn(bs, labels.FromStrings("__name__", name),
+					func(int64, float64) bool { return true })
+				require.True(t, n > 0, `found zero samples for {__name__="%s"}`, name)
+			}
+
+			mtx.Lock()
+			defer mtx.Unlock()
+			require.Empty(t, errs)
+		},
+	}
+}
+
+// checkMetadataSymbols decodes a Remote Write 2.0 request and checks that the
+// help and unit refs of the metadata of every series are in range of the
+// symbol table, and that every help or unit string is referenced by a single
+// symbol index. Other requests are ignored.
+func checkMetadataSymbols(r *http.Request, body []byte) error {
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || params["proto"] != protoMsgV2 {
+		return nil
+	}
+
+	if r.Header.Get("Content-Encoding") == "snappy" {
+		if body, err = snappy.Decode(nil, body); err != nil {
+			return fmt.Errorf("decoding snappy body: %w", err)
+		}
+	}
+	var req writev2.Request
+	if err := req.Unmarshal(body); err != nil {
+		return fmt.Errorf("unmarshaling %s: %w", protoMsgV2, err)
+	}
+
+	refs := map[string]uint32{}
+	checkRef := func(kind string, ref uint32) error {
+		if int(ref) >= len(req.Symbols) {
+			return fmt.Errorf("metadata %s ref %d out of range of %d symbols", kind, ref, len(req.Symbols))
+		}
+		s := req.Symbols[ref]
+		if prev, ok := refs[s]; ok && prev != ref {
+			return fmt.Errorf("metadata %s %q referenced by both symbols %d and %d", kind, s, prev, ref)
+		}
+		refs[s] = ref
+		return nil
+	}
+	for _, ts := range req.Timeseries {
+		if err := checkRef("help", ts.Metadata.HelpRef); err != nil {
+			return err
+		}
+		if err := checkRef("unit", ts.Metadata.UnitRef); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package cases
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/snappy"
+	writev2 "github.com/prometheus/prometheus/prompb/io/prometheus/write/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckMetadataSymbols(t *testing.T) {
+	symbols := []string{"", "__name__", "disk_read_bytes", "Bytes transferred by the disk.", "bytes", "Bytes transferred by the disk."}
+	series := func(helpRef, unitRef uint32) writev2.TimeSeries {
+		return writev2.TimeSeries{
+			LabelsRefs: []uint32{1, 2},
+			Metadata:   writev2.Metadata{Type: writev2.Metadata_METRIC_TYPE_GAUGE, HelpRef: helpRef, UnitRef: unitRef},
+		}
+	}
+
+	for _, tc := range []struct {
+		name        string
+		contentType string
+		series      []writev2.TimeSeries
+		err         string
+	}{
+		{
+			name:        "valid",
+			contentType: "application/x-protobuf;proto=" + protoMsgV2,
+			series:      []writev2.TimeSeries{series(3, 4), series(3, 4)},
+		},
+		{
+			name:        "out of range ref",
+			contentType: "application/x-protobuf;proto=" + protoMsgV2,
+			series:      []writev2.TimeSeries{series(3, 6)},
+			err:         "metadata unit ref 6 out of range of 6 symbols",
+		},
+		{
+			name:        "same string under two refs",
+			contentType: "application/x-protobuf;proto=" + protoMsgV2,
+			series:      []writev2.TimeSeries{series(3, 4), series(5, 4)},
+			err:         `metadata help "Bytes transferred by the disk." referenced by both symbols 3 and 5`,
+		},
+		{
+			// Only Remote Write 2.0 requests are decoded, so the out of range ref is not reported.
+			name:        "v1 request ignored",
+			contentType: "application/x-protobuf",
+			series:      []writev2.TimeSeries{series(3, 6)},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := writev2.Request{Symbols: symbols, Timeseries: tc.series}
+			b, err := req.Marshal()
+			require.NoError(t, err)
+			r := httptest.NewRequest("POST", "/push", strings.NewReader(""))
+			r.Header.Set("Content-Type", tc.contentType)
+			r.Header.Set("Content-Encoding", "snappy")
+
+			err = checkMetadataSymbols(r, snappy.Encode(nil, b))
+			if tc.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, tc.err)
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package cases
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	protoMsgV1 = "prometheus.WriteRequest"
+	protoMsgV2 = "io.prometheus.write.v2.Request"
+)
+
+// VersionHeaderTest exports a single metric - a gauge - and checks that the
+// protocol version advertised in the version header of every remote write
+// request is consistent with the protobuf message announced in the content type.
+func VersionHeaderTest() Test {
+	var (
+		mtx    sync.Mutex
+		errors []error
+	)
+
+	return Test{
+		Name: "VersionHeader",
+		Metrics: metricHandler(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "now",
+		}, func() float64 {
+			return float64(time.Now().Unix() * 1000)
+		})),
+		Writes: func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := checkVersionHeader(r); err != nil {
+					mtx.Lock()
+					errors = append(errors, err)
+					mtx.Unlock()
+				}
+				next.ServeHTTP(w, r)
+			})
+		},
+		Expected: func(t *testing.T, bs []Batch) {
+			nows := countMetricWithValueFn(bs, labels.FromStrings("__name__", "now"),
+				func(int64, float64) bool { return true })
+			require.True(t, nows > 0, `found zero samples for {__name__="now"}`)
+
+			mtx.Lock()
+			defer mtx.Unlock()
+			require.Empty(t, errors)
+		},
+	}
+}
+
+// checkVersionHeader checks that X-Prometheus-Remote-Write-Version is a 0.1.x
+// version for Remote Write 1.0 requests and 2.0.0 for Remote Write 2.0 requests.
+// A content type without a proto parameter implies Remote Write 1.0.
+func checkVersionHeader(r *http.Request) error {
+	contentType := r.Header.Get("Content-Type")
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("invalid Content-Type '%s': %w", contentType, err)
+	}
+	if mediaType != "application/x-protobuf" {
+		return fmt.Errorf("media type of header 'Content-Type' != 'application/x-protobuf'; value is '%s'", mediaType)
+	}
+
+	version := r.Header.Get("X-Prometheus-Remote-Write-Version")
+	switch proto := params["proto"]; proto {
+	case "", protoMsgV1:
+		if !strings.HasPrefix(version, "0.1.") {
+			return fmt.Errorf("header 'X-Prometheus-Remote-Write-Version' is not 0.1.x for proto '%s'; value is '%s'", protoMsgV1, version)
+		}
+	case protoMsgV2:
+		if version != "2.0.0" {
+			return fmt.Errorf("header 'X-Prometheus-Remote-Write-Version' != '2.0.0' for proto '%s'; value is '%s'", protoMsgV2, version)
+		}
+	default:
+		return fmt.Errorf("unknown proto '%s' in Content-Type '%s'", proto, contentType)
+	}
+	return nil
+}
@@ -4,14 +4,22 @@
 package sender
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"sort"
+	"sync"
 	"testing"
+	"text/tabwriter"
 	"time"
 
 	"github.com/go-kit/log"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
 	"github.com/prometheus/compliance/remotewrite/sender/cases"
 	"github.com/prometheus/compliance/remotewrite/sender/targets"
 	"github.com/prometheus/prometheus/config"
@@ -35,6 +43,7 @@ var (
 		cases.GaugeTest,
 		cases.HistogramTest,
 		cases.SummaryTest,
+		cases.ExemplarsTest,
 
 		// Test Up metrics.
 		cases.UpTest,
@@ -47,21 +56,73 @@ var (
 		cases.RepeatedLabelsTest,
 		cases.EmptyLabelsTest,
 		cases.NameLabelTest,
+		cases.OpenMetricsSuffixesTest,
+		cases.OpenMetricsCounterNamingTest,
+		cases.UTF8MetricNameTest,
 		cases.HonorLabelsTest,
 
 		// Other misc tests.
 		cases.StalenessTest,
 		cases.TimestampTest,
 		cases.HeadersTest,
+		cases.VersionHeaderTest,
+		cases.PayloadSizeTest,
 		cases.OrderingTest,
 		cases.Retries500Test,
+		cases.RetriesNoDuplicatesTest,
 		cases.Retries400Test,
+		cases.FlakyNetworkTest,
 
 		// TODO:
 		// - Test labels have valid characters.
 	}
+
+	// queueMetricsRunners are the targets that can be configured to serve
+	// their own prometheus_remote_storage_* metrics on a given address.
+	queueMetricsRunners = map[string]targets.Target{
+		"grafana":    targets.RunGrafanaAgent,
+		"prometheus": targets.RunPrometheus,
+	}
+
+	// rw2Runners are the targets that can be configured to send io.prometheus.write.v2.Request.
+	rw2Runners = map[string]targets.Target{
+		"otelcollector": targets.RunOtelCollector,
+	}
+	rw2Tests = []func() cases.Test{
+		cases.CounterTest,
+		cases.GaugeTest,
+		cases.HistogramTest,
+		cases.SummaryTest,
+		cases.OpenMetricsSuffixesTest,
+		cases.OpenMetricsCounterNamingTest,
+		cases.UTF8MetricNameTest,
+		cases.MetadataSymbolsTest,
+		cases.VersionHeaderTest,
+	}
+
+	// http2Runners are the targets that can be configured to skip the
+	// verification of the self-signed certificate of the receiver, which they
+	// send remote write requests to over HTTP/2.
+	http2Runners = map[string]targets.Target{
+		"grafana":    targets.RunGrafanaAgent,
+		"prometheus": targets.RunPrometheus,
+		"vmagent":    targets.RunVMAgent,
+	}
+	http2Tests = []func() cases.Test{
+		cases.HTTP2Test,
+		cases.CounterTest,
+		cases.HistogramTest,
+		cases.PayloadSizeTest,
+		cases.Retries500Test,
+	}
 )
 
+func TestMain(m *testing.M) {
+	code := m.Run()
+	features.print(os.Stdout)
+	os.Exit(code)
+}
+
 func TestRemoteWrite(t *testing.T) {
 	for name, runner := range runners {
 		t.Run(name, func(t *testing.T) {
@@ -69,16 +130,256 @@ func TestRemoteWrite(t *testing.T) {
 				tc := fn()
 				t.Run(tc.Name, func(t *testing.T) {
 					t.Parallel()
-					runTest(t, tc, runner)
+					runTest(t, tc, name, runner, config.RemoteWriteProtoMsgV1, false)
 				})
 			}
 		})
 	}
 }
 
-func runTest(t *testing.T, tc cases.Test, runner targets.Target) {
+func TestRemoteWrite2(t *testing.T) {
+	for name, runner := range rw2Runners {
+		t.Run(name, func(t *testing.T) {
+			for _, fn := range rw2Tests {
+				tc := fn()
+				t.Run(tc.Name, func(t *testing.T) {
+					t.Parallel()
+					runTest(t, tc, name, runner, config.RemoteWriteProtoMsgV2, false)
+				})
+			}
+		})
+	}
+}
+
+// TestRemoteWriteHTTP2 receives the remote write requests over TLS with
+// HTTP/2 enabled, to check that the senders interoperate with receivers
+// over HTTP/2.
+func TestRemoteWriteHTTP2(t *testing.T) {
+	for name, runner := range http2Runners {
+		t.Run(name, func(t *testing.T) {
+			for _, fn := range http2Tests {
+				tc := fn()
+				t.Run(tc.Name, func(t *testing.T) {
+					t.Parallel()
+					runTest(t, tc, name, runner, config.RemoteWriteProtoMsgV1, true)
+				})
+			}
+		})
+	}
+}
+
+// TestQueueMetrics scrapes the remote write queue metrics of the senders
+// shortly before they are stopped and checks that they are consistent.
+func TestQueueMetrics(t *testing.T) {
+	const timeout = 10 * time.Second
+	for name, runner := range queueMetricsRunners {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ap := cases.Appendable{}
+			scrapeTarget, receiveEndpoint := serve(t, cases.CounterTest(), &ap, false)
+			listenAddress := freeAddress(t)
+
+			var (
+				mfs       map[string]*dto.MetricFamily
+				scrapeErr error
+				done      = make(chan struct{})
+			)
+			go func() {
+				defer close(done)
+				time.Sleep(timeout - 2*time.Second)
+				mfs, scrapeErr = scrapeMetrics(fmt.Sprintf("http://%s/metrics", listenAddress))
+			}()
+
+			require.NoError(t, runner(targets.TargetOptions{
+				ScrapeTarget:    scrapeTarget,
+				ReceiveEndpoint: receiveEndpoint,
+				Timeout:         timeout,
+				ListenAddress:   listenAddress,
+			}))
+			<-done
+			require.NoError(t, scrapeErr)
+
+			cases.ValidateQueueMetrics(t, mfs)
+		})
+	}
+}
+
+func runTest(t *testing.T, tc cases.Test, target string, runner targets.Target, msg config.RemoteWriteProtoMsg, http2 bool) {
+	// Over HTTP/2, only the HTTP/2 feature itself is recorded, so that the
+	// other tests run over HTTP/2 don't affect the plain rows of their features.
+	if tc.Feature != "" && (!http2 || tc.Feature == cases.FeatureHTTP2) {
+		t.Cleanup(func() { features.record(target, msg, tc.Feature, t) })
+	}
+
 	ap := cases.Appendable{}
-	writeHandler := remote.NewWriteHandler(logger, nil, &ap, []config.RemoteWriteProtoMsg{config.RemoteWriteProtoMsgV1})
+	scrapeTarget, receiveEndpoint := serve(t, tc, &ap, http2)
+
+	// Run Prometheus to scrape and send metrics.
+	err := runner(targets.TargetOptions{
+		ScrapeTarget:       scrapeTarget,
+		ReceiveEndpoint:    receiveEndpoint,
+		Timeout:            10 * time.Second,
+		RemoteWriteMessage: msg,
+		InsecureSkipVerify: http2,
+	})
+	if errors.Is(err, targets.ErrRemoteWriteMessageUnsupported) {
+		t.Skipf("target does not support %s", msg)
+	}
+	require.NoError(t, err)
+
+	// Check we got some data.
+	tc.Expected(t, ap.Batches)
+}
+
+// BenchmarkScrapeToWriteLatency measures, for every sender, the time between a
+// sample being scraped and the sample being received via remote write.
+func BenchmarkScrapeToWriteLatency(b *testing.B) {
+	for name, runner := range runners {
+		b.Run(name, func(b *testing.B) {
+			ap := cases.Appendable{}
+			scrapeTarget, receiveEndpoint := serve(b, cases.Test{Metrics: cases.LatencyMetrics()}, &ap, false)
+
+			require.NoError(b, runner(targets.TargetOptions{
+				ScrapeTarget:    scrapeTarget,
+				ReceiveEndpoint: receiveEndpoint,
+				Timeout:         10 * time.Second,
+			}))
+
+			latencies := cases.ScrapeToWriteLatencies(ap.Batches)
+			require.NotEmpty(b, latencies, "no samples received")
+			sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+			for _, q := range []struct {
+				name     string
+				quantile float64
+			}{{"p50", 0.5}, {"p90", 0.9}, {"p99", 0.99}, {"max", 1}} {
+				l := latencies[int(q.quantile*float64(len(latencies)-1))]
+				b.ReportMetric(float64(l)/float64(time.Millisecond), q.name+"-ms")
+			}
+		})
+	}
+}
+
+// featureMatrix records, per target and remote write protocol version,
+// whether all the tests of each feature passed.
+type featureMatrix struct {
+	mtx sync.Mutex
+	// Target -> version -> feature -> result.
+	results map[string]map[config.RemoteWriteProtoMsg]map[cases.Feature]string
+}
+
+var features = featureMatrix{results: map[string]map[config.RemoteWriteProtoMsg]map[cases.Feature]string{}}
+
+// record records the outcome of a finished test of the feature. A feature is
+// only supported if all its tests passed.
+func (fm *featureMatrix) record(target string, msg config.RemoteWriteProtoMsg, f cases.Feature, t *testing.T) {
+	fm.mtx.Lock()
+	defer fm.mtx.Unlock()
+
+	if fm.results[target] == nil {
+		fm.results[target] = map[config.RemoteWriteProtoMsg]map[cases.Feature]string{}
+	}
+	if fm.results[target][msg] == nil {
+		fm.results[target][msg] = map[cases.Feature]string{}
+	}
+	res := "yes"
+	switch {
+	case t.Failed():
+		res = "no"
+	case t.Skipped():
+		res = "n/a"
+	}
+	if prev, ok := fm.results[target][msg][f]; !ok || prev == "yes" || res == "no" {
+		fm.results[target][msg][f] = res
+	}
+}
+
+// print writes the feature support matrix as a table with a row per target
+// and protocol version and a column per feature.
+func (fm *featureMatrix) print(w io.Writer) {
+	fm.mtx.Lock()
+	defer fm.mtx.Unlock()
+
+	if len(fm.results) == 0 {
+		return
+	}
+
+	type row struct {
+		target string
+		msg    config.RemoteWriteProtoMsg
+	}
+	var (
+		rows     []row
+		allFeats = map[cases.Feature]struct{}{}
+	)
+	for target, versions := range fm.results {
+		for msg, feats := range versions {
+			rows = append(rows, row{target: target, msg: msg})
+			for f := range feats {
+				allFeats[f] = struct{}{}
+			}
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].target != rows[j].target {
+			return rows[i].target < rows[j].target
+		}
+		return rows[i].msg < rows[j].msg
+	})
+	var cols []cases.Feature
+	for f := range allFeats {
+		cols = append(cols, f)
+	}
+	sort.Slice(cols, func(i, j int) bool { return cols[i] < cols[j] })
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprint(tw, "TARGET\tPROTOCOL")
+	for _, f := range cols {
+		fmt.Fprintf(tw, "\t%s", f)
+	}
+	fmt.Fprintln(tw)
+	for _, r := range rows {
+		fmt.Fprintf(tw, "%s\t%s", r.target, r.msg)
+		for _, f := range cols {
+			res, ok := fm.results[r.target][r.msg][f]
+			if !ok {
+				res = "-"
+			}
+			fmt.Fprintf(tw, "\t%s", res)
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+}
+
+// freeAddress returns a local address with a port that is currently free.
+func freeAddress(tb testing.TB) string {
+	l, err := net.Listen("tcp", "localhost:")
+	require.NoError(tb, err)
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// scrapeMetrics scrapes the metrics in the text format from the URL.
+func scrapeMetrics(u string) (map[string]*dto.MetricFamily, error) {
+	resp, err := http.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("scraping %s: unexpected status code %d", u, resp.StatusCode)
+	}
+	var parser expfmt.TextParser
+	return parser.TextToMetricFamilies(resp.Body)
+}
+
+// serve starts a HTTP server exposing the test's metrics and receiving remote
+// write requests into ap. It returns the scrape target and the receive endpoint.
+// With http2, the remote write requests are received by a separate server over
+// TLS with HTTP/2 enabled, whose certificate is self-signed.
+func serve(tb testing.TB, tc cases.Test, ap *cases.Appendable, http2 bool) (scrapeTarget, receiveEndpoint string) {
+	writeHandler := remote.NewWriteHandler(logger, nil, ap, []config.RemoteWriteProtoMsg{config.RemoteWriteProtoMsgV1, config.RemoteWriteProtoMsgV2})
 	if tc.Writes != nil {
 		writeHandler = tc.Writes(writeHandler)
 	}
@@ -91,19 +392,16 @@ func runTest(t *testing.T, tc cases.Test, runner targets.Target) {
 		Handler: m,
 	}
 	l, err := net.Listen("tcp", "localhost:")
-	require.NoError(t, err)
+	require.NoError(tb, err)
 	go s.Serve(l)
-	defer s.Close()
-
-	// Run Prometheus to scrape and send metrics.
-	scrapeTarget := l.Addr().String()
-	receiveEndpoint := fmt.Sprintf("http://%s/push", l.Addr().String())
-	require.NoError(t, runner(targets.TargetOptions{
-		ScrapeTarget:    scrapeTarget,
-		ReceiveEndpoint: receiveEndpoint,
-		Timeout:         10 * time.Second,
-	}))
+	tb.Cleanup(func() { s.Close() })
 
-	// Check we got some data.
-	tc.Expected(t, ap.Batches)
+	if http2 {
+		ts := httptest.NewUnstartedServer(writeHandler)
+		ts.EnableHTTP2 = true
+		ts.StartTLS()
+		tb.Cleanup(ts.Close)
+		return l.Addr().String(), ts.URL + "/push"
+	}
+	return l.Addr().String(), fmt.Sprintf("http://%s/push", l.Addr().String())
 }
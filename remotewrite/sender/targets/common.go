@@ -5,6 +5,7 @@ import (
 	"archive/zip"
 	"bytes"
 	"compress/gzip"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -19,6 +20,8 @@ import (
 	"syscall"
 	"text/template"
 	"time"
+
+	"github.com/prometheus/prometheus/config"
 )
 
 type Target func(TargetOptions) error
@@ -27,8 +30,20 @@ type TargetOptions struct {
 	ScrapeTarget    string
 	ReceiveEndpoint string
 	Timeout         time.Duration
+	// RemoteWriteMessage is the remote write message to send, prometheus.WriteRequest if empty.
+	RemoteWriteMessage config.RemoteWriteProtoMsg
+	// ListenAddress is the host:port the target serves its own HTTP endpoints on,
+	// including its metrics, a random port if empty. Not all targets support it.
+	ListenAddress string
+	// InsecureSkipVerify disables the verification of the TLS certificate of the
+	// receive endpoint, which is self-signed when receiving over HTTP/2. Not all
+	// targets support it.
+	InsecureSkipVerify bool
 }
 
+// ErrRemoteWriteMessageUnsupported is returned by targets that cannot send the requested remote write message.
+var ErrRemoteWriteMessageUnsupported = errors.New("remote write message not supported by the target")
+
 var downloadMtx sync.Mutex
 
 func downloadBinary(urlPattern string, filenameInArchivePattern string) (string, error) {
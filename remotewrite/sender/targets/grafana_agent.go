@@ -2,17 +2,32 @@ package targets
 
 import (
 	"fmt"
+	"net"
 	"os"
+
+	"github.com/prometheus/prometheus/config"
 )
 
 const grafanaAgentDownloadURL = "https://github.com/grafana/agent/releases/download/v0.19.0/agent-{{.OS}}-{{.Arch}}.zip"
 
 func RunGrafanaAgent(opts TargetOptions) error {
+	// Grafana Agent v0.19 predates remote write 2.0 and only sends prometheus.WriteRequest.
+	switch opts.RemoteWriteMessage {
+	case "", config.RemoteWriteProtoMsgV1:
+	default:
+		return ErrRemoteWriteMessageUnsupported
+	}
+
 	binary, err := downloadBinary(grafanaAgentDownloadURL, "agent-{{.OS}}-{{.Arch}}")
 	if err != nil {
 		return err
 	}
 
+	var tlsConfig string
+	if opts.InsecureSkipVerify {
+		tlsConfig = "\n      tls_config:\n        insecure_skip_verify: true"
+	}
+
 	// Write out config file.
 	cfg := fmt.Sprintf(`
 prometheus:
@@ -22,17 +37,26 @@ prometheus:
   configs:
   - name: test
     remote_write:
-    - url: '%s'
+    - url: '%s'%s
     scrape_configs:
     - job_name: 'test'
       static_configs:
       - targets: ['%s']
-`, opts.ReceiveEndpoint, opts.ScrapeTarget)
+`, opts.ReceiveEndpoint, tlsConfig, opts.ScrapeTarget)
 	configFileName, err := writeTempFile(cfg, "config-*.yaml")
 	if err != nil {
 		return err
 	}
 	defer os.Remove(configFileName)
 
-	return runCommand(binary, opts.Timeout, "-server.http-listen-port=0", "-server.grpc-listen-port=0", fmt.Sprintf("--config.file=%s", configFileName))
+	listenArgs := []string{"-server.http-listen-port=0"}
+	if opts.ListenAddress != "" {
+		host, port, err := net.SplitHostPort(opts.ListenAddress)
+		if err != nil {
+			return err
+		}
+		listenArgs = []string{"-server.http-listen-address=" + host, "-server.http-listen-port=" + port}
+	}
+
+	return runCommand(binary, opts.Timeout, append(listenArgs, "-server.grpc-listen-port=0", fmt.Sprintf("--config.file=%s", configFileName))...)
 }
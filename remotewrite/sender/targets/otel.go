@@ -3,11 +3,27 @@ package targets
 import (
 	"fmt"
 	"os"
+
+	"github.com/prometheus/prometheus/config"
 )
 
-const otelDownloadURL = "https://github.com/open-telemetry/opentelemetry-collector-releases/releases/download/v0.42.0/otelcol_0.42.0_{{.OS}}_{{.Arch}}.tar.gz"
+const otelDownloadURL = "https://github.com/open-telemetry/opentelemetry-collector-releases/releases/download/v0.121.0/otelcol_0.121.0_{{.OS}}_{{.Arch}}.tar.gz"
 
 func RunOtelCollector(opts TargetOptions) error {
+	var (
+		protobufMessage string
+		featureGates    string
+	)
+	switch opts.RemoteWriteMessage {
+	case "", config.RemoteWriteProtoMsgV1:
+	case config.RemoteWriteProtoMsgV2:
+		// Sending io.prometheus.write.v2.Request is experimental and behind a feature gate.
+		protobufMessage = fmt.Sprintf("\n    protobuf_message: '%s'", opts.RemoteWriteMessage)
+		featureGates = "--feature-gates=exporter.prometheusremotewritexporter.enableSendingRW2"
+	default:
+		return ErrRemoteWriteMessageUnsupported
+	}
+
 	binary, err := downloadBinary(otelDownloadURL, "otelcol")
 	if err != nil {
 		return err
@@ -29,7 +45,7 @@ processors:
 exporters:
   prometheusremotewrite:
     endpoint: '%s'
-    add_metric_suffixes: false
+    add_metric_suffixes: false%s
 
 service:
   pipelines:
@@ -37,12 +53,16 @@ service:
       receivers: [prometheus]
       processors: [batch]
       exporters: [prometheusremotewrite]
-`, opts.ScrapeTarget, opts.ReceiveEndpoint)
+`, opts.ScrapeTarget, opts.ReceiveEndpoint, protobufMessage)
 	configFileName, err := writeTempFile(cfg, "config-*.yaml")
 	if err != nil {
 		return err
 	}
 	defer os.Remove(configFileName)
 
-	return runCommand(binary, opts.Timeout, `--set=service.telemetry.metrics.address=:0`, fmt.Sprintf("--config=%s", configFileName))
+	args := []string{`--set=service.telemetry.metrics.level=none`, fmt.Sprintf("--config=%s", configFileName)}
+	if featureGates != "" {
+		args = append(args, featureGates)
+	}
+	return runCommand(binary, opts.Timeout, args...)
 }
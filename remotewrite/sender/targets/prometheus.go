@@ -3,16 +3,30 @@ package targets
 import (
 	"fmt"
 	"os"
+
+	"github.com/prometheus/prometheus/config"
 )
 
 const prometheusDownloadURL = "https://github.com/prometheus/prometheus/releases/download/v2.30.3/prometheus-2.30.3.{{.OS}}-{{.Arch}}.tar.gz"
 
 func RunPrometheus(opts TargetOptions) error {
+	// Prometheus v2.30 predates remote write 2.0 and only sends prometheus.WriteRequest.
+	switch opts.RemoteWriteMessage {
+	case "", config.RemoteWriteProtoMsgV1:
+	default:
+		return ErrRemoteWriteMessageUnsupported
+	}
+
 	binary, err := downloadBinary(prometheusDownloadURL, "prometheus")
 	if err != nil {
 		return err
 	}
 
+	var tlsConfig string
+	if opts.InsecureSkipVerify {
+		tlsConfig = "\n    tls_config:\n      insecure_skip_verify: true"
+	}
+
 	// Write out config file.
 	cfg := fmt.Sprintf(`
 global:
@@ -20,17 +34,23 @@ global:
 
 remote_write:
   - url: '%s'
+    send_exemplars: true%s
 
 scrape_configs:
   - job_name: 'test'
     static_configs:
     - targets: ['%s']
-`, opts.ReceiveEndpoint, opts.ScrapeTarget)
+`, opts.ReceiveEndpoint, tlsConfig, opts.ScrapeTarget)
 	configFileName, err := writeTempFile(cfg, "config-*.yaml")
 	if err != nil {
 		return err
 	}
 	defer os.Remove(configFileName)
 
-	return runCommand(binary, opts.Timeout, `--web.listen-address=0.0.0.0:0`, fmt.Sprintf("--config.file=%s", configFileName))
+	listenAddress := "0.0.0.0:0"
+	if opts.ListenAddress != "" {
+		listenAddress = opts.ListenAddress
+	}
+
+	return runCommand(binary, opts.Timeout, fmt.Sprintf("--web.listen-address=%s", listenAddress), `--enable-feature=exemplar-storage`, fmt.Sprintf("--config.file=%s", configFileName))
 }
@@ -3,11 +3,20 @@ package targets
 import (
 	"fmt"
 	"os"
+
+	"github.com/prometheus/prometheus/config"
 )
 
 const vmagentURL = "https://github.com/VictoriaMetrics/VictoriaMetrics/releases/download/v1.67.0/vmutils-{{.Arch}}-v1.67.0.tar.gz"
 
 func RunVMAgent(opts TargetOptions) error {
+	// vmagent only sends prometheus.WriteRequest, its own protocol is not remote write 2.0.
+	switch opts.RemoteWriteMessage {
+	case "", config.RemoteWriteProtoMsgV1:
+	default:
+		return ErrRemoteWriteMessageUnsupported
+	}
+
 	// NB this won't work on a Mac - need mac builds https://github.com/VictoriaMetrics/VictoriaMetrics/issues/1042!
 	// If you build it yourself and stick it in the bin/ directory, the tests will work.
 	binary, err := downloadBinary(vmagentURL, "vmagent-prod")
@@ -30,8 +39,14 @@ scrape_configs:
 	}
 	defer os.Remove(configFileName)
 
-	return runCommand(binary, opts.Timeout,
+	args := []string{
 		`-httpListenAddr=:0`, `-influxListenAddr=:0`,
 		fmt.Sprintf("-promscrape.config=%s", configFileName),
-		fmt.Sprintf("-remoteWrite.url=%s", opts.ReceiveEndpoint))
+		fmt.Sprintf("-remoteWrite.url=%s", opts.ReceiveEndpoint),
+	}
+	if opts.InsecureSkipVerify {
+		args = append(args, "-remoteWrite.tlsInsecureSkipVerify")
+	}
+
+	return runCommand(binary, opts.Timeout, args...)
 }